@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Plenty of things legitimately go quiet at night or over the weekend, batch jobs most of
+// all. A timeout's "active_hours" are the windows it fires in, like "Mon-Fri 08:00-20:00";
+// outside them the collector matches lines as usual but its timeouts are ignored. A window
+// is any of:
+//
+//   Mon-Fri 08:00-20:00   days and hours
+//   Sat,Sun               whole days
+//   22:00-06:00           hours, every day. Windows can cross midnight, the days being
+//                         the ones they start on.
+//
+// The times are in the timeout's "timezone", local time if it's empty.
+
+// activeWindow is one of the windows of active_hours. Start and end are minutes into the day.
+type activeWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+// activeHours are the windows a timeout fires in. A nil activeHours is always active.
+type activeHours struct {
+	windows  []activeWindow
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// newActiveHours parses the active_hours of a timeout, returning nil if there are none
+func newActiveHours(windows []string, timezone string) (*activeHours, error) {
+	if len(windows) == 0 {
+		if timezone != "" {
+			return nil, fmt.Errorf("A timeout's timezone is only used with active_hours")
+		}
+		return nil, nil
+	}
+
+	hours := &activeHours{location: time.Local}
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown timeout timezone %s: %s", timezone, err)
+		}
+		hours.location = location
+	}
+	for _, window := range windows {
+		parsed, err := parseActiveWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		hours.windows = append(hours.windows, parsed)
+	}
+	return hours, nil
+}
+
+// parseActiveWindow parses a window like "Mon-Fri 08:00-20:00"
+func parseActiveWindow(window string) (activeWindow, error) {
+	parsed := activeWindow{start: 0, end: 24 * 60}
+	fields := strings.Fields(window)
+	if len(fields) == 0 || len(fields) > 2 {
+		return parsed, fmt.Errorf("Invalid active_hours %q, expected something like \"Mon-Fri 08:00-20:00\"", window)
+	}
+
+	// The hours are the part with a colon in it
+	days, clock := fields[0], ""
+	if len(fields) == 2 {
+		clock = fields[1]
+	} else if strings.Contains(days, ":") {
+		days, clock = "", days
+	}
+
+	if days == "" {
+		for i := range parsed.days {
+			parsed.days[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(days, ",") {
+			bounds := strings.SplitN(part, "-", 2)
+			first, ok := weekdays[strings.ToLower(bounds[0])]
+			if !ok {
+				return parsed, fmt.Errorf("Invalid day %q in active_hours %q", bounds[0], window)
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+					return parsed, fmt.Errorf("Invalid day %q in active_hours %q", bounds[1], window)
+				}
+			}
+			// Ranges can wrap around the end of the week, like Fri-Mon
+			for day := first; ; day = (day + 1) % 7 {
+				parsed.days[day] = true
+				if day == last {
+					break
+				}
+			}
+		}
+	}
+
+	if clock != "" {
+		bounds := strings.SplitN(clock, "-", 2)
+		if len(bounds) != 2 {
+			return parsed, fmt.Errorf("Invalid hours %q in active_hours %q, expected something like 08:00-20:00", clock, window)
+		}
+		var err error
+		if parsed.start, err = parseClock(bounds[0]); err != nil {
+			return parsed, fmt.Errorf("Invalid active_hours %q: %s", window, err)
+		}
+		if parsed.end, err = parseClock(bounds[1]); err != nil {
+			return parsed, fmt.Errorf("Invalid active_hours %q: %s", window, err)
+		}
+		if parsed.start == parsed.end {
+			return parsed, fmt.Errorf("The hours in active_hours %q are empty", window)
+		}
+	}
+	return parsed, nil
+}
+
+// parseClock parses a time of day like 08:00 into minutes into the day. 24:00 is the end
+// of the day.
+func parseClock(clock string) (int, error) {
+	var hour, minute int
+	if n, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil || n != 2 || len(clock) != 5 {
+		return 0, fmt.Errorf("%q isn't a time like 08:00", clock)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("%q isn't a time of day", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// active reports whether now is within any of the windows
+func (hours *activeHours) active(now time.Time) bool {
+	if hours == nil {
+		return true
+	}
+	now = now.In(hours.location)
+	minute := now.Hour()*60 + now.Minute()
+	today := now.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, window := range hours.windows {
+		if window.start < window.end {
+			if window.days[today] && minute >= window.start && minute < window.end {
+				return true
+			}
+			continue
+		}
+		// Crossing midnight, the window belongs to the day it started on
+		if (window.days[today] && minute >= window.start) || (window.days[yesterday] && minute < window.end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewActiveHours(t *testing.T) {
+	hours, err := newActiveHours(nil, "")
+	assert.Nil(t, err)
+	assert.Nil(t, hours)
+	assert.True(t, hours.active(time.Now()))
+
+	for _, window := range []string{"Mon-Fri 08:00-20:00", "Sat,Sun", "22:00-06:00", "fri-mon 00:00-24:00"} {
+		_, err := newActiveHours([]string{window}, "")
+		assert.Nil(t, err, window)
+	}
+
+	invalid := [][]string{
+		{"Mon-Fry 08:00-20:00"},
+		{"Mon-Fri 8am-8pm"},
+		{"Mon-Fri 08:00"},
+		{"Mon-Fri 08:00-25:00"},
+		{"08:00-08:00"},
+		{"Mon Tue Wed"},
+	}
+	for _, windows := range invalid {
+		_, err := newActiveHours(windows, "")
+		assert.NotNil(t, err, windows[0])
+	}
+
+	_, err = newActiveHours([]string{"Mon-Fri"}, "Mars/Olympus_Mons")
+	assert.NotNil(t, err)
+	_, err = newActiveHours(nil, "Europe/London")
+	assert.NotNil(t, err)
+}
+
+func TestActiveHours(t *testing.T) {
+	hours, err := newActiveHours([]string{"Mon-Fri 08:00-20:00", "Sat 22:00-02:00"}, "America/New_York")
+	assert.Nil(t, err)
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	at := func(day int, hour int, minute int) time.Time {
+		// August 7th 2017 was a Monday
+		return time.Date(2017, 8, 7+day, hour, minute, 0, 0, newYork)
+	}
+
+	assert.True(t, hours.active(at(0, 8, 0)))
+	assert.True(t, hours.active(at(4, 19, 59)))
+	assert.False(t, hours.active(at(0, 7, 59)))
+	assert.False(t, hours.active(at(2, 20, 0)))
+	assert.False(t, hours.active(at(6, 12, 0)))
+
+	// Saturday night runs into Sunday, but Friday night doesn't
+	assert.True(t, hours.active(at(5, 23, 0)))
+	assert.True(t, hours.active(at(6, 1, 30)))
+	assert.False(t, hours.active(at(5, 1, 30)))
+	assert.False(t, hours.active(at(6, 22, 30)))
+
+	// The time is taken in the configured timezone whatever it's in
+	assert.True(t, hours.active(at(0, 8, 0).UTC()))
+}
+
+func TestCollectorTimeoutActiveHours(t *testing.T) {
+	// Hours without any windows are never active
+	collector := Collector{activeHours: &activeHours{location: time.UTC}}
+
+	// Outside the windows timeouts are ignored entirely
+	collector.handleTimeout()
+	assert.False(t, collector.timedOutOnce)
+
+	collector.activeHours = nil
+	collector.handleTimeout()
+	assert.True(t, collector.timedOutOnce)
+}
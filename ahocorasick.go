@@ -0,0 +1,115 @@
+package main
+
+// ahoCorasick matches lines against many literal strings at once. The strings are built
+// into a trie and, with the classic Aho-Corasick failure links, a line is matched against
+// all of them in a single pass however many there are. Looping over 50+ patterns for every
+// line is where busy collectors with a lot of known signatures spend their CPU.
+type ahoCorasick struct {
+	// The trie's transitions, one map per state with state 0 as the root
+	next []map[byte]int
+	// Where to carry on from when a state has no transition for the next byte, the state
+	// for the longest suffix of what we've seen that's also in the trie
+	fail []int
+	// Whether one of our strings ends at the state
+	end []bool
+	// Whether one of our strings ends at the state, or at any state it fails over to
+	output []bool
+
+	// Only match strings at the very start of lines
+	prefix bool
+}
+
+func newAhoCorasick(patterns []string, prefix bool) *ahoCorasick {
+	ac := &ahoCorasick{prefix: prefix}
+	ac.addState()
+
+	for _, pattern := range patterns {
+		state := 0
+		for i := 0; i < len(pattern); i++ {
+			next, ok := ac.next[state][pattern[i]]
+			if !ok {
+				next = ac.addState()
+				ac.next[state][pattern[i]] = next
+			}
+			state = next
+		}
+		ac.end[state] = true
+		ac.output[state] = true
+	}
+
+	// Work out the failure links breadth first, so a state's link is always ready before
+	// its children need it
+	queue := []int{}
+	for _, child := range ac.next[0] {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for c, child := range ac.next[state] {
+			queue = append(queue, child)
+
+			fail := ac.fail[state]
+			for fail != 0 && !ac.has(fail, c) {
+				fail = ac.fail[fail]
+			}
+			if next, ok := ac.next[fail][c]; ok && next != child {
+				ac.fail[child] = next
+			}
+			ac.output[child] = ac.output[child] || ac.output[ac.fail[child]]
+		}
+	}
+
+	return ac
+}
+
+func (ac *ahoCorasick) addState() int {
+	ac.next = append(ac.next, make(map[byte]int))
+	ac.fail = append(ac.fail, 0)
+	ac.end = append(ac.end, false)
+	ac.output = append(ac.output, false)
+	return len(ac.next) - 1
+}
+
+func (ac *ahoCorasick) has(state int, c byte) bool {
+	_, ok := ac.next[state][c]
+	return ok
+}
+
+func (ac *ahoCorasick) MatchString(line string) bool {
+	if ac.prefix {
+		return ac.matchPrefix(line)
+	}
+
+	state := 0
+	for i := 0; i < len(line); i++ {
+		if ac.output[state] {
+			return true
+		}
+		for state != 0 && !ac.has(state, line[i]) {
+			state = ac.fail[state]
+		}
+		if next, ok := ac.next[state][line[i]]; ok {
+			state = next
+		}
+	}
+	return ac.output[state]
+}
+
+// matchPrefix just walks down the trie from the start of the line, there's no failing over
+// to anywhere else
+func (ac *ahoCorasick) matchPrefix(line string) bool {
+	state := 0
+	for i := 0; i < len(line); i++ {
+		if ac.end[state] {
+			return true
+		}
+		next, ok := ac.next[state][line[i]]
+		if !ok {
+			return false
+		}
+		state = next
+	}
+	return ac.end[state]
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "disk full", "ushers"}
+	lines := []string{
+		"", "h", "he", "ahis", "sh", "ushe", "usher", "hi s", "ERROR: disk full!",
+		"disk ful", "xxxhersxxx", "sushi",
+	}
+
+	substrings := newAhoCorasick(patterns, false)
+	prefixes := newAhoCorasick(patterns, true)
+	for _, line := range lines {
+		contains, hasPrefix := false, false
+		for _, pattern := range patterns {
+			contains = contains || strings.Contains(line, pattern)
+			hasPrefix = hasPrefix || strings.HasPrefix(line, pattern)
+		}
+		assert.Equal(t, contains, substrings.MatchString(line), line)
+		assert.Equal(t, hasPrefix, prefixes.MatchString(line), line)
+	}
+
+	// Patterns found by failing over from a longer one that didn't pan out
+	ac := newAhoCorasick([]string{"abcd", "bc"}, false)
+	assert.True(t, ac.MatchString("abcx"))
+	assert.False(t, ac.MatchString("abx"))
+}
@@ -0,0 +1,84 @@
+package main
+
+import "errors"
+
+// The states a collector's log volume can be in, with respect to its anomaly config.
+// The empty string means the volume looks normal.
+const (
+	VolumeQuiet     = "quiet"
+	VolumeExplosion = "explosion"
+)
+
+// Defaults for the anomaly detector
+const (
+	DefaultAnomalyAlpha  = 0.1
+	DefaultAnomalyFactor = 3
+	DefaultAnomalyWarmup = 10
+)
+
+// volumeDetector learns a baseline for how many lines per second a collector sees, as an
+// exponentially weighted moving average of the rate over every window, and notices when the
+// rate strays more than factor times above or below it. It's the timeout idea applied to
+// volume: a service that usually logs a hundred lines a second and drops to two is probably
+// in as much trouble as one that's stopped logging, and so is one that jumps to ten thousand.
+type volumeDetector struct {
+	// How much weight the latest window gets in the baseline
+	alpha  float64
+	factor float64
+	// How many windows to learn from before judging any of them
+	warmup int
+
+	baseline float64
+	windows  int
+	state    string
+}
+
+func newVolumeDetector(config AnomalyConfig) (*volumeDetector, error) {
+	detector := &volumeDetector{
+		alpha:  config.Alpha,
+		factor: config.Factor,
+		warmup: config.Warmup,
+	}
+	if detector.alpha == 0 {
+		detector.alpha = DefaultAnomalyAlpha
+	}
+	if detector.factor == 0 {
+		detector.factor = DefaultAnomalyFactor
+	}
+	if detector.warmup == 0 {
+		detector.warmup = DefaultAnomalyWarmup
+	}
+
+	if detector.alpha <= 0 || detector.alpha > 1 {
+		return nil, errors.New("The anomaly alpha has to be between 0 and 1")
+	}
+	if detector.factor <= 1 {
+		return nil, errors.New("The anomaly factor has to be more than 1")
+	}
+	return detector, nil
+}
+
+// observe takes the rate over the latest window and returns the state it puts the volume
+// in, along with whether that's a change. Every window goes into the baseline, anomalous or
+// not, so a lasting change in volume eventually becomes the new normal.
+func (detector *volumeDetector) observe(rate float64) (string, bool) {
+	detector.windows++
+	if detector.windows == 1 {
+		detector.baseline = rate
+	}
+
+	state := ""
+	if detector.windows > detector.warmup {
+		switch {
+		case rate > detector.baseline*detector.factor && rate > 0:
+			state = VolumeExplosion
+		case rate < detector.baseline/detector.factor:
+			state = VolumeQuiet
+		}
+	}
+	detector.baseline = detector.alpha*rate + (1-detector.alpha)*detector.baseline
+
+	changed := state != detector.state
+	detector.state = state
+	return state, changed
+}
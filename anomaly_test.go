@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVolumeDetector(t *testing.T) {
+	detector, err := newVolumeDetector(AnomalyConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultAnomalyAlpha, detector.alpha)
+
+	_, err = newVolumeDetector(AnomalyConfig{Alpha: 1.5})
+	assert.NotNil(t, err)
+	_, err = newVolumeDetector(AnomalyConfig{Factor: 0.5})
+	assert.NotNil(t, err)
+}
+
+func TestVolumeDetector(t *testing.T) {
+	detector, err := newVolumeDetector(AnomalyConfig{Alpha: 0.5, Factor: 2, Warmup: 3})
+	assert.Nil(t, err)
+
+	// Nothing is judged while warming up
+	for _, rate := range []float64{100, 1000, 100} {
+		state, changed := detector.observe(rate)
+		assert.Equal(t, "", state)
+		assert.False(t, changed)
+	}
+	assert.Equal(t, 325.0, detector.baseline)
+
+	state, changed := detector.observe(400)
+	assert.Equal(t, "", state)
+	assert.False(t, changed)
+
+	state, changed = detector.observe(2000)
+	assert.Equal(t, VolumeExplosion, state)
+	assert.True(t, changed)
+
+	// Still an explosion, so nothing new
+	state, changed = detector.observe(5000)
+	assert.Equal(t, VolumeExplosion, state)
+	assert.False(t, changed)
+
+	state, changed = detector.observe(0)
+	assert.Equal(t, VolumeQuiet, state)
+	assert.True(t, changed)
+
+	// Back to normal, the baseline has come down to meet it
+	state, changed = detector.observe(1000)
+	assert.Equal(t, "", state)
+	assert.True(t, changed)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// After an incident it has to be possible to prove which remediations ran and when, which
+// the log doesn't do well once it's been rotated away. --audit-log appends a JSON line to a
+// file for every command that's run: the collector and its labels, what set it off, the
+// command, when it started and finished and how it went. The file is only ever appended to
+// and synced after every line, so a crash can't lose the record of a command that already
+// ran.
+//
+// Programs' output, stdout and stderr together, is recorded too so that whoever looks into
+// an incident can see what a restart script said without going to the host. Only the last
+// maxAuditOutput bytes are kept, and output going to a file isn't recorded as the file
+// already has it.
+//
+// Commands that never start, because they're cooling down, were dropped for being over
+// max_running_commands or execution is disabled, aren't recorded. Ones that fail to start
+// are, with their error.
+
+// auditRecord is a line of the audit log
+type auditRecord struct {
+	Collector string            `json:"collector"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Trigger   string            `json:"trigger"`
+	Command   string            `json:"command"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	// Only set for programs, -1 if it was killed by a signal
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// What a program wrote to stdout and stderr, its end if there was too much
+	Output string `json:"output,omitempty"`
+}
+
+// maxAuditOutput is how much of a program's output is kept for the audit log
+const maxAuditOutput = 4096
+
+// auditTruncated starts the output of a program that wrote more than we kept
+const auditTruncated = "[truncated] "
+
+// outputCapture keeps the last limit bytes written to it. Programs' stdout and stderr are
+// copied to it by separate goroutines unless they share a writer, hence the mutex.
+type outputCapture struct {
+	limit int
+
+	mutex     sync.Mutex
+	output    []byte
+	truncated bool
+
+	// Closed once everything's been read from the pipe given to readFrom, nil without one
+	copied chan struct{}
+}
+
+func newOutputCapture(limit int) *outputCapture {
+	return &outputCapture{limit: limit}
+}
+
+func (capture *outputCapture) Write(output []byte) (int, error) {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	capture.output = append(capture.output, output...)
+	if excess := len(capture.output) - capture.limit; excess > 0 {
+		capture.output = append(capture.output[:0], capture.output[excess:]...)
+		capture.truncated = true
+	}
+	return len(output), nil
+}
+
+// readFrom keeps what's read from a pipe in the background, until every process writing to
+// it has closed it
+func (capture *outputCapture) readFrom(reader *os.File) {
+	capture.copied = make(chan struct{})
+	go func() {
+		io.Copy(capture, reader)
+		reader.Close()
+		close(capture.copied)
+	}()
+}
+
+// wait gives the output still being read from a pipe up to commandWaitDelay to arrive, after
+// which we carry on without whatever a process holding it open writes
+func (capture *outputCapture) wait() {
+	if capture == nil || capture.copied == nil {
+		return
+	}
+	select {
+	case <-capture.copied:
+	case <-time.After(commandWaitDelay):
+	}
+}
+
+// String returns what was kept, empty for a nil outputCapture
+func (capture *outputCapture) String() string {
+	if capture == nil {
+		return ""
+	}
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	if capture.truncated {
+		return auditTruncated + string(capture.output)
+	}
+	return string(capture.output)
+}
+
+// AuditLog appends auditRecords to a file. A nil AuditLog records nothing.
+type AuditLog struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// OpenAuditLog opens the audit log at path, creating it if it doesn't exist
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Record appends a record, logging rather than returning any error since there's nothing a
+// command's caller could do about it
+func (audit *AuditLog) Record(record auditRecord) {
+	if audit == nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		logp.Err("Unable to write to the audit log: %s", err)
+		return
+	}
+
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	// Commands still running when we stop finish after the log is closed
+	if audit.file == nil {
+		logp.Warn("The audit log is closed, unable to record %s command %s", record.Trigger, record.Command)
+		return
+	}
+	if _, err := audit.file.Write(append(line, '\n')); err != nil {
+		logp.Err("Unable to write to the audit log: %s", err)
+		return
+	}
+	if err := audit.file.Sync(); err != nil {
+		logp.Err("Unable to sync the audit log: %s", err)
+	}
+}
+
+// Close closes the audit log
+func (audit *AuditLog) Close() error {
+	if audit == nil {
+		return nil
+	}
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	if audit.file == nil {
+		return nil
+	}
+	err := audit.file.Close()
+	audit.file = nil
+	return err
+}
+
+// audit records a command that ran, or couldn't be started, in the audit log
+func (collector *Collector) audit(action string, command CommandConfig, start time.Time, err error) {
+	if collector.auditLog == nil {
+		return
+	}
+	record := auditRecord{
+		Collector: collector.config.Name,
+		Labels:    collector.config.Labels,
+		Trigger:   action,
+		Command:   command.String(),
+		Start:     start,
+		End:       time.Now(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if command.Program != "" {
+		record.ExitCode = exitCode(err)
+		command.capture.wait()
+		record.Output = command.capture.String()
+	}
+	collector.auditLog.Record(record)
+}
+
+// exitCode is the exit code of a program that exited with err, nil if it never ran
+func exitCode(err error) *int {
+	code := 0
+	if err != nil {
+		if timedOut, ok := err.(*commandTimedOut); ok {
+			err = timedOut.err
+		}
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil
+		}
+		// -1 for a program killed by a signal
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		if !ok {
+			return nil
+		}
+		code = status.ExitStatus()
+	}
+	return &code
+}
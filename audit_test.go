@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "audit.log")
+	auditLog, err := OpenAuditLog(path)
+	assert.Nil(t, err)
+
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   make(chan time.Time),
+		statsRequests:    make(chan chan CollectorStats),
+		finishedCommands: make(chan commandDuration),
+		auditLog:         auditLog,
+
+		config: CollectorConfig{
+			Name:   "payments",
+			Labels: map[string]string{"team": "billing"},
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", "echo restarting; echo failed >&2; exit 3"},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+	close(collector.Done)
+	<-collector.Stopped
+	assert.Nil(t, auditLog.Close())
+
+	// Recording after closing does nothing
+	auditLog.Record(auditRecord{Collector: "late"})
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+
+	assert.Equal(t, 1, len(records))
+	record := records[0]
+	assert.Equal(t, "payments", record.Collector)
+	assert.Equal(t, map[string]string{"team": "billing"}, record.Labels)
+	assert.Equal(t, MatchAction, record.Trigger)
+	assert.Equal(t, "sh -c echo restarting; echo failed >&2; exit 3", record.Command)
+	assert.Equal(t, 3, *record.ExitCode)
+	assert.Equal(t, "restarting\nfailed\n", record.Output)
+	assert.NotEqual(t, "", record.Error)
+	assert.False(t, record.End.Before(record.Start))
+}
+
+func TestOutputCapture(t *testing.T) {
+	var none *outputCapture
+	assert.Equal(t, "", none.String())
+
+	capture := newOutputCapture(10)
+	capture.Write([]byte("hello\n"))
+	assert.Equal(t, "hello\n", capture.String())
+
+	// Only the end of too much output is kept
+	capture.Write([]byte("error: it broke\n"))
+	assert.Equal(t, auditTruncated+" it broke\n", capture.String())
+	assert.Equal(t, auditTruncated+" it broke\n", capture.String())
+}
+
+func TestOutputCaptureHeldOpen(t *testing.T) {
+	// The background sleep keeps the output open after the shell exits, which mustn't keep
+	// us waiting on it
+	command := CommandConfig{Program: "sh", Args: []string{"-c", "echo started; sleep 5 &"}}
+	command.capture = newOutputCapture(maxAuditOutput)
+	cmd, err := command.Start(nil)
+	assert.Nil(t, err)
+	start := time.Now()
+	assert.Nil(t, waitForOutput(cmd))
+	assert.True(t, time.Since(start) < commandWaitDelay)
+
+	command.capture.wait()
+	assert.True(t, time.Since(start) < 2*commandWaitDelay)
+	assert.Equal(t, "started\n", command.capture.String())
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, *exitCode(nil))
+	assert.Nil(t, exitCode(errors.New("not found")))
+
+	cmd := exec.Command("sleep", "5")
+	assert.Nil(t, cmd.Start())
+	err := waitWithTimeout(cmd, 10*time.Millisecond)()
+	assert.Equal(t, -1, *exitCode(err))
+
+	// A nil AuditLog records nothing
+	var audit *AuditLog
+	audit.Record(auditRecord{})
+	assert.Nil(t, audit.Close())
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Instead of a program any command can publish to an "sns" topic or invoke a "lambda"
+// function, to plug into alerting that already lives in AWS. Either way what's sent is the
+// PulseEvent of pulse.proto as JSON. Credentials are found the way the AWS CLI finds them:
+// the environment, ~/.aws, then the instance or task role.
+//
+// A Lambda function is invoked synchronously unless it's async, so the command fails if
+// the function does; an async invocation only fails if Lambda won't queue it.
+
+// awsTimeout is how long a call gets unless the command has a timeout
+const awsTimeout = 10 * time.Second
+
+var (
+	// Shared by every command so credentials are only looked up once
+	awsSession      *session.Session
+	awsSessionErr   error
+	awsSessionMutex sync.Mutex
+)
+
+// validateAWS checks a command's sns topic or lambda function
+func validateAWS(command CommandConfig) error {
+	if command.SNS.TopicARN == "" && (command.SNS.Subject != "" || command.SNS.Region != "") {
+		return errors.New("An sns command needs a topic_arn")
+	}
+	if command.Lambda.Function == "" && (command.Lambda.Async || command.Lambda.Region != "") {
+		return errors.New("A lambda command needs a function")
+	}
+	if command.SNS.TopicARN == "" && command.Lambda.Function == "" {
+		return nil
+	}
+	if len(command.kinds()) > 1 {
+		return fmt.Errorf("An AWS command can't do anything else, %s does", command)
+	}
+	if command.SNS.TopicARN != "" && arnRegion(command.SNS.TopicARN) == "" {
+		return fmt.Errorf("%q isn't an SNS topic ARN", command.SNS.TopicARN)
+	}
+	// SNS rejects subjects over 100 characters or with line breaks
+	if len(command.SNS.Subject) > 100 || strings.ContainsAny(command.SNS.Subject, "\r\n") {
+		return errors.New("An sns subject has to be a single line of at most 100 characters")
+	}
+	return nil
+}
+
+// arnRegion returns the region of an ARN, or "" if it isn't one
+func arnRegion(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[3]
+}
+
+// awsConfig is the client config for a region, which if empty is the ARN's, and failing that
+// whatever the usual AWS settings say
+func awsConfig(region string, arn string) *aws.Config {
+	if region == "" {
+		region = arnRegion(arn)
+	}
+	config := aws.NewConfig()
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+	return config
+}
+
+// sharedAWSSession returns the session every AWS command shares, creating it the first time
+func sharedAWSSession() (*session.Session, error) {
+	awsSessionMutex.Lock()
+	defer awsSessionMutex.Unlock()
+	if awsSession == nil && awsSessionErr == nil {
+		awsSession, awsSessionErr = session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	}
+	return awsSession, awsSessionErr
+}
+
+// Start publishes the event, returning a function waiting for SNS to accept it
+func (config SNSConfig) Start(event pulseEvent, timeout time.Duration) (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not publishing to %s", config.TopicARN)
+		return nil, ErrExecDisabled
+	}
+	sess, err := sharedAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	message, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = awsTimeout
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(config.TopicARN),
+		Message:  aws.String(string(message)),
+	}
+	if config.Subject != "" {
+		input.Subject = aws.String(config.Subject)
+	}
+
+	logp.Info("Publishing to %s", config.TopicARN)
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := sns.New(sess, awsConfig(config.Region, config.TopicARN)).PublishWithContext(ctx, input)
+		return err
+	}, nil
+}
+
+// Start invokes the function, returning a function waiting for it to return, or just for
+// Lambda to accept it if it's async
+func (config LambdaConfig) Start(event pulseEvent, timeout time.Duration) (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not invoking %s", config.Function)
+		return nil, ErrExecDisabled
+	}
+	sess, err := sharedAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = awsTimeout
+	}
+
+	invocation := lambda.InvocationTypeRequestResponse
+	if config.Async {
+		invocation = lambda.InvocationTypeEvent
+	}
+	input := &lambda.InvokeInput{
+		FunctionName:   aws.String(config.Function),
+		InvocationType: aws.String(invocation),
+		Payload:        payload,
+	}
+
+	logp.Info("Invoking %s", config.Function)
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		output, err := lambda.New(sess, awsConfig(config.Region, config.Function)).InvokeWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		// The invocation can succeed with the function itself failing
+		if output.FunctionError != nil {
+			return fmt.Errorf("%s failed (%s): %s", config.Function, aws.StringValue(output.FunctionError), output.Payload)
+		}
+		return nil
+	}, nil
+}
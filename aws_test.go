@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAWS(t *testing.T) {
+	topic := "arn:aws:sns:eu-west-1:123456789012:alerts"
+	assert.Nil(t, validateAWS(CommandConfig{Program: "touch"}))
+	assert.Nil(t, validateAWS(CommandConfig{SNS: SNSConfig{TopicARN: topic, Subject: "Payments are failing"}}))
+	assert.Nil(t, validateAWS(CommandConfig{Lambda: LambdaConfig{Function: "remediate", Async: true}}))
+
+	assert.NotNil(t, validateAWS(CommandConfig{SNS: SNSConfig{Subject: "No topic"}}))
+	assert.NotNil(t, validateAWS(CommandConfig{Lambda: LambdaConfig{Async: true}}))
+	assert.NotNil(t, validateAWS(CommandConfig{SNS: SNSConfig{TopicARN: "alerts"}}))
+	assert.NotNil(t, validateAWS(CommandConfig{SNS: SNSConfig{TopicARN: topic, Subject: "Two\nlines"}}))
+	assert.NotNil(t, validateAWS(CommandConfig{SNS: SNSConfig{TopicARN: topic}, Lambda: LambdaConfig{Function: "remediate"}}))
+}
+
+func TestARNRegion(t *testing.T) {
+	assert.Equal(t, "eu-west-1", arnRegion("arn:aws:sns:eu-west-1:123456789012:alerts"))
+	assert.Equal(t, "us-east-1", arnRegion("arn:aws:lambda:us-east-1:123456789012:function:remediate"))
+	assert.Equal(t, "", arnRegion("remediate"))
+}
+
+func TestPulseEventJSON(t *testing.T) {
+	event := pulseEvent{
+		Collector: "payments",
+		Type:      MatchAction,
+		Line:      "ERROR card declined",
+		Groups:    map[string]string{"code": "declined"},
+		Time:      time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC),
+	}
+	payload, err := json.Marshal(event)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"collector":"payments","type":"match","line":"ERROR card declined","groups":{"code":"declined"},"time":"2017-08-01T12:00:00Z"}`, string(payload))
+}
+
+func TestCommandKinds(t *testing.T) {
+	assert.Equal(t, []string{"lambda"}, CommandConfig{Lambda: LambdaConfig{Function: "remediate"}}.kinds())
+	assert.Equal(t, []string{"program", FileTouch}, CommandConfig{Program: "true", Touch: "/tmp/flag"}.kinds())
+	assert.False(t, CommandConfig{Dir: "/tmp"}.configured())
+}
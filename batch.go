@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Starting a process for every matching line is far too heavy at high match rates. A
+// collector's "batch" collects its matching lines instead and runs its command with all of
+// them on its stdin, one per line, every interval or as soon as max_lines have piled up,
+// whichever comes first. Nothing is run for an interval without matches. Lines still
+// waiting when the collector stops are sent off as a last batch.
+
+// validateBatch checks a collector's batch configuration
+func validateBatch(config BatchConfig) error {
+	if config.Interval < 0 || config.MaxLines < 0 {
+		return errors.New("A batch's interval and max_lines can't be negative")
+	}
+	if config.Command.configured() && config.Interval == 0 && config.MaxLines == 0 {
+		return errors.New("A batch needs an interval, max_lines or both")
+	}
+	return nil
+}
+
+// addToBatch adds a matching line to the batch, sending it off if it's full
+func (collector *Collector) addToBatch(line string) {
+	collector.batch = append(collector.batch, line)
+	if collector.config.Batch.MaxLines > 0 && len(collector.batch) >= collector.config.Batch.MaxLines {
+		collector.flushBatch()
+	}
+}
+
+// flushBatch runs the batch command with the lines collected so far
+func (collector *Collector) flushBatch() {
+	if len(collector.batch) == 0 {
+		return
+	}
+	lines := collector.batch
+	collector.batch = nil
+
+	logp.Info("Running batch command with %d lines...", len(lines))
+	command := collector.config.Batch.Command
+	command.stdin = strings.Join(lines, "\n") + "\n"
+	env := append(collector.environment(nil), "LOGPULSE_COUNT="+strconv.Itoa(len(lines)))
+	collector.runCommand(BatchAction, command, commandData{Collector: collector.config.Name, Count: len(lines)}, env)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBatch(t *testing.T) {
+	assert.Nil(t, validateBatch(BatchConfig{}))
+	assert.Nil(t, validateBatch(BatchConfig{MaxLines: 10, Command: CommandConfig{Program: "cat"}}))
+	assert.NotNil(t, validateBatch(BatchConfig{Command: CommandConfig{Program: "cat"}}))
+	assert.NotNil(t, validateBatch(BatchConfig{Interval: -time.Second, Command: CommandConfig{Program: "cat"}}))
+}
+
+func TestCollectorProcessBatch(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	batchChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+		batchChannel:   batchChannel,
+
+		config: CollectorConfig{
+			Batch: BatchConfig{
+				Interval: time.Minute,
+				MaxLines: 3,
+				Command: CommandConfig{
+					Program: "sh",
+					Args:    []string{"-c", `(echo "batch of $LOGPULSE_COUNT"; cat) >> ` + outputFile},
+				},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	read := func() string {
+		time.Sleep(50 * time.Millisecond)
+		output, _ := ioutil.ReadFile(outputFile)
+		return string(output)
+	}
+
+	go collector.process()
+	// Sent off once it's full
+	for _, line := range []string{"Match 1", "Other", "Match 2", "Match 3", "Match 4"} {
+		collector.lines <- line
+	}
+	assert.Equal(t, "batch of 3\nMatch 1\nMatch 2\nMatch 3\n", read())
+
+	// Or on the interval
+	batchChannel <- time.Now()
+	assert.Equal(t, "batch of 3\nMatch 1\nMatch 2\nMatch 3\nbatch of 1\nMatch 4\n", read())
+
+	// Empty intervals run nothing
+	batchChannel <- time.Now()
+	assert.Equal(t, "batch of 3\nMatch 1\nMatch 2\nMatch 3\nbatch of 1\nMatch 4\n", read())
+
+	close(collector.Done)
+	<-collector.Stopped
+}
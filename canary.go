@@ -0,0 +1,30 @@
+package main
+
+import "github.com/elastic/beats/libbeat/logp"
+
+// A collector with "canary: true" runs in observe-only mode: it matches lines, keeps its
+// timeouts, thresholds and stats and so on exactly like any other collector, but instead of
+// running its commands it logs them. Run next to the collector it's meant to replace, it
+// shows what a new pattern or set of rules would have done before it's trusted to do it.
+// With a canary_for it's promoted to running its commands once that long has passed,
+// otherwise it stays a canary until the configuration changes.
+//
+// --dry-run makes every collector a canary that's never promoted, whatever its config says.
+// File outputs aren't written to either, and how many commands each collector would have run
+// is logged when it stops.
+
+// promote ends a collector's canary period, logging how often it would have fired
+func (collector *Collector) promote() {
+	logp.Info("Canary collector %s would have run %d commands in %s, promoting it to run them from now on",
+		collector.config.Name, collector.canaryFirings, collector.config.CanaryFor)
+	collector.canary = false
+	collector.canaryChannel = nil
+}
+
+// observer names the collector in messages about what it would have done
+func (collector *Collector) observer() string {
+	if DryRun {
+		return "Dry run collector " + collector.config.Name
+	}
+	return "Canary collector " + collector.config.Name
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorProcessCanary(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+	canaryChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+		canary:         true,
+		canaryChannel:  canaryChannel,
+
+		config: CollectorConfig{
+			Canary:    true,
+			CanaryFor: time.Hour,
+			Command: CommandConfig{
+				Program: "touch",
+				Args:    []string{touchedFile},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	// While it's a canary matches are only counted
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(10 * time.Millisecond)
+	assertFileDoesNotExist(t, touchedFile)
+
+	// Once promoted the command runs
+	canaryChannel <- time.Now()
+	collector.lines <- "Match"
+	time.Sleep(10 * time.Millisecond)
+	assertFileExists(t, touchedFile)
+
+	close(collector.Done)
+	<-collector.Stopped
+	assert.Equal(t, 2, collector.canaryFirings)
+	assert.False(t, collector.canary)
+}
+
+func TestCanaryForValidation(t *testing.T) {
+	_, err := newCollector(CollectorConfig{Pattern: "a", CanaryFor: time.Hour})
+	assert.NotNil(t, err)
+
+	_, err = newCollector(CollectorConfig{Pattern: "a", Canary: true, CanaryFor: -time.Hour})
+	assert.NotNil(t, err)
+
+	_, err = newCollector(CollectorConfig{Pattern: "a", Canary: true, CanaryFor: time.Hour})
+	assert.Nil(t, err)
+}
+
+func TestCanaryObserver(t *testing.T) {
+	collector := Collector{config: CollectorConfig{Name: "payments"}}
+	assert.Equal(t, "Canary collector payments", collector.observer())
+
+	DryRun = true
+	defer func() { DryRun = false }()
+	assert.Equal(t, "Dry run collector payments", collector.observer())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policies for what a collector does when the system clock jumps (timeout.clock_jump).
+// Our timeouts are counted with Go's monotonic clock so NTP steps or someone running
+// "date -s" never make them fire early or late, but a big jump often means something
+// happened that the collector should know about, like the machine being suspended.
+const (
+	// ClockJumpIgnore keeps counting the timeout as if nothing happened (the default)
+	ClockJumpIgnore = "ignore"
+	// ClockJumpReset restarts the timeout from the moment the jump was noticed
+	ClockJumpReset = "reset"
+	// ClockJumpFire times out straight away
+	ClockJumpFire = "fire"
+)
+
+// DefaultClockJumpThreshold is how far the wall clock has to drift from the monotonic clock
+// before we consider it a jump
+const DefaultClockJumpThreshold = 30 * time.Second
+
+// clockCheckInterval is how often we compare the wall clock against the monotonic clock
+const clockCheckInterval = 1 * time.Second
+
+// validateClockJump makes sure a clock_jump policy is one we know about
+func validateClockJump(policy string) error {
+	switch policy {
+	case "", ClockJumpIgnore, ClockJumpReset, ClockJumpFire:
+		return nil
+	}
+	return fmt.Errorf("Unknown clock_jump policy %s, expected one of %s, %s or %s",
+		policy, ClockJumpIgnore, ClockJumpReset, ClockJumpFire)
+}
+
+// watchClock compares how much time has passed on the wall clock against the monotonic clock
+// every interval and sends the difference on jumps whenever it's more than threshold.
+// It runs until done is closed.
+func watchClock(interval, threshold time.Duration, jumps chan<- time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		now := time.Now()
+		jump := clockJump(previous, now)
+		previous = now
+
+		if jump > threshold || jump < -threshold {
+			select {
+			case jumps <- jump:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// clockJump returns how much further the wall clock moved between two readings than the
+// monotonic clock did. Round(0) strips the monotonic reading so Sub falls back to wall time.
+func clockJump(previous, now time.Time) time.Duration {
+	wall := now.Round(0).Sub(previous.Round(0))
+	monotonic := now.Sub(previous)
+	return wall - monotonic
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateClockJump(t *testing.T) {
+	for _, policy := range []string{"", ClockJumpIgnore, ClockJumpReset, ClockJumpFire} {
+		assert.Nil(t, validateClockJump(policy))
+	}
+	assert.NotNil(t, validateClockJump("panic"))
+}
+
+func TestClockJump(t *testing.T) {
+	// Readings that moved together aren't a jump
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), clockJump(now, now.Add(5*time.Second)))
+
+	// Without monotonic readings there's nothing to compare against
+	assert.Equal(t, time.Duration(0), clockJump(now.Round(0), now.Round(0).Add(5*time.Second)))
+}
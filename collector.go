@@ -2,7 +2,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +19,19 @@ import (
 	"github.com/elastic/beats/libbeat/logp"
 )
 
+// Input is the part of a Collector that actually gathers lines. FileBeat's Prospector
+// already fits the bill, this just lets us slot in our own inputs alongside it.
+type Input interface {
+	Start()
+	Stop()
+}
+
+// releaser is implemented by inputs that hold on to resources, like a socket, from the
+// moment they're created. Release frees them for an input that will never be started.
+type releaser interface {
+	Release()
+}
+
 // Collector in our program is really just going to be a glorified wrapper
 // around a FileBeat Prospector. Mostly because I don't the name is very
 // good. We'll be using FileBeat's Prospectors and Harvestors to pool input
@@ -24,14 +42,23 @@ type Collector struct {
 	// Holds our platform specific configuration
 	config CollectorConfig
 
-	// The FileBeat object that will actually be doing the collecting
-	prospector *prospector.Prospector
+	// The object that will actually be doing the collecting. For most collectors this is
+	// a FileBeat Prospector
+	input Input
 	// Will be triggered with a close when the Prospector's "Stop" is called.
 	// This trigger will happen *before* the Prospector waits for its WaitGroup, that
 	// is signified by Prospector.Stop returning
 	prospectorDone chan struct{}
 
-	Pattern *regexp.Regexp
+	// Lines have to match Pattern to count. It's a *regexp.Regexp unless the collector's
+	// match_type says otherwise.
+	Pattern Matcher
+	// Lines matching ExcludePattern are ignored even if they match Pattern. It's nil if no
+	// exclude_pattern was configured.
+	ExcludePattern Matcher
+	// Condition further filters matching lines based on the named groups captured by Pattern.
+	// It's nil if no condition was configured.
+	Condition *Condition
 
 	// lines is the main channel that the CollecturOutleter will send incoming log lines
 	// to for processing. We could send over the entire beat.Event but for now that would
@@ -39,65 +66,527 @@ type Collector struct {
 	// concerned about the message and will be hoping we're reactive enough to be processing
 	// things in near real-time
 	lines chan string
+	// Lines from FileBeat come through here instead, along with the file they're from
+	fileLines chan fileLine
 
 	// Done is our internal signal to notify ourselves when our Collector processing logic
 	// should start shutting down.
 	Done chan struct{}
 	// Stopped is used to notify when the collector has successfully stopped.
 	Stopped chan struct{}
+	// Healthy is closed the first time the collector sees a line matching its pattern.
+	// Collectors that depend on this one wait for it before starting.
+	Healthy chan struct{}
+
+	// Used to track our timeout process, see timeout.go. The timer is nil without a timeout.
+	timeoutChannel  <-chan time.Time
+	timeoutTimer    *time.Timer
+	timeoutDeadline time.Time
+	// How long timeout.jitter can hold a timeout back
+	timeoutJitter jitterSetting
+	// The intervals of timeout.schedule, empty if it has none
+	timeoutSchedule []scheduledInterval
+	// When timeout.maintenance says timeouts should be ignored, nil if it has none
+	maintenance *maintenanceCalendar
+	// Set until the first match with arm_on_first_match, the timeout not counting before then
+	awaitingFirstMatch bool
+	// Our timeout tiers and the timer for the next one due, see tiers.go. The channel is nil
+	// without tiers.
+	tiers       []timeoutTier
+	tierChannel <-chan time.Time
+	tierTimer   *time.Timer
+	// What we'll use for keeping track of Timeout.Once, so that a command only executes once
+	// between pattern matches and not at an interval
+	timedOutOnce bool
+	// Set when the timeout or one of its tiers fires, until the next match runs the recovery
+	// command
+	recoveryPending bool
+	// How many times the timeout command has run since the last match, for max_firings
+	timeoutFirings int
+	// Set once the match command has run, for match_once. Cleared by a timeout.
+	latched bool
+	// How many intervals in a row have gone by without a match
+	missedBeats int
+	// How many matches have come in towards timeout.min_matches
+	intervalMatches int
+	// When the matches within the threshold window happened
+	recentMatches []time.Time
+	// How far we are towards letting the next line through, for sample_rate
+	sampleCredit float64
+	// Used to measure our match rate, the channel is nil when no rate is configured
+	rateChannel <-chan time.Time
+	rateTicker  *time.Ticker
+	rateCount   int
+	rateState   string
+	// Used to report our match count every report interval, the channel is nil when no
+	// report is configured
+	reportChannel <-chan time.Time
+	reportTicker  *time.Ticker
+	reportCount   int
+	// The matching lines waiting to be sent to the batch command, the channel is nil when
+	// the batch has no interval
+	batch        []string
+	batchChannel <-chan time.Time
+	batchTicker  *time.Ticker
+	// Used to watch our log volume, the detector and channel are nil when no anomaly
+	// detection is configured
+	anomaly        *volumeDetector
+	anomalyChannel <-chan time.Time
+	anomalyTicker  *time.Ticker
+	lineCount      int
+	// Receives the size of any clock jump we notice, if the timeout has a clock_jump policy
+	clockJumps chan time.Duration
+	// Receives a grace period whenever the Collection notices the host resuming from suspend
+	resumed chan time.Duration
+	// Timeouts before this time are ignored
+	suppressTimeoutsUntil time.Time
+	// Timeouts outside these are ignored too, nil if the timeout is always active. See
+	// activehours.go.
+	activeHours *activeHours
+	// Our start/end sequence, if one is configured
+	sequence *sequence
+	// Reads the time out of our lines, if a timestamp is configured, for our event clock.
+	// eventNow is the latest time we've seen and eventTimeoutBase where the current timeout
+	// interval started.
+	timestamp        *timestampParser
+	eventNow         time.Time
+	eventTimeoutBase time.Time
+	// Used to check our pattern_file for changes, the channel is nil without one
+	patternFileChannel <-chan time.Time
+	patternFileTicker  *time.Ticker
+	patternFileModTime time.Time
+	// While canary is set our commands are only logged, see canary.go. The channel fires
+	// once canary_for is up and is nil without one.
+	canary        bool
+	canaryChannel <-chan time.Time
+	canaryTimer   *time.Timer
+	canaryFirings int
+
+	// Keeps our per line log messages from flooding the log on busy collectors
+	logLimiter *logLimiter
 
-	// Used to track our timeout process
-	timeoutChannel <-chan time.Time
-	ticker         *time.Ticker
+	// When we see our matches and how long our commands take, see Stats
+	stats         CollectorStats
+	statsRequests chan chan CollectorStats
+	// Control requests from the control socket, see control.go
+	controls         chan controlRequest
+	finishedCommands chan commandDuration
+	// Asks the Collection to save our stats now rather than at its next interval
+	statsChanged chan<- struct{}
+	// Asks the Collection to exit with a code, only set with exit_on_match
+	exits chan<- int
+
+	// Holds back the match command until the matches stop coming, see debounce.go
+	debounceTimer   *time.Timer
+	debounceChannel <-chan time.Time
+	pending         *pendingMatch
+
+	// Where our matching lines are written, if anywhere
+	fileOutput *fileOutput
+
+	// The lines around our matches, nil without a context. See context.go.
+	context        *lineContext
+	contextTimer   *time.Timer
+	contextChannel <-chan time.Time
+
+	// Cap how many of our commands run at once, our own max_running_commands and the one
+	// shared by every collector. See limit.go.
+	commandSlots       chan struct{}
+	sharedCommandSlots chan struct{}
+	// Where the commands we run are recorded, nil for nowhere. See audit.go.
+	auditLog *AuditLog
+
+	// What we were created from, to tell whether a reload changed us, and the states of the
+	// files we read, to carry on from there if it did. See reload.go.
+	rawConfig  *common.Config
+	fileStates *fileStates
 }
 
 // NewCollector initializes a new Collector object along with its associated communication
 // channels
 func NewCollector(config CollectorConfig, rawConfig *common.Config) (*Collector, error) {
+	return buildCollector(config, rawConfig, []file.State{})
+}
 
-	// Compile the configured pattern
-	pattern, err := regexp.Compile(config.Pattern)
+// buildCollector is NewCollector for a collector whose files, if it reads any, are picked up
+// from states rather than read afresh
+func buildCollector(config CollectorConfig, rawConfig *common.Config, states []file.State) (*Collector, error) {
+	collector, err := newCollector(config)
 	if err != nil {
-		logp.Warn("Unable to parse regular expression: %s", err)
 		return nil, err
 	}
+	config = collector.config
+	collector.rawConfig = rawConfig
 
-	// Create our Collector with its channel signals
-	collector := Collector{
-		Pattern: pattern,
-		config:  config,
+	if config.Rate.Window > 0 {
+		collector.rateTicker = time.NewTicker(config.Rate.Window)
+		collector.rateChannel = collector.rateTicker.C
+	}
 
-		prospectorDone: make(chan struct{}),
-		lines:          make(chan string),
-		Done:           make(chan struct{}),
-		Stopped:        make(chan struct{}),
+	if config.Anomaly.Window > 0 {
+		collector.anomaly, err = newVolumeDetector(config.Anomaly)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid anomaly detector: %s", config.Name, err)
+			collector.stopTimers()
+			return nil, err
+		}
+		collector.anomalyTicker = time.NewTicker(config.Anomaly.Window)
+		collector.anomalyChannel = collector.anomalyTicker.C
+	}
+
+	if config.Report.Interval > 0 {
+		collector.reportTicker = time.NewTicker(config.Report.Interval)
+		collector.reportChannel = collector.reportTicker.C
+	}
+
+	if config.Batch.Interval > 0 && config.Batch.Command.configured() {
+		collector.batchTicker = time.NewTicker(config.Batch.Interval)
+		collector.batchChannel = collector.batchTicker.C
+	}
+
+	if config.PatternFile != "" {
+		collector.patternFileTicker = time.NewTicker(patternFileCheckInterval)
+		collector.patternFileChannel = collector.patternFileTicker.C
+	}
+
+	if config.Canary || DryRun {
+		collector.canary = true
+		if config.CanaryFor > 0 && !DryRun {
+			collector.canaryTimer = time.NewTimer(config.CanaryFor)
+			collector.canaryChannel = collector.canaryTimer.C
+		}
+	}
+
+	if config.Timeout.ClockJump != "" && config.Timeout.ClockJump != ClockJumpIgnore {
+		collector.clockJumps = make(chan time.Duration)
 	}
 
-	// Initialize our ticker for handling timeouts
+	// Initialize our timer for handling timeouts
 	if config.Timeout.Interval > 0 {
-		// If a timeout is set then create a new ticker and save wrap its channel with a variable
-		collector.ticker = time.NewTicker(config.Timeout.Interval)
-		collector.timeoutChannel = collector.ticker.C
+		// If a timeout is set then create a new timer and save wrap its channel with a variable
+		interval := collector.interval(time.Now())
+		collector.timeoutDeadline = time.Now().Add(interval)
+		collector.timeoutTimer = time.NewTimer(interval + collector.jitter(interval))
+		collector.timeoutChannel = collector.timeoutTimer.C
 	} else {
 		// If a timeout is not set then create just a generic channel that will never return.
 		// It just makes generalizing the code easier.
 		collector.timeoutChannel = make(chan time.Time)
 	}
+	if len(config.Timeout.Tiers) > 0 {
+		collector.tiers = newTimeoutTiers(config.Timeout.Tiers)
+		collector.tierTimer = time.NewTimer(config.Timeout.Tiers[0].After)
+		collector.tierChannel = collector.tierTimer.C
+	}
+	if collector.awaitingFirstMatch {
+		collector.disarmTimeout()
+	}
 
-	// Configure a new FileBeat Prospector with our rawConfig that will send it's data to a
-	// CollectorOutleter
-	p, err := prospector.NewProspector(
-		rawConfig,
-		collector.collectorOutleterFactory,
-		collector.prospectorDone,
-		[]file.State{},
-	)
+	// Unix sockets, SSH, processes, probes and SQL queries are our own input types which
+	// FileBeat doesn't know anything about. Everything else is handed over to a FileBeat Prospector with our
+	// rawConfig that will send it's data to a CollectorOutleter
+	switch config.Type {
+	case UnixSocketType:
+		collector.input, err = newOwnInput(config, collector.lines, func(lines chan string) (Input, error) {
+			return NewSocketInput(config.Socket, lines)
+		})
+	case SSHType:
+		collector.input, err = newOwnInput(config, collector.lines, func(lines chan string) (Input, error) {
+			return NewSSHInput(config.SSH, config.Paths, lines)
+		})
+	case ProcessType:
+		collector.input, err = NewProcessInput(config.Process, collector.lines)
+	case ProbeType:
+		collector.input, err = NewProbeInput(config.Probe, collector.lines)
+	case SQLType:
+		collector.input, err = NewSQLInput(config.SQL, collector.lines)
+	default:
+		collector.fileStates = newFileStates()
+		collector.input, err = collector.newProspector(states)
+	}
 	if err != nil {
+		collector.stopTimers()
 		return nil, err
 	}
 
-	collector.prospector = p
-	return &collector, nil
+	return collector, nil
+}
+
+// newCollector validates the config and builds the Collector's patterns, everything needed to
+// match lines, without creating its input or any of its tickers
+func newCollector(config CollectorConfig) (*Collector, error) {
+	// Compile the configured pattern
+	if err := validatePatternFlags(config.PatternFlags); err != nil {
+		logp.Warn("Collector %s: %s", config.Name, err)
+		return nil, err
+	}
+	var pattern Matcher
+	var patternFileModTime time.Time
+	var err error
+	if config.Match != nil {
+		if config.Pattern != "" || config.PatternFile != "" {
+			return nil, fmt.Errorf("Collector %s can't combine match with pattern or pattern_file", config.Name)
+		}
+		pattern, err = newMatchTree(*config.Match, config.MatchType, config.PatternFlags)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid match: %s", config.Name, err)
+			return nil, err
+		}
+	} else {
+		var patterns []string
+		patterns, patternFileModTime, err = collectorPatterns(config)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid pattern_file: %s", config.Name, err)
+			return nil, err
+		}
+		pattern, err = compilePatterns(config.MatchType, patterns, config.PatternFlags, config.PatternEngine)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid pattern: %s", config.Name, err)
+			return nil, err
+		}
+	}
+
+	var exclude Matcher
+	if config.ExcludePattern != "" {
+		exclude, err = newMatcher(config.MatchType, config.ExcludePattern, config.PatternFlags)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid exclude_pattern: %s", config.Name, err)
+			return nil, err
+		}
+	}
+
+	if config.CanaryFor != 0 && (!config.Canary || config.CanaryFor < 0) {
+		return nil, fmt.Errorf("Collector %s has a canary_for of %s, it needs canary: true and a positive duration", config.Name, config.CanaryFor)
+	}
+
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("Collector %s has a sample_rate of %v, it has to be between 0 and 1", config.Name, config.SampleRate)
+	}
+
+	if config.Debounce < 0 {
+		return nil, fmt.Errorf("Collector %s has a negative debounce", config.Name)
+	}
+
+	if config.Threshold.Count > 1 && config.Threshold.Window <= 0 {
+		return nil, errors.New("A threshold count needs a threshold window")
+	}
+
+	if (config.Rate.Above > 0 || config.Rate.Below > 0) && config.Rate.Window <= 0 {
+		return nil, errors.New("A rate limit needs a rate window")
+	}
+
+	if err := validateClockJump(config.Timeout.ClockJump); err != nil {
+		return nil, err
+	}
+	if config.Timeout.StartDelay < 0 {
+		return nil, fmt.Errorf("Collector %s has a negative timeout start_delay of %s", config.Name, config.Timeout.StartDelay)
+	}
+	if config.Timeout.MinMatches > 1 && config.Timestamp.Pattern != "" {
+		return nil, fmt.Errorf("Collector %s can't have both a timeout min_matches and a timestamp", config.Name)
+	}
+	if config.Timeout.MaxFirings < 0 || config.Timeout.RepeatInterval < 0 {
+		return nil, fmt.Errorf("Collector %s can't have a negative timeout max_firings or repeat_interval", config.Name)
+	}
+	timeoutJitter, err := parseJitter(config.Timeout.Jitter)
+	if err != nil {
+		logp.Warn("Collector %s: %s", config.Name, err)
+		return nil, err
+	}
+	if err := validateTimeoutTiers(config.Timeout.Tiers); err != nil {
+		logp.Warn("Collector %s: %s", config.Name, err)
+		return nil, err
+	}
+	timezone := config.Timeout.Timezone
+	if len(config.Timeout.ActiveHours) == 0 && (len(config.Timeout.Schedule) > 0 || len(config.Timeout.Maintenance.Windows) > 0) {
+		// The timezone is only the schedule's or maintenance's then
+		timezone = ""
+	}
+	activeHours, err := newActiveHours(config.Timeout.ActiveHours, timezone)
+	if err != nil {
+		logp.Warn("Collector %s: %s", config.Name, err)
+		return nil, err
+	}
+	if len(config.Timeout.Schedule) > 0 && config.Timeout.Interval <= 0 {
+		return nil, fmt.Errorf("Collector %s has a timeout schedule but no timeout interval for outside of it", config.Name)
+	}
+	schedule, err := newTimeoutSchedule(config.Timeout.Schedule, config.Timeout.Timezone)
+	if err != nil {
+		logp.Warn("Collector %s: %s", config.Name, err)
+		return nil, err
+	}
+	maintenance, err := newMaintenanceCalendar(config.Timeout.Maintenance, config.Timeout.Timezone)
+	if err != nil {
+		logp.Warn("Collector %s: %s", config.Name, err)
+		return nil, err
+	}
+
+	var condition *Condition
+	if config.Condition != "" {
+		// Conditions work on named groups, which only regular expressions have
+		if _, ok := pattern.(*regexp.Regexp); !ok {
+			return nil, fmt.Errorf("Collector %s can't use a condition with match_type %s", config.Name, config.MatchType)
+		}
+		condition, err = ParseCondition(config.Condition)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid condition: %s", config.Name, err)
+			return nil, err
+		}
+	}
+
+	for _, command := range config.commands() {
+		if err := validateSanitize(command.Sanitize); err != nil {
+			logp.Warn("Collector %s has an invalid sanitize for %s: %s", config.Name, command, err)
+			return nil, err
+		}
+		if err := validateTemplates(command); err != nil {
+			logp.Warn("Collector %s has an invalid template in %s: %s", config.Name, command, err)
+			return nil, err
+		}
+		if err := validateSystemd(command); err != nil {
+			logp.Warn("Collector %s has an invalid systemd command: %s", config.Name, err)
+			return nil, err
+		}
+		if err := validateMetric(command); err != nil {
+			logp.Warn("Collector %s has an invalid metric: %s", config.Name, err)
+			return nil, err
+		}
+		if err := validateFileAction(command); err != nil {
+			logp.Warn("Collector %s has an invalid file command: %s", config.Name, err)
+			return nil, err
+		}
+		if err := validateSignal(command); err != nil {
+			logp.Warn("Collector %s has an invalid signal: %s", config.Name, err)
+			return nil, err
+		}
+		if err := validateGRPC(command); err != nil {
+			logp.Warn("Collector %s has an invalid grpc command: %s", config.Name, err)
+			return nil, err
+		}
+		if err := validateAWS(command); err != nil {
+			logp.Warn("Collector %s has an invalid AWS command: %s", config.Name, err)
+			return nil, err
+		}
+		if err := validateCooldown(command); err != nil {
+			logp.Warn("Collector %s has an invalid cooldown: %s", config.Name, err)
+			return nil, err
+		}
+	}
+
+	output, err := newFileOutput(config.FileOutput)
+	if err != nil {
+		logp.Warn("Collector %s has an invalid file_output: %s", config.Name, err)
+		return nil, err
+	}
+
+	context, err := newLineContext(config.Context)
+	if err != nil {
+		logp.Warn("Collector %s has an invalid context: %s", config.Name, err)
+		return nil, err
+	}
+
+	if err := validateBatch(config.Batch); err != nil {
+		logp.Warn("Collector %s has an invalid batch: %s", config.Name, err)
+		return nil, err
+	}
+
+	if err := validateCommandLimit(config); err != nil {
+		logp.Warn("Collector %s has an invalid command limit: %s", config.Name, err)
+		return nil, err
+	}
+
+	if err := validateComparisons(config.Compare, pattern); err != nil {
+		logp.Warn("Collector %s has an invalid comparison: %s", config.Name, err)
+		return nil, err
+	}
+
+	config.Severity, err = validateSeverity(config.Severity, pattern)
+	if err != nil {
+		logp.Warn("Collector %s has an invalid severity: %s", config.Name, err)
+		return nil, err
+	}
+
+	var seq *sequence
+	if config.Sequence.Start != "" {
+		seq, err = newSequence(config.Sequence, config.PatternFlags)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid sequence: %s", config.Name, err)
+			return nil, err
+		}
+	}
+
+	var timestamp *timestampParser
+	if config.Timestamp.Pattern != "" {
+		timestamp, err = newTimestampParser(config.Timestamp)
+		if err != nil {
+			logp.Warn("Collector %s has an invalid timestamp: %s", config.Name, err)
+			return nil, err
+		}
+	}
+
+	// Create our Collector with its channel signals
+	collector := &Collector{
+		Pattern:         pattern,
+		ExcludePattern:  exclude,
+		Condition:       condition,
+		config:          config,
+		sequence:        seq,
+		timestamp:       timestamp,
+		activeHours:     activeHours,
+		timeoutJitter:   timeoutJitter,
+		timeoutSchedule: schedule,
+		maintenance:     maintenance,
+
+		awaitingFirstMatch: config.Timeout.ArmOnFirstMatch,
+
+		prospectorDone: make(chan struct{}),
+		lines:          make(chan string),
+		fileLines:      make(chan fileLine),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		Healthy:        make(chan struct{}),
+		resumed:        make(chan time.Duration),
+		statsRequests:  make(chan chan CollectorStats),
+		controls:       make(chan controlRequest),
+
+		finishedCommands: make(chan commandDuration),
+		commandSlots:     newCommandSlots(config.MaxRunningCommands),
+		fileOutput:       output,
+		context:          context,
+
+		logLimiter: newLogLimiter(logRepeatInterval),
+
+		patternFileModTime: patternFileModTime,
+	}
+
+	return collector, nil
+}
+
+// compilePattern compiles one of a collector's regular expressions, applying its pattern_flags
+func compilePattern(expression string, flags string) (*regexp.Regexp, error) {
+	if flags != "" {
+		expression = "(?" + flags + ")" + expression
+	}
+	return regexp.Compile(expression)
+}
+
+// validatePatternFlags makes sure pattern_flags only holds flags RE2 understands: i (case
+// insensitive), m (^ and $ match at line breaks), s (. matches newlines) and U (ungreedy)
+func validatePatternFlags(flags string) error {
+	for _, flag := range flags {
+		if !strings.ContainsRune("imsU", flag) {
+			return fmt.Errorf("Unknown pattern flag %q, expected any of i, m, s or U", flag)
+		}
+	}
+	return nil
+}
+
+// newOwnInput creates one of our own inputs with newInput, wrapping it to assemble multiline
+// events if that's been configured. FileBeat's prospectors take care of this themselves.
+func newOwnInput(config CollectorConfig, lines chan string, newInput func(chan string) (Input, error)) (Input, error) {
+	if config.Multiline.Pattern == "" {
+		return newInput(lines)
+	}
+	return newMultilineInput(config.Multiline, lines, newInput)
 }
 
 // Start begins the underlying prospector and starts processing incoming data. This function
@@ -105,11 +594,30 @@ func NewCollector(config CollectorConfig, rawConfig *common.Config) (*Collector,
 // you can use the "AllowRun" method which will block until a shutdown signal comes in from
 // another routine
 func (collector *Collector) Start() {
+	// A collector may have been created long before it is started (for instance if it
+	// was waiting on its dependencies) so start counting the timeout from now
+	collector.resetTimeout()
+
+	// Give the input time to find its files and whatever we're watching time to start up
+	if collector.config.Timeout.StartDelay > 0 {
+		collector.holdOffTimeouts(collector.config.Timeout.StartDelay)
+	}
+
 	// Begin our internal processing first
 	go collector.process()
+	go collector.maintenance.refreshPeriodically(collector.Done)
+	go collector.logLimiter.run(collector.Done)
 
-	// Start the prospector to start collecting data
-	collector.prospector.Start()
+	if collector.clockJumps != nil {
+		threshold := collector.config.Timeout.ClockJumpThreshold
+		if threshold <= 0 {
+			threshold = DefaultClockJumpThreshold
+		}
+		go watchClock(clockCheckInterval, threshold, collector.clockJumps, collector.Done)
+	}
+
+	// Start the input to start collecting data
+	collector.input.Start()
 }
 
 // Stop triggers a shutdown of the prospector and the data processor. For we're only going
@@ -119,8 +627,8 @@ func (collector *Collector) Start() {
 // which seems to have this underlying restriction and I'm more than happy to piggy back on).
 // This function waits until the Prospector and it's worker's has been successfully shutdown
 func (collector *Collector) Stop() {
-	// Stop the underlying Prospector (this should block until all workers shutdown)
-	collector.prospector.Stop()
+	// Stop the underlying input (this should block until all workers shutdown)
+	collector.input.Stop()
 
 	// Signal our internal processing to stop as well. It's probably safer to do this
 	// after we've stopped the prospector just to make sure we handle as much data as possible
@@ -128,8 +636,51 @@ func (collector *Collector) Stop() {
 	// Wait for our collector to tell us its finished shutting down.
 	<-collector.Stopped
 
-	if collector.ticker != nil {
-		collector.ticker.Stop()
+	collector.stopTimers()
+}
+
+// discard frees everything a collector that was created but will never be started holds on to
+func (collector *Collector) discard() {
+	collector.stopTimers()
+	if input, ok := collector.input.(releaser); ok {
+		input.Release()
+	}
+}
+
+// stopTimers stops all of our timers and tickers
+func (collector *Collector) stopTimers() {
+	if collector.timeoutTimer != nil {
+		collector.timeoutTimer.Stop()
+	}
+	if collector.tierTimer != nil {
+		collector.tierTimer.Stop()
+	}
+	if collector.rateTicker != nil {
+		collector.rateTicker.Stop()
+	}
+	if collector.reportTicker != nil {
+		collector.reportTicker.Stop()
+	}
+	if collector.batchTicker != nil {
+		collector.batchTicker.Stop()
+	}
+	if collector.anomalyTicker != nil {
+		collector.anomalyTicker.Stop()
+	}
+	if collector.patternFileTicker != nil {
+		collector.patternFileTicker.Stop()
+	}
+	if collector.canaryTimer != nil {
+		collector.canaryTimer.Stop()
+	}
+	if collector.debounceTimer != nil {
+		collector.debounceTimer.Stop()
+	}
+	if collector.contextTimer != nil {
+		collector.contextTimer.Stop()
+	}
+	if collector.sequence != nil {
+		collector.sequence.stop()
 	}
 }
 
@@ -145,85 +696,691 @@ func (collector *Collector) LetRun() {
 func (collector *Collector) process() {
 	// Signal that the collector has stopped when we return.
 	defer func() {
+		if DryRun {
+			logp.Info("%s would have run %d commands", collector.observer(), collector.canaryFirings)
+		}
+		collector.fileOutput.close()
 		close(collector.Stopped)
 	}()
 
 	logp.Info("Starting collector processing")
 
-	// What we'll use for keeping track of Timeout.Once, so that a command only executes once
-	// between pattern matches and not at an interval
-	timedOutOnce := false
-
 	// Continuously select over our channels and signals waiting for an event
 	for {
 		select {
 		case msg := <-collector.lines:
 			// We've gotten a new log line
-			logp.Debug("log-pulse", "Collector received message: %s", msg)
-			if collector.Pattern.MatchString(msg) {
-				logp.Debug("log-pulse", "Message matches pattern")
-
-				// The line matches our pattern so reset our timeout
-				collector.resetTimeout()
-
-				// Reset our timedOutOnce so that another timeout command can execute
-				timedOutOnce = false
-
-				// If a command is configured to be run on pattern matches execute it
-				if collector.config.Command.Program != "" {
-					logp.Info("Running pattern match command...")
-					collector.config.Command.Start()
-				}
-			}
+			collector.handleLine(msg, "")
+		case line := <-collector.fileLines:
+			collector.handleLine(line.text, line.source)
 		case t := <-collector.timeoutChannel:
 			logp.Debug("log-pulse", "Timed Out", t)
-
-			// Our ticker has timed-out
-			// Only do anything if there's an actual timeout command configured
-			if collector.config.Timeout.Command.Program != "" {
-				if !(timedOutOnce && collector.config.Timeout.Once) {
-					// Only run our command if TimeoutOnce isn't set or, if it is,
-					// only if we haven't run the command yet.
-					logp.Info("Running timeout command...")
-					collector.config.Timeout.Command.Start()
-				}
+			collector.nextTimeout()
+			collector.handleTimeout()
+		case <-collector.tierChannel:
+			collector.handleTiers()
+		case <-collector.rateChannel:
+			collector.evaluateRate()
+		case <-collector.reportChannel:
+			collector.report()
+		case <-collector.batchChannel:
+			collector.flushBatch()
+		case <-collector.contextChannel:
+			collector.handleContextTimeout()
+		case <-collector.anomalyChannel:
+			collector.evaluateVolume()
+		case <-collector.sequence.expired():
+			collector.handleSequenceTimeout()
+		case <-collector.patternFileChannel:
+			collector.reloadPatternFile()
+		case <-collector.canaryChannel:
+			collector.promote()
+		case <-collector.debounceChannel:
+			collector.handleDebounce()
+		case reply := <-collector.statsRequests:
+			reply <- collector.statsCopy()
+		case request := <-collector.controls:
+			request.reply <- collector.handleControl(request.action)
+		case finished := <-collector.finishedCommands:
+			collector.stats.recordCommand(finished.action, finished.duration, finished.failed)
+			if finished.failed && finished.fallback != nil {
+				finished.fallback()
 			}
-			timedOutOnce = true
+		case jump := <-collector.clockJumps:
+			collector.handleClockJump(jump)
+		case grace := <-collector.resumed:
+			collector.handleResume(grace)
 		case <-collector.Done:
 			// We got a shutdown signal
 			logp.Info("Collector received shutdown signal and is going to close")
+			collector.flushBatch()
+			collector.flushContext()
+			// A burst that hasn't died down yet would otherwise never run its command
+			collector.handleDebounce()
 			return
 		}
 	}
 }
 
+// sampled decides whether a line should be looked at, when only a sample_rate fraction of
+// them should be. Rather than leaving it to chance the lines let through are spread out
+// evenly, so a steady heartbeat stays steady.
+func (collector *Collector) sampled() bool {
+	if collector.config.SampleRate <= 0 || collector.config.SampleRate >= 1 {
+		return true
+	}
+
+	// Allow for rounding, ten lots of 0.1 don't quite add up to 1
+	collector.sampleCredit += collector.config.SampleRate
+	if collector.sampleCredit < 1-1e-9 {
+		return false
+	}
+	collector.sampleCredit--
+	return true
+}
+
+// handleLine is called for every line that comes in, along with the file it came from when
+// our input knows
+func (collector *Collector) handleLine(msg string, source string) {
+	collector.logLimiter.Debug("log-pulse", "Collector received message: %s", msg)
+	collector.lineCount++
+	if collector.context != nil {
+		collector.observeContext(msg)
+		defer collector.context.remember(msg)
+	}
+	if !collector.sampled() {
+		return
+	}
+	if collector.sequence != nil {
+		collector.sequence.observe(msg)
+	}
+	groups, ok := collector.match(msg)
+	if ok {
+		collector.logLimiter.Debug("log-pulse", "Message matches pattern")
+		collector.handleMatch(msg, source, groups)
+	}
+	if collector.timestamp != nil {
+		if t, hasTime := collector.timestamp.parse(msg); hasTime {
+			collector.advanceEventClock(t, ok)
+		}
+	}
+}
+
+// handleMatch is called for every line that matches
+func (collector *Collector) handleMatch(msg string, source string, groups map[string]string) {
+	// With arm_on_first_match this is where the timeout starts counting
+	collector.awaitingFirstMatch = false
+
+	recovered := false
+	if collector.pulse() {
+		// The line matches our pattern so reset our timeout
+		collector.resetTimeout()
+
+		// Reset our timedOutOnce so that another timeout command can execute
+		recovered = collector.timedOutOnce
+		collector.timedOutOnce = false
+		collector.missedBeats = 0
+		collector.timeoutFirings = 0
+
+		// Let any collectors depending on us know that we're up
+		collector.markHealthy()
+
+		// The first match after a timeout means whatever it was has come back
+		if collector.recoveryPending {
+			collector.recover(msg, source, groups)
+		}
+	}
+
+	// Count towards our match rate, report and stats
+	collector.rateCount++
+	collector.reportCount++
+	matchedAt := time.Now()
+	collector.stats.Heatmap.record(matchedAt)
+	collector.stats.LastMatch = matchedAt
+
+	if collector.fileOutput != nil {
+		collector.writeFileOutput(msg, source, groups)
+	}
+	if collector.config.Batch.Command.configured() {
+		collector.addToBatch(msg)
+	}
+
+	// With a threshold configured a single match isn't enough to run the command
+	if !collector.thresholdReached(time.Now()) {
+		return
+	}
+
+	// With debounce the command waits for the burst of matches to die down
+	if collector.config.Debounce > 0 {
+		collector.debounce(msg, source, groups, recovered)
+		return
+	}
+
+	collector.fireMatch(msg, source, groups, recovered, 1)
+}
+
+// writeFileOutput writes a matching line to our file_output
+func (collector *Collector) writeFileOutput(msg string, source string, groups map[string]string) {
+	if collector.canary {
+		collector.logLimiter.Debug("log-pulse", "%s would have written the line to its file_output", collector.observer())
+		return
+	}
+	data := commandData{
+		Line:      msg,
+		File:      source,
+		Collector: collector.config.Name,
+		Groups:    groups,
+		Severity:  extractSeverity(collector.config.Severity, msg, groups),
+	}
+	if err := collector.fileOutput.write(data); err != nil {
+		collector.logLimiter.Warn("Unable to write to the file_output of collector %s: %s", collector.config.Name, err)
+	}
+}
+
+// fireMatch runs the match command for a line, or for the last line of a burst of count
+// matches with debounce. recovered is whether the match broke the silence after a timeout.
+func (collector *Collector) fireMatch(msg string, source string, groups map[string]string, recovered bool, count int) {
+	// Once the command's had its chance to run we're done, with exit_on_match
+	if collector.config.ExitOnMatch {
+		defer collector.exit(ExitMatched, "matched")
+	}
+
+	// With match_after_timeout only the line breaking the silence runs the command
+	if collector.config.MatchAfterTimeout && !recovered {
+		return
+	}
+
+	// If commands are configured to be run on pattern matches execute them
+	commands, severity := collector.matchCommands(msg, groups)
+	if len(commands) > 0 {
+		now := time.Now()
+		if collector.suppressed(now) {
+			collector.logLimiter.Debug("log-pulse", "Pattern match command suppressed")
+			return
+		}
+		if collector.config.MatchOnce && collector.latched {
+			collector.logLimiter.Debug("log-pulse", "Pattern match command already ran, waiting for a timeout")
+			return
+		}
+		collector.latched = true
+
+		logp.Info("Running pattern match command...")
+		collector.stats.LastCommand = now
+		if collector.config.SuppressFor > 0 {
+			// Save it right away, so that even if we crash and get restarted the
+			// suppression still holds
+			select {
+			case collector.statsChanged <- struct{}{}:
+			default:
+			}
+		}
+		data := commandData{Line: msg, File: source, Collector: collector.config.Name, Groups: groups, Severity: severity, Count: count}
+		if collector.context != nil {
+			data.Before = collector.context.before()
+			if collector.config.Context.After > 0 {
+				collector.awaitContext(commands, data)
+				return
+			}
+		}
+		collector.runCommands(MatchAction, commands, data)
+	}
+}
+
+// exit asks the Collection to stop and exit with code, for exit_on_match. The first
+// collector to ask decides the code.
+func (collector *Collector) exit(code int, reason string) {
+	logp.Info("Collector %s %s, exiting", collector.config.Name, reason)
+	select {
+	case collector.exits <- code:
+	default:
+	}
+}
+
+// suppressed reports whether the match command already ran within suppress_for, so that a
+// storm of matching lines doesn't run it hundreds of times
+func (collector *Collector) suppressed(now time.Time) bool {
+	return collector.config.SuppressFor > 0 &&
+		!collector.stats.LastCommand.IsZero() &&
+		now.Sub(collector.stats.LastCommand) < collector.config.SuppressFor
+}
+
+// runCommand starts one of our commands and, once it has finished, records how long it
+// took under its action in our stats. Commands run in the background so the waiting is
+// done by a goroutine of its own, which hands the duration back to process.
+func (collector *Collector) runCommand(action string, command CommandConfig, data commandData, env []string) {
+	if prepared, ok := collector.prepareCommand(action, command, data, env); ok {
+		collector.startLimited(action, prepared)
+	}
+}
+
+// prepareCommand gets a command ready to run: it expands its templates and adds what set it
+// off to its environment. It reports false if the command shouldn't be run after all,
+// because it's cooling down, can't be expanded or we're a canary.
+func (collector *Collector) prepareCommand(action string, command CommandConfig, data commandData, env []string) (preparedCommand, bool) {
+	if collector.coolingDown(action, command, time.Now()) {
+		return preparedCommand{}, false
+	}
+	fallback := collector.fallback(action, command, data, env)
+
+	// Whoever gets woken up by a command should get some context and a pointer to what to do
+	data.Description = strings.TrimSpace(collector.config.Description)
+	data.RunbookURL = collector.config.RunbookURL
+
+	expanded, err := command.expand(data)
+	if err != nil {
+		logp.Err("Unable to run %s command %s: %s", action, command, err)
+		if fallback != nil {
+			fallback()
+		}
+		return preparedCommand{}, false
+	}
+	command = expanded
+	env = append(contextEnvironment(action, command, data), env...)
+
+	if collector.canary {
+		collector.canaryFirings++
+		logp.Info("%s would have run %s command %s", collector.observer(), action, command)
+		return preparedCommand{}, false
+	}
+	if collector.auditLog != nil && command.Program != "" {
+		command.capture = newOutputCapture(maxAuditOutput)
+	}
+	prepared := preparedCommand{command: command, env: env, fallback: fallback}
+	if command.GRPC.Address != "" || command.SNS.TopicARN != "" || command.Lambda.Function != "" {
+		prepared.event = collector.pulseEvent(action, command, data)
+	}
+	return prepared, true
+}
+
+// thresholdReached records a match at the given time and reports whether there have now been
+// threshold.count matches within threshold.window. Once it has been reached we start counting
+// from scratch so that a long burst doesn't run the command on every line.
+// Without a threshold every match is enough.
+func (collector *Collector) thresholdReached(now time.Time) bool {
+	threshold := collector.config.Threshold
+	if threshold.Count <= 1 {
+		return true
+	}
+
+	// Forget about the matches that have fallen out of the window
+	recent := collector.recentMatches[:0]
+	for _, t := range collector.recentMatches {
+		if now.Sub(t) < threshold.Window {
+			recent = append(recent, t)
+		}
+	}
+	collector.recentMatches = append(recent, now)
+
+	if len(collector.recentMatches) < threshold.Count {
+		logp.Debug("log-pulse", "%d of %d matches needed within %s", len(collector.recentMatches), threshold.Count, threshold.Window)
+		return false
+	}
+
+	collector.recentMatches = nil
+	return true
+}
+
+// evaluateRate is called at the end of every rate window. It works out the match rate over
+// the window and runs the rate command whenever the rate goes out of bounds.
+func (collector *Collector) evaluateRate() {
+	rate := float64(collector.rateCount) / collector.config.Rate.Window.Seconds()
+	collector.rateCount = 0
+
+	state := nextRateState(collector.config.Rate, collector.rateState, rate)
+	if state == collector.rateState {
+		return
+	}
+	collector.rateState = state
+
+	if state == "" {
+		logp.Info("Match rate of collector %s is back to normal at %.2f/s", collector.config.Name, rate)
+		return
+	}
+
+	logp.Info("Match rate of collector %s is %s its limit at %.2f/s", collector.config.Name, state, rate)
+	if collector.config.Rate.Command.configured() {
+		logp.Info("Running rate command...")
+		env := append(collector.environment(nil),
+			"LOGPULSE_RATE="+strconv.FormatFloat(rate, 'f', -1, 64),
+			"LOGPULSE_RATE_STATE="+state,
+		)
+		collector.runCommand(RateAction, collector.config.Rate.Command, commandData{Collector: collector.config.Name}, env)
+	}
+}
+
+// report runs the report command with the number of matches since the last report
+func (collector *Collector) report() {
+	count := collector.reportCount
+	collector.reportCount = 0
+
+	logp.Info("Collector %s matched %d times in the last %s", collector.config.Name, count, collector.config.Report.Interval)
+	if collector.config.Report.Command.configured() {
+		env := append(collector.environment(nil),
+			"LOGPULSE_COUNT="+strconv.Itoa(count),
+			"LOGPULSE_INTERVAL="+collector.config.Report.Interval.String(),
+		)
+		collector.runCommand(ReportAction, collector.config.Report.Command, commandData{Collector: collector.config.Name}, env)
+	}
+}
+
+// evaluateVolume feeds our line rate over the last window to our anomaly detector and runs
+// the anomaly command when the volume becomes anomalous
+func (collector *Collector) evaluateVolume() {
+	rate := float64(collector.lineCount) / collector.config.Anomaly.Window.Seconds()
+	collector.lineCount = 0
+
+	baseline := collector.anomaly.baseline
+	state, changed := collector.anomaly.observe(rate)
+	if !changed {
+		return
+	}
+
+	if state == "" {
+		logp.Info("Log volume of collector %s is back to normal at %.2f lines/s", collector.config.Name, rate)
+		return
+	}
+
+	logp.Info("Log volume of collector %s looks like a %s at %.2f lines/s, against a baseline of %.2f", collector.config.Name, state, rate, baseline)
+	if collector.config.Anomaly.Command.configured() {
+		env := append(collector.environment(nil),
+			"LOGPULSE_RATE="+strconv.FormatFloat(rate, 'f', -1, 64),
+			"LOGPULSE_BASELINE="+strconv.FormatFloat(baseline, 'f', -1, 64),
+			"LOGPULSE_ANOMALY="+state,
+		)
+		collector.runCommand(AnomalyAction, collector.config.Anomaly.Command, commandData{Collector: collector.config.Name}, env)
+	}
+}
+
+// handleTimeout is called whenever our timer runs out without seeing a match
+func (collector *Collector) handleTimeout() {
+	// With min_matches the next interval needs all of its matches again
+	collector.intervalMatches = 0
+
+	if collector.timeoutsSuppressed(time.Now()) {
+		return
+	}
+
+	// Give slightly late heartbeats a few more intervals if we've been told to
+	collector.missedBeats++
+	if collector.missedBeats < collector.config.Timeout.Misses {
+		logp.Debug("log-pulse", "Missed %d of %d beats", collector.missedBeats, collector.config.Timeout.Misses)
+		return
+	}
+
+	// The pattern's gone quiet, so with match_once the next match runs the command again
+	collector.latched = false
+
+	if collector.config.ExitOnMatch {
+		defer collector.exit(ExitTimedOut, "timed out")
+	}
+
+	// Only do anything if there's an actual timeout command configured
+	commands := commandList(collector.config.Timeout.Command, collector.config.Timeout.Commands)
+	if len(commands) > 0 {
+		// With max_firings the command stops after that many runs until the next match
+		max := collector.config.Timeout.MaxFirings
+		if max > 0 && collector.timeoutFirings >= max {
+			logp.Debug("log-pulse", "Timeout command already ran %d times, waiting for a match", max)
+		} else if !(collector.timedOutOnce && collector.config.Timeout.Once) {
+			// Only run our command if TimeoutOnce isn't set or, if it is,
+			// only if we haven't run the command yet.
+			logp.Info("Running timeout command...")
+			collector.timeoutFirings++
+			collector.runCommands(TimeoutAction, commands, commandData{Collector: collector.config.Name})
+		}
+	}
+	collector.timedOutOnce = true
+	collector.recoveryPending = true
+}
+
+// handleSequenceTimeout is called when a sequence's end line didn't come in time
+func (collector *Collector) handleSequenceTimeout() {
+	groups := collector.sequence.expire()
+	logp.Info("Collector %s didn't see the end of its sequence within %s", collector.config.Name, collector.config.Sequence.Within)
+
+	command := collector.config.Sequence.Command
+	if command.configured() {
+		logp.Info("Running sequence command...")
+		data := commandData{Collector: collector.config.Name, Groups: groups}
+		collector.runCommand(SequenceAction, command, data, collector.environment(sanitizeGroups(command.Sanitize, groups)))
+	}
+}
+
+// handleClockJump applies the configured clock_jump policy when the wall clock has moved
+// differently from the monotonic clock our timeouts are counted with.
+func (collector *Collector) handleClockJump(jump time.Duration) {
+	logp.Warn("Collector %s detected the system clock jumping by %s", collector.config.Name, jump)
+
+	switch collector.config.Timeout.ClockJump {
+	case ClockJumpReset:
+		logp.Info("Restarting the timeout of collector %s", collector.config.Name)
+		collector.resetTimeout()
+	case ClockJumpFire:
+		logp.Info("Timing out collector %s immediately", collector.config.Name)
+		collector.resetTimeout()
+		collector.handleTimeout()
+	}
+}
+
+// handleResume restarts our timeout after the host has been suspended and ignores any
+// timeouts during the grace period, giving everything time to get going again
+func (collector *Collector) handleResume(grace time.Duration) {
+	logp.Info("Collector %s holding off timeouts for %s after resume", collector.config.Name, grace)
+	collector.resetTimeout()
+	collector.holdOffTimeouts(grace)
+}
+
+// holdOffTimeouts ignores timeouts for the next while, unless they're already being ignored
+// for longer
+func (collector *Collector) holdOffTimeouts(grace time.Duration) {
+	if until := time.Now().Add(grace); until.After(collector.suppressTimeoutsUntil) {
+		collector.suppressTimeoutsUntil = until
+	}
+}
+
+// match decides whether a line counts as a match: it has to match our pattern without
+// matching the exclude pattern, and satisfy our condition if there is one. It also returns
+// the values of the pattern's named groups, if it has any.
+func (collector *Collector) match(msg string) (map[string]string, bool) {
+	var groups map[string]string
+	regex, isRegex := collector.Pattern.(*regexp.Regexp)
+	if isRegex && (collector.Condition != nil || hasNamedGroups(regex)) {
+		// We only bother pulling out the groups if we actually need them
+		submatches := regex.FindStringSubmatch(msg)
+		if submatches == nil {
+			return nil, false
+		}
+		groups = namedGroups(regex, submatches)
+	} else if !collector.Pattern.MatchString(msg) {
+		return nil, false
+	}
+
+	if collector.ExcludePattern != nil && collector.ExcludePattern.MatchString(msg) {
+		collector.logLimiter.Debug("log-pulse", "Message matches exclude pattern")
+		return nil, false
+	}
+
+	if collector.Condition != nil {
+		ok, err := collector.Condition.Evaluate(groups)
+		if err != nil {
+			collector.logLimiter.Debug("log-pulse", "Unable to evaluate condition %s: %s", collector.Condition, err)
+			return nil, false
+		}
+		if !ok {
+			collector.logLimiter.Debug("log-pulse", "Message doesn't satisfy condition")
+			return nil, false
+		}
+	}
+
+	if !compare(collector.config.Compare, msg, groups) {
+		collector.logLimiter.Debug("log-pulse", "Message doesn't satisfy comparisons")
+		return nil, false
+	}
+
+	return groups, true
+}
+
+// hasNamedGroups reports whether a regular expression has any named groups
+func hasNamedGroups(pattern *regexp.Regexp) bool {
+	for _, name := range pattern.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// namedGroups pairs up the values captured by a regular expression with the names of its
+// named groups. Unnamed groups are left out.
+func namedGroups(pattern *regexp.Regexp, submatches []string) map[string]string {
+	groups := make(map[string]string)
+	for i, name := range pattern.SubexpNames() {
+		if name != "" && i < len(submatches) {
+			groups[name] = submatches[i]
+		}
+	}
+	return groups
+}
+
+// environment builds the extra environment variables handed to our commands. Every label
+// becomes a LOGPULSE_LABEL_<KEY> variable so scripts can tell which team or service the
+// collector belongs to, and every named group captured by the matching line becomes a
+// LOGPULSE_GROUP_<NAME> variable.
+func (collector *Collector) environment(groups map[string]string) []string {
+	env := prefixedEnvironment("LOGPULSE_LABEL_", collector.config.Labels)
+	return append(env, prefixedEnvironment("LOGPULSE_GROUP_", groups)...)
+}
+
+// contextEnvironment describes what set a command off in environment variables, for scripts
+// that would rather read them than take arguments
+func contextEnvironment(action string, command CommandConfig, data commandData) []string {
+	env := []string{
+		"LOGPULSE_EVENT=" + action,
+		"LOGPULSE_COLLECTOR=" + data.Collector,
+	}
+	if data.Line != "" {
+		env = append(env, "LOGPULSE_LINE="+sanitize(command.Sanitize, data.Line))
+	}
+	if data.File != "" {
+		env = append(env, "LOGPULSE_FILE="+data.File)
+	}
+	if data.Severity != "" {
+		env = append(env, "LOGPULSE_SEVERITY="+data.Severity)
+	}
+	if len(data.Before) > 0 {
+		env = append(env, "LOGPULSE_CONTEXT_BEFORE="+strings.Join(sanitizeLines(command.Sanitize, data.Before), "\n"))
+	}
+	if len(data.After) > 0 {
+		env = append(env, "LOGPULSE_CONTEXT_AFTER="+strings.Join(sanitizeLines(command.Sanitize, data.After), "\n"))
+	}
+	if data.Count > 0 {
+		env = append(env, "LOGPULSE_MATCH_COUNT="+strconv.Itoa(data.Count))
+	}
+	if data.Description != "" {
+		env = append(env, "LOGPULSE_DESCRIPTION="+data.Description)
+	}
+	if data.RunbookURL != "" {
+		env = append(env, "LOGPULSE_RUNBOOK_URL="+data.RunbookURL)
+	}
+	return env
+}
+
+// prefixedEnvironment turns a map into "PREFIX_KEY=value" environment variables
+func prefixedEnvironment(prefix string, values map[string]string) []string {
+	// Keep the order stable, mostly for the sake of tests and log messages
+	var env []string
+	for _, key := range sortedKeys(values) {
+		env = append(env, prefix+envName(key)+"="+values[key])
+	}
+	return env
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// envName converts a free-form name into something that's safe to use as an environment
+// variable name: upper case letters, digits and underscores.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// markHealthy closes the Healthy channel the first time it is called. It's only ever called
+// from process so we don't have to worry about closing the channel twice concurrently.
+func (collector *Collector) markHealthy() {
+	if collector.Healthy == nil {
+		return
+	}
+
+	select {
+	case <-collector.Healthy:
+		// Already healthy
+	default:
+		logp.Info("Collector %s is healthy", collector.config.Name)
+		close(collector.Healthy)
+	}
+}
+
+// isHealthy reports whether markHealthy has been called
+func (collector *Collector) isHealthy() bool {
+	select {
+	case <-collector.Healthy:
+		return true
+	default:
+		return false
+	}
+}
+
+// newProspector creates the FileBeat Prospector reading our files, starting from states
+func (collector *Collector) newProspector(states []file.State) (Input, error) {
+	return prospector.NewProspector(
+		collector.rawConfig,
+		collector.collectorOutleterFactory,
+		collector.prospectorDone,
+		states,
+	)
+}
+
 // collectorOutleterFactory is sent to the Prospector to create an Outleter that will recieve the
 // log data for all of this prospector's managed files (all defined paths and expanded globs will
 // be pooled there)
 func (collector *Collector) collectorOutleterFactory(*common.Config) (channel.Outleter, error) {
 	// Pass along our channel so we can get messages from the generates Outleter
 	return &CollectorOutleter{
-		lines: collector.lines,
+		lines:      collector.fileLines,
+		logLimiter: collector.logLimiter,
+		states:     collector.fileStates,
 	}, nil
 }
 
-// resetTimeout resets the ticker so that it starts counting again from this point in time
-func (collector *Collector) resetTimeout() {
-	// We only need to do something if there actually is a ticker (ie: if an interval was specified)
-	if collector.ticker != nil {
-		// Stop the ticker so it can be garbage collected
-		collector.ticker.Stop()
-
-		// From everything I've read the only real way to reset a ticker is to recreate it
-		collector.ticker = time.NewTicker(collector.config.Timeout.Interval)
-		collector.timeoutChannel = collector.ticker.C
-	}
-}
-
 // CollectorOutleter gets called when the Prospector emits new events
 // or closes
 type CollectorOutleter struct {
-	lines chan string
+	lines      chan fileLine
+	logLimiter *logLimiter
+	// Where we keep the state of every file for reloads, nil for nowhere
+	states *fileStates
+}
+
+// fileLine is a line read by FileBeat and the path of the file it's from
+type fileLine struct {
+	text   string
+	source string
 }
 
 // OnEvent is called by FileBeat harvesters Forwarder and passes file events and incoming log data. It is
@@ -249,13 +1406,16 @@ func (outlet *CollectorOutleter) OnEvent(data *util.Data) bool {
 			// it down the wire.
 			if str, ok := msg.(string); ok {
 				// Send the line over our channel
-				outlet.lines <- str
+				outlet.lines <- fileLine{text: str, source: data.GetState().Source}
 			} else {
-				logp.Warn("Encountered non string message field: %s", msg)
+				outlet.logLimiter.Warn("Encountered non string message field: %s", msg)
 			}
 		}
 	}
 
+	// Those blank events still tell us how far into its file the harvester has got
+	outlet.states.record(data.GetState())
+
 	// The boolean we return indicates whether we were able to enqueue the data or not. For our purposes,
 	// since we're not actually using a complicated Spool feature like FileBeat, we can just say we were
 	// able to.
@@ -271,12 +1431,65 @@ func (outlet *CollectorOutleter) Close() error {
 	return nil
 }
 
+// The codes we exit with when a collector with exit_on_match stops us
+const (
+	ExitMatched  = 0
+	ExitTimedOut = 3
+)
+
 // Collection holds and handles an array of Collector instances
 type Collection struct {
 	collectors []*Collector
 
+	// ResumeGrace is how long timeouts are held off for after the host resumes from
+	// being suspended. Zero leaves the timeouts alone.
+	ResumeGrace time.Duration
+	// StatsFile is where our collectors' stats are saved, every so often and when we
+	// stop. Empty means they aren't saved.
+	StatsFile string
+	// InfluxURL is an InfluxDB write endpoint our collectors' match counts are pushed to
+	// every InfluxInterval. Empty means they aren't pushed.
+	InfluxURL      string
+	InfluxInterval time.Duration
+	// How to set up TLS for an https InfluxURL
+	InfluxTLS TLSConfig
+	// MaxRunningCommands caps how many commands all of our collectors can be running at
+	// the same time. Zero is no cap.
+	MaxRunningCommands int
+	// AuditLog is where the commands our collectors run are recorded, nil for nowhere.
+	// It's closed when we stop.
+	AuditLog *AuditLog
+	// ControlListener is the control socket our collectors can be reset and fired
+	// through, nil for none. It's closed when we stop.
+	ControlListener net.Listener
+	// ExitCode is what we should exit with once LetRun returns. It's ExitMatched or
+	// ExitTimedOut when a collector with exit_on_match stopped us and 0 otherwise.
+	ExitCode int
+
 	// Used to wait for all Collectors to finish
 	wg sync.WaitGroup
+
+	// Closed when the Collection is stopped so that collectors still waiting on their
+	// dependencies give up
+	done chan struct{}
+	// Guards started and stopping so that a collector whose dependencies just became
+	// healthy can't be started while the Collection is shutting down
+	mutex    sync.Mutex
+	started  map[*Collector]bool
+	stopping bool
+	// Set once Start has launched our collectors, reloads have to wait for it
+	running bool
+
+	// Collectors ask for their stats to be saved early through this
+	statsChanged chan struct{}
+	// Collectors with exit_on_match send their exit code through this
+	exits chan int
+	// The cap on running commands shared by all of our collectors, kept for the ones
+	// reloads add
+	sharedCommandSlots chan struct{}
+	// What our collectors were running before the last reload and what it changed
+	previousConfig LogPulseConfig
+	lastReload     ConfigDiff
 }
 
 // CreateCollection iterates through a LogPulseConfig and returns a Collection object which can run the
@@ -291,7 +1504,7 @@ func CreateCollection(configs LogPulseConfig, rawConfigs []*common.Config) (*Col
 		if c, err := NewCollector(conf, rawConfigs[i]); err == nil {
 			collectors = append(collectors, c)
 		} else {
-			logp.Warn("Unable to create a collector. Skipping. %s", err)
+			logp.Warn("Unable to create collector %s. Skipping. %s", conf.Name, err)
 		}
 	}
 
@@ -299,28 +1512,319 @@ func CreateCollection(configs LogPulseConfig, rawConfigs []*common.Config) (*Col
 		return nil, errors.New("No Collectors created")
 	}
 
+	if err := checkDependencies(collectors); err != nil {
+		return nil, err
+	}
+
+	statsChanged := make(chan struct{}, 1)
+	exits := make(chan int, 1)
+	for _, c := range collectors {
+		c.statsChanged = statsChanged
+		if c.config.ExitOnMatch {
+			c.exits = exits
+		}
+	}
+
 	return &Collection{
-		collectors: collectors,
+		collectors:   collectors,
+		done:         make(chan struct{}),
+		started:      make(map[*Collector]bool),
+		statsChanged: statsChanged,
+		exits:        exits,
 	}, nil
 }
 
-// Start begins all of the Collectors associated with the Collection
+// Start begins all of the Collectors associated with the Collection. Collectors without any
+// dependencies are started right away, the rest are started as soon as all of the collectors
+// they depend on have become healthy.
 func (collection *Collection) Start() {
+	// Keep an eye out for the host being suspended
+	jumps := make(chan time.Duration)
+	go watchClock(clockCheckInterval, DefaultClockJumpThreshold, jumps, collection.done)
+	go collection.handleResumes(jumps)
+
+	if collection.StatsFile != "" {
+		go collection.saveStatsPeriodically()
+	}
+	go collection.handleExits()
+	if collection.ControlListener != nil {
+		go collection.serveControl(collection.ControlListener)
+	}
+	if collection.InfluxURL != "" {
+		go collection.writeInfluxPeriodically()
+	}
+
+	collection.mutex.Lock()
+	collection.sharedCommandSlots = newCommandSlots(collection.MaxRunningCommands)
 	for _, c := range collection.collectors {
-		c.Start()
-		collection.wg.Add(1)
+		c.sharedCommandSlots = collection.sharedCommandSlots
+		c.auditLog = collection.AuditLog
+	}
+	collectors := collection.collectors
+	collection.running = true
+	collection.mutex.Unlock()
+
+	// Collectors come and go with reloads, LetRun waits for Stop rather than for them
+	collection.wg.Add(1)
+	for _, c := range collectors {
+		collection.launch(c)
 	}
 }
 
-// Stop all of the Collectors
-func (collection *Collection) Stop() {
+// launch starts a collector, straight away if it has no dependencies and once they're
+// healthy if it does
+func (collection *Collection) launch(c *Collector) {
+	if len(c.config.DependsOn) == 0 {
+		collection.startCollector(c)
+	} else {
+		go collection.startAfterDependencies(c)
+	}
+}
+
+// handleResumes watches for the wall clock jumping forwards, which is what a suspend looks like
+// from the inside since our monotonic clock stops while the host is asleep. Every started
+// collector is given the ResumeGrace so that opening a laptop lid doesn't fire every timeout.
+func (collection *Collection) handleResumes(jumps <-chan time.Duration) {
+	for {
+		select {
+		case jump := <-jumps:
+			// The clock being set backwards isn't a suspend
+			if jump <= 0 {
+				continue
+			}
+
+			logp.Warn("The host appears to have been suspended for about %s", jump)
+			if collection.ResumeGrace <= 0 {
+				continue
+			}
+
+			for _, c := range collection.startedCollectors() {
+				select {
+				case c.resumed <- collection.ResumeGrace:
+				case <-c.Stopped:
+				}
+			}
+		case <-collection.done:
+			return
+		}
+	}
+}
+
+// handleExits stops the Collection when a collector with exit_on_match asks us to exit
+func (collection *Collection) handleExits() {
+	select {
+	case code := <-collection.exits:
+		collection.mutex.Lock()
+		collection.ExitCode = code
+		collection.mutex.Unlock()
+		collection.Stop()
+	case <-collection.done:
+	}
+}
+
+// startedCollectors returns the collectors that have been started so far
+func (collection *Collection) startedCollectors() []*Collector {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	var started []*Collector
 	for _, c := range collection.collectors {
-		c.Stop()
-		collection.wg.Done()
+		if collection.started[c] {
+			started = append(started, c)
+		}
 	}
+	return started
+}
+
+// startAfterDependencies blocks until every dependency of the collector is healthy and then
+// starts it. It gives up if the Collection is stopped, or a reload retires the collector, in
+// the meantime. A dependency replaced by a reload is waited on in its new form.
+func (collection *Collection) startAfterDependencies(c *Collector) {
+	for _, name := range c.config.DependsOn {
+		logp.Info("Collector %s waiting on %s to become healthy", c.config.Name, name)
+		for healthy := false; !healthy; {
+			select {
+			case <-collection.done:
+				return
+			case <-c.Done:
+				return
+			default:
+			}
+
+			collection.mutex.Lock()
+			dependency := findCollector(collection.collectors, name)
+			collection.mutex.Unlock()
+			if dependency == nil {
+				return
+			}
+
+			select {
+			case <-dependency.Healthy:
+				logp.Info("Dependency %s of collector %s is healthy", name, c.config.Name)
+				healthy = true
+			case <-dependency.Done:
+				// Replaced by a reload, or we're stopping, which the top of the loop sorts out
+			case <-c.Done:
+				return
+			case <-collection.done:
+				return
+			}
+		}
+	}
+
+	collection.startCollector(c)
+}
+
+const (
+	// CollectorWaiting is the state of a collector that hasn't been started yet, which is
+	// usually down to its dependencies not being healthy
+	CollectorWaiting = "waiting"
+	// CollectorStarted is the state of a collector that's been started
+	CollectorStarted = "started"
+)
+
+// dependencyState returns the state of a collector and, if it's still waiting, which of its
+// dependencies aren't healthy yet. The mutex has to be held.
+func (collection *Collection) dependencyState(c *Collector) (string, []string) {
+	if collection.started[c] {
+		return CollectorStarted, nil
+	}
+	var waitingOn []string
+	for _, name := range c.config.DependsOn {
+		dependency := findCollector(collection.collectors, name)
+		if dependency == nil || !dependency.isHealthy() {
+			waitingOn = append(waitingOn, name)
+		}
+	}
+	return CollectorWaiting, waitingOn
+}
+
+// startCollector starts a single collector unless the Collection is already shutting down
+func (collection *Collection) startCollector(c *Collector) {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	// A reload might have retired the collector while it waited on its dependencies
+	if collection.stopping || findCollector(collection.collectors, c.config.Name) != c {
+		return
+	}
+
+	c.Start()
+	collection.started[c] = true
+}
+
+// Stop all of the Collectors, lowest priority first so that the most important ones keep
+// watching for as long as possible
+func (collection *Collection) Stop() {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+
+	// We might be told to stop by a signal and an exit_on_match collector at once
+	if collection.stopping {
+		return
+	}
+	collection.stopping = true
+	close(collection.done)
+
+	for _, c := range shutdownOrder(collection.collectors) {
+		// Collectors still waiting on their dependencies were never started so there's
+		// nothing to stop
+		if collection.started[c] {
+			c.Stop()
+		}
+	}
+
+	if collection.StatsFile != "" {
+		collection.saveStats()
+	}
+	if collection.ControlListener != nil {
+		collection.ControlListener.Close()
+	}
+	if err := collection.AuditLog.Close(); err != nil {
+		logp.Err("Unable to close the audit log: %s", err)
+	}
+
+	// Only let LetRun return once everything's been cleaned up
+	collection.wg.Done()
 }
 
 // LetRun blocks until all of the managed Collectors are stopped
 func (collection *Collection) LetRun() {
 	collection.wg.Wait()
 }
+
+// shutdownOrder returns the collectors sorted by ascending priority. Collectors with the
+// same priority keep the order they were configured in.
+func shutdownOrder(collectors []*Collector) []*Collector {
+	ordered := make([]*Collector, len(collectors))
+	copy(ordered, collectors)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].config.Priority < ordered[j].config.Priority
+	})
+	return ordered
+}
+
+// findCollector returns the collector with the given name or nil if there isn't one
+func findCollector(collectors []*Collector, name string) *Collector {
+	for _, c := range collectors {
+		if c.config.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkDependencies makes sure that every depends_on entry names a collector that exists
+// and that the dependencies don't form a cycle, either of which would leave collectors
+// waiting forever.
+func checkDependencies(collectors []*Collector) error {
+	names := make(map[string]bool)
+	for _, c := range collectors {
+		if c.config.Name == "" {
+			continue
+		}
+		if names[c.config.Name] {
+			return fmt.Errorf("Collector name %s is used more than once", c.config.Name)
+		}
+		names[c.config.Name] = true
+	}
+
+	for _, c := range collectors {
+		for _, name := range c.config.DependsOn {
+			if !names[name] {
+				return fmt.Errorf("Collector %s depends on unknown collector %s", c.config.Name, name)
+			}
+		}
+	}
+
+	// Walk the dependency graph depth first, keeping track of the collectors on our
+	// current path. Running into one of them again means we've gone in a circle.
+	visiting := make(map[string]bool)
+	visited := make(map[string]bool)
+	var visit func(c *Collector) error
+	visit = func(c *Collector) error {
+		if visited[c.config.Name] {
+			return nil
+		}
+		if visiting[c.config.Name] {
+			return fmt.Errorf("Collector %s has a circular dependency", c.config.Name)
+		}
+
+		visiting[c.config.Name] = true
+		for _, name := range c.config.DependsOn {
+			if err := visit(findCollector(collectors, name)); err != nil {
+				return err
+			}
+		}
+		visiting[c.config.Name] = false
+		visited[c.config.Name] = true
+		return nil
+	}
+
+	for _, c := range collectors {
+		if err := visit(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/elastic/beats/libbeat/publisher/beat"
 
 	"github.com/elastic/beats/filebeat/harvester"
+	"github.com/elastic/beats/filebeat/input/file"
 	"github.com/elastic/beats/filebeat/util"
 	"github.com/stretchr/testify/assert"
 )
@@ -46,7 +47,7 @@ func assertFileDoesNotExist(t *testing.T, filename string) {
 }
 
 func TestCollectorOutleterOnEvent(t *testing.T) {
-	pipe := make(chan string, 1)
+	pipe := make(chan fileLine, 1)
 	outleter := CollectorOutleter{
 		lines: pipe,
 	}
@@ -54,7 +55,7 @@ func TestCollectorOutleterOnEvent(t *testing.T) {
 	// And empty event shouldn't emit anything
 	data := util.NewData()
 	assert.True(t, outleter.OnEvent(data))
-	assertChanEmpty(t, pipe)
+	assert.Empty(t, pipe)
 
 	// event with non message field
 	data = util.NewData()
@@ -64,7 +65,7 @@ func TestCollectorOutleterOnEvent(t *testing.T) {
 		},
 	}
 	assert.True(t, outleter.OnEvent(data))
-	assertChanEmpty(t, pipe)
+	assert.Empty(t, pipe)
 
 	// event with message field but not a string
 	data = util.NewData()
@@ -74,17 +75,18 @@ func TestCollectorOutleterOnEvent(t *testing.T) {
 		},
 	}
 	assert.True(t, outleter.OnEvent(data))
-	assertChanEmpty(t, pipe)
+	assert.Empty(t, pipe)
 
-	// Properly formatted event
+	// Properly formatted event, along with the file it's from
 	data = util.NewData()
 	data.Event = beat.Event{
 		Fields: common.MapStr{
 			"message": "Hello, World",
 		},
 	}
+	data.SetState(file.State{Source: "/var/log/hello.log"})
 	assert.True(t, outleter.OnEvent(data))
-	assertChanMsg(t, pipe, "Hello, World")
+	assert.Equal(t, fileLine{text: "Hello, World", source: "/var/log/hello.log"}, <-pipe)
 }
 
 func TestCollectorProcessMatch(t *testing.T) {
@@ -149,8 +151,8 @@ func TestCollectorProcessTimeout(t *testing.T) {
 		},
 	}
 
-	collector.ticker = time.NewTicker(collector.config.Timeout.Interval)
-	collector.timeoutChannel = collector.ticker.C
+	collector.timeoutTimer = time.NewTimer(collector.config.Timeout.Interval)
+	collector.timeoutChannel = collector.timeoutTimer.C
 
 	collector.Pattern, _ = regexp.Compile("^Match")
 
@@ -204,8 +206,8 @@ func TestCollectorProcessTimeoutOnce(t *testing.T) {
 		},
 	}
 
-	collector.ticker = time.NewTicker(collector.config.Timeout.Interval)
-	collector.timeoutChannel = collector.ticker.C
+	collector.timeoutTimer = time.NewTimer(collector.config.Timeout.Interval)
+	collector.timeoutChannel = collector.timeoutTimer.C
 
 	collector.Pattern, _ = regexp.Compile("^Match")
 
@@ -350,3 +352,765 @@ func TestCollection(t *testing.T) {
 	collection.Stop()
 	collection.LetRun()
 }
+
+func TestCollectorProcessHealthy(t *testing.T) {
+	collector := Collector{
+		prospectorDone: make(chan struct{}),
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		Healthy:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+	}
+
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+
+	// Lines that don't match shouldn't make us healthy
+	collector.lines <- "NotAMatch"
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-collector.Healthy:
+		t.Error("Collector became healthy without a match")
+	default:
+	}
+
+	// Every match after the first shouldn't try to close the channel again
+	collector.lines <- "MatchIsWhatItIS"
+	collector.lines <- "MatchIsWhatItIS"
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-collector.Healthy:
+	default:
+		t.Error("Collector didn't become healthy after a match")
+	}
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCheckDependencies(t *testing.T) {
+	named := func(name string, dependsOn ...string) *Collector {
+		return &Collector{
+			config: CollectorConfig{
+				Name:      name,
+				DependsOn: dependsOn,
+			},
+		}
+	}
+
+	// A simple chain is fine
+	err := checkDependencies([]*Collector{named("a"), named("b", "a"), named("c", "a", "b")})
+	assert.Nil(t, err)
+
+	// Unknown dependencies
+	err = checkDependencies([]*Collector{named("a"), named("b", "z")})
+	assert.NotNil(t, err)
+
+	// Duplicated names
+	err = checkDependencies([]*Collector{named("a"), named("a")})
+	assert.NotNil(t, err)
+
+	// Cycles
+	err = checkDependencies([]*Collector{named("a", "c"), named("b", "a"), named("c", "b")})
+	assert.NotNil(t, err)
+	err = checkDependencies([]*Collector{named("a", "a")})
+	assert.NotNil(t, err)
+}
+
+func TestCollectorEnvironment(t *testing.T) {
+	collector := Collector{
+		config: CollectorConfig{
+			Labels: map[string]string{
+				"team":     "storage",
+				"env-type": "prod",
+			},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"LOGPULSE_LABEL_ENV_TYPE=prod",
+		"LOGPULSE_LABEL_TEAM=storage",
+	}, collector.environment(nil))
+
+	// Named groups come after the labels
+	assert.Equal(t, []string{
+		"LOGPULSE_LABEL_ENV_TYPE=prod",
+		"LOGPULSE_LABEL_TEAM=storage",
+		"LOGPULSE_GROUP_REQUEST_ID=1234",
+	}, collector.environment(map[string]string{"request_id": "1234"}))
+
+	// No labels, no variables
+	collector.config.Labels = nil
+	assert.Nil(t, collector.environment(nil))
+}
+
+func TestCollectorProcessLabels(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+
+	collector := Collector{
+		prospectorDone: make(chan struct{}),
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+
+		config: CollectorConfig{
+			Labels: map[string]string{"team": "storage"},
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", "echo $LOGPULSE_LABEL_TEAM > " + outputFile},
+			},
+		},
+	}
+
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "MatchIsWhatItIS"
+	time.Sleep(50 * time.Millisecond)
+
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "storage\n", string(output))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestContextEnvironment(t *testing.T) {
+	command := CommandConfig{Sanitize: SanitizeConfig{StripANSI: true}}
+	data := commandData{Line: "\x1b[31mERROR\x1b[0m disk full", File: "/var/log/app.log", Collector: "app"}
+	assert.Equal(t, []string{
+		"LOGPULSE_EVENT=match",
+		"LOGPULSE_COLLECTOR=app",
+		"LOGPULSE_LINE=ERROR disk full",
+		"LOGPULSE_FILE=/var/log/app.log",
+	}, contextEnvironment(MatchAction, command, data))
+
+	// Timeouts have no line
+	assert.Equal(t, []string{
+		"LOGPULSE_EVENT=timeout",
+		"LOGPULSE_COLLECTOR=app",
+	}, contextEnvironment(TimeoutAction, command, commandData{Collector: "app"}))
+
+	data = commandData{Collector: "app", Description: "The app stopped logging", RunbookURL: "https://wiki.example.com/app"}
+	assert.Equal(t, []string{
+		"LOGPULSE_EVENT=timeout",
+		"LOGPULSE_COLLECTOR=app",
+		"LOGPULSE_DESCRIPTION=The app stopped logging",
+		"LOGPULSE_RUNBOOK_URL=https://wiki.example.com/app",
+	}, contextEnvironment(TimeoutAction, command, data))
+}
+
+func TestCollectorProcessContextEnvironment(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	script := `echo "$LOGPULSE_EVENT $LOGPULSE_COLLECTOR $LOGPULSE_FILE $LOGPULSE_LINE $LOGPULSE_RUNBOOK_URL" >> ` + outputFile
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		fileLines:      make(chan fileLine),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: timeoutChannel,
+
+		config: CollectorConfig{
+			Name:       "app",
+			RunbookURL: "https://wiki.example.com/app",
+			Command:    CommandConfig{Program: "sh", Args: []string{"-c", script}},
+			Timeout:    TimeoutConfig{Command: CommandConfig{Program: "sh", Args: []string{"-c", script}}},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.fileLines <- fileLine{text: "Match here", source: "/var/log/app.log"}
+	time.Sleep(50 * time.Millisecond)
+	timeoutChannel <- time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "match app /var/log/app.log Match here https://wiki.example.com/app\ntimeout app   https://wiki.example.com/app\n", string(output))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+// matched is a shorthand for when we only care whether match matched
+func matched(collector *Collector, msg string) bool {
+	_, ok := collector.match(msg)
+	return ok
+}
+
+func TestCollectorMatch(t *testing.T) {
+	collector := &Collector{}
+	collector.Pattern, _ = regexp.Compile("INFO heartbeat")
+
+	assert.True(t, matched(collector, "INFO heartbeat"))
+	assert.True(t, matched(collector, "INFO heartbeat during replay"))
+	assert.False(t, matched(collector, "WARN heartbeat"))
+
+	// Exclusions win over the pattern
+	collector.ExcludePattern, _ = regexp.Compile("replay")
+	assert.True(t, matched(collector, "INFO heartbeat"))
+	assert.False(t, matched(collector, "INFO heartbeat during replay"))
+	assert.False(t, matched(collector, "WARN heartbeat"))
+}
+
+func TestShutdownOrder(t *testing.T) {
+	prioritized := func(name string, priority int) *Collector {
+		return &Collector{
+			config: CollectorConfig{
+				Name:     name,
+				Priority: priority,
+			},
+		}
+	}
+
+	collectors := []*Collector{
+		prioritized("critical", 10),
+		prioritized("a", 0),
+		prioritized("noise", -5),
+		prioritized("b", 0),
+	}
+
+	var names []string
+	for _, c := range shutdownOrder(collectors) {
+		names = append(names, c.config.Name)
+	}
+	assert.Equal(t, []string{"noise", "a", "b", "critical"}, names)
+
+	// The original order is left alone
+	assert.Equal(t, "critical", collectors[0].config.Name)
+}
+
+func TestCollectorMatchCondition(t *testing.T) {
+	collector := &Collector{}
+	collector.Pattern, _ = regexp.Compile(`status=(?P<status>\d+) latency=(?P<latency_ms>\d+)`)
+	collector.Condition, _ = ParseCondition("status >= 500 && latency_ms > 1000")
+
+	assert.True(t, matched(collector, "status=503 latency=1500"))
+	assert.False(t, matched(collector, "status=200 latency=1500"))
+	assert.False(t, matched(collector, "status=503 latency=20"))
+	assert.False(t, matched(collector, "nothing to see here"))
+
+	groups, ok := collector.match("status=503 latency=1500")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"status": "503", "latency_ms": "1500"}, groups)
+}
+
+func TestCollectorMatchGroups(t *testing.T) {
+	collector := &Collector{}
+	collector.Pattern, _ = regexp.Compile(`^ERROR (\w+) request=(?P<request_id>\d+)`)
+
+	groups, ok := collector.match("ERROR Timeout request=1234")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"request_id": "1234"}, groups)
+
+	// No named groups, no map
+	collector.Pattern, _ = regexp.Compile(`^ERROR (\w+)`)
+	groups, ok = collector.match("ERROR Timeout request=1234")
+	assert.True(t, ok)
+	assert.Nil(t, groups)
+}
+
+func TestCollectorProcessClockJump(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+
+	run := func(policy string) {
+		collector := Collector{
+			prospectorDone: make(chan struct{}),
+			lines:          make(chan string),
+			Done:           make(chan struct{}),
+			Stopped:        make(chan struct{}),
+			clockJumps:     make(chan time.Duration),
+
+			config: CollectorConfig{
+				Timeout: TimeoutConfig{
+					Interval: 1 * time.Hour,
+					Command: CommandConfig{
+						Program: "touch",
+						Args:    []string{touchedFile},
+					},
+					ClockJump: policy,
+				},
+			},
+		}
+
+		collector.timeoutTimer = time.NewTimer(collector.config.Timeout.Interval)
+		collector.timeoutChannel = collector.timeoutTimer.C
+		collector.Pattern, _ = regexp.Compile("^Match")
+
+		go collector.process()
+		collector.clockJumps <- 1 * time.Hour
+		time.Sleep(10 * time.Millisecond)
+		close(collector.Done)
+		<-collector.Stopped
+		collector.timeoutTimer.Stop()
+	}
+
+	// Resetting shouldn't run anything
+	run(ClockJumpReset)
+	assertFileDoesNotExist(t, touchedFile)
+
+	// But firing should
+	run(ClockJumpFire)
+	assertFileExists(t, touchedFile)
+}
+
+func TestCollectorThresholdReached(t *testing.T) {
+	collector := Collector{}
+
+	// No threshold means every match counts
+	now := time.Now()
+	assert.True(t, collector.thresholdReached(now))
+
+	collector.config.Threshold = ThresholdConfig{Count: 3, Window: 30 * time.Second}
+
+	assert.False(t, collector.thresholdReached(now))
+	assert.False(t, collector.thresholdReached(now.Add(10*time.Second)))
+	// The first match falls out of the window so we're still one short
+	assert.False(t, collector.thresholdReached(now.Add(31*time.Second)))
+	assert.True(t, collector.thresholdReached(now.Add(35*time.Second)))
+
+	// We start counting from scratch once the threshold is reached
+	assert.False(t, collector.thresholdReached(now.Add(36*time.Second)))
+	assert.False(t, collector.thresholdReached(now.Add(37*time.Second)))
+	assert.True(t, collector.thresholdReached(now.Add(38*time.Second)))
+}
+
+func TestCollectorProcessRate(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	rateChannel := make(chan time.Time)
+
+	collector := Collector{
+		prospectorDone: make(chan struct{}),
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+		rateChannel:    rateChannel,
+
+		config: CollectorConfig{
+			Rate: RateConfig{
+				Window: 1 * time.Second,
+				Above:  2,
+				Command: CommandConfig{
+					Program: "sh",
+					Args:    []string{"-c", "echo $LOGPULSE_RATE_STATE $LOGPULSE_RATE >> " + outputFile},
+				},
+			},
+		},
+	}
+
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+
+	// Within the limit
+	collector.lines <- "MatchIsWhatItIS"
+	rateChannel <- time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assertFileDoesNotExist(t, outputFile)
+
+	// Over the limit
+	for i := 0; i < 3; i++ {
+		collector.lines <- "MatchIsWhatItIS"
+	}
+	rateChannel <- time.Now()
+	time.Sleep(50 * time.Millisecond)
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "above 3\n", string(output))
+
+	// Staying over the limit shouldn't run the command again
+	for i := 0; i < 3; i++ {
+		collector.lines <- "MatchIsWhatItIS"
+	}
+	rateChannel <- time.Now()
+	time.Sleep(50 * time.Millisecond)
+	output, _ = ioutil.ReadFile(outputFile)
+	assert.Equal(t, "above 3\n", string(output))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCollectorProcessResume(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+	timeoutChannel := make(chan time.Time)
+
+	collector := Collector{
+		prospectorDone: make(chan struct{}),
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		resumed:        make(chan time.Duration),
+		timeoutChannel: timeoutChannel,
+
+		config: CollectorConfig{
+			Timeout: TimeoutConfig{
+				Interval: 50 * time.Millisecond,
+				Command: CommandConfig{
+					Program: "touch",
+					Args:    []string{touchedFile},
+				},
+			},
+		},
+	}
+
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+
+	// Timeouts during the grace period are ignored
+	collector.resumed <- 100 * time.Millisecond
+	timeoutChannel <- time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assertFileDoesNotExist(t, touchedFile)
+
+	// But not after it
+	time.Sleep(100 * time.Millisecond)
+	timeoutChannel <- time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assertFileExists(t, touchedFile)
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCollectorProcessTimeoutMisses(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+	timeoutChannel := make(chan time.Time)
+
+	collector := Collector{
+		prospectorDone: make(chan struct{}),
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: timeoutChannel,
+
+		config: CollectorConfig{
+			Timeout: TimeoutConfig{
+				Interval: 50 * time.Millisecond,
+				Misses:   3,
+				Command: CommandConfig{
+					Program: "touch",
+					Args:    []string{touchedFile},
+				},
+			},
+		},
+	}
+
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+
+	// Two misses followed by a match start the count again
+	timeoutChannel <- time.Now()
+	timeoutChannel <- time.Now()
+	collector.lines <- "MatchIsWhatItIS"
+	timeoutChannel <- time.Now()
+	timeoutChannel <- time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assertFileDoesNotExist(t, touchedFile)
+
+	// The third miss in a row fires
+	timeoutChannel <- time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assertFileExists(t, touchedFile)
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCompilePattern(t *testing.T) {
+	pattern, err := compilePattern("^error", "")
+	assert.Nil(t, err)
+	assert.False(t, pattern.MatchString("ERROR: disk full"))
+
+	pattern, err = compilePattern("^error", "i")
+	assert.Nil(t, err)
+	assert.True(t, pattern.MatchString("ERROR: disk full"))
+
+	pattern, err = compilePattern("^error.*full$", "ims")
+	assert.Nil(t, err)
+	assert.True(t, pattern.MatchString("first line\nERROR: disk\nfull"))
+
+	assert.Nil(t, validatePatternFlags("imsU"))
+	assert.NotNil(t, validatePatternFlags("x"))
+}
+
+func TestCollectorMatchSubstring(t *testing.T) {
+	collector := Collector{
+		Pattern:        substringMatcher("heartbeat"),
+		ExcludePattern: prefixMatcher("DEBUG"),
+	}
+
+	assert.True(t, matched(&collector, "INFO heartbeat"))
+	assert.False(t, matched(&collector, "DEBUG heartbeat"))
+	assert.False(t, matched(&collector, "INFO started"))
+}
+
+func TestCollectorSuppressed(t *testing.T) {
+	collector := Collector{}
+	now := time.Now()
+
+	// Nothing is suppressed without suppress_for
+	collector.stats.LastCommand = now
+	assert.False(t, collector.suppressed(now))
+
+	collector.config.SuppressFor = time.Minute
+	assert.True(t, collector.suppressed(now.Add(30*time.Second)))
+	assert.False(t, collector.suppressed(now.Add(time.Minute)))
+
+	// Or before the command has ever run
+	collector.stats.LastCommand = time.Time{}
+	assert.False(t, collector.suppressed(now))
+}
+
+func TestCollectorSampled(t *testing.T) {
+	collector := Collector{}
+	for i := 0; i < 5; i++ {
+		assert.True(t, collector.sampled())
+	}
+
+	collector.config.SampleRate = 0.25
+	var sampled []bool
+	for i := 0; i < 8; i++ {
+		sampled = append(sampled, collector.sampled())
+	}
+	assert.Equal(t, []bool{false, false, false, true, false, false, false, true}, sampled)
+
+	collector.config.SampleRate = 0.1
+	collector.sampleCredit = 0
+	count := 0
+	for i := 0; i < 1000; i++ {
+		if collector.sampled() {
+			count++
+		}
+	}
+	assert.Equal(t, 100, count)
+}
+
+func TestCollectorProcessReport(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	reportFile := filepath.Join(tmpDir, "report")
+	reportChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+		reportChannel:  reportChannel,
+
+		config: CollectorConfig{
+			Report: ReportConfig{
+				Interval: time.Minute,
+				Command: CommandConfig{
+					Program: "sh",
+					Args:    []string{"-c", `echo "$LOGPULSE_COUNT $LOGPULSE_INTERVAL" >> ` + reportFile},
+				},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "NotAMatch"
+	collector.lines <- "Match"
+	reportChannel <- time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	// Empty intervals are reported too
+	reportChannel <- time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	content, err := ioutil.ReadFile(reportFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "2 1m0s\n0 1m0s\n", string(content))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCollectorProcessMatchOnce(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	matchFile := filepath.Join(tmpDir, "matches")
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: timeoutChannel,
+
+		config: CollectorConfig{
+			MatchOnce: true,
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", "echo match >> " + matchFile},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	// Only the first match runs the command
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+
+	// Until a timeout resets it
+	timeoutChannel <- time.Now()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+
+	content, err := ioutil.ReadFile(matchFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "match\nmatch\n", string(content))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCollectionExitOnMatch(t *testing.T) {
+	exits := make(chan int, 1)
+	watching := func(name string, exitOnMatch bool, timeoutChannel chan time.Time) *Collector {
+		c := &Collector{
+			lines:          make(chan string),
+			Done:           make(chan struct{}),
+			Stopped:        make(chan struct{}),
+			timeoutChannel: timeoutChannel,
+			statsRequests:  make(chan chan CollectorStats),
+			input:          fakeInput{},
+			config:         CollectorConfig{Name: name, ExitOnMatch: exitOnMatch},
+		}
+		if exitOnMatch {
+			c.exits = exits
+		}
+		c.Pattern, _ = regexp.Compile("^started")
+		return c
+	}
+
+	waiting := watching("waiting", true, make(chan time.Time))
+	other := watching("other", false, make(chan time.Time))
+	collection := Collection{
+		collectors: []*Collector{other, waiting},
+		done:       make(chan struct{}),
+		started:    make(map[*Collector]bool),
+		exits:      exits,
+	}
+	collection.Start()
+
+	// Collectors without exit_on_match don't stop anything
+	other.lines <- "started"
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-collection.done:
+		t.Error("Expected the collection to keep running")
+	default:
+	}
+
+	waiting.lines <- "started"
+	collection.LetRun()
+	assert.Equal(t, ExitMatched, collection.ExitCode)
+
+	// Being stopped again, by a signal say, is fine
+	collection.Stop()
+}
+
+func TestCollectionExitOnTimeout(t *testing.T) {
+	exits := make(chan int, 1)
+	timeoutChannel := make(chan time.Time)
+	waiting := &Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: timeoutChannel,
+		statsRequests:  make(chan chan CollectorStats),
+		input:          fakeInput{},
+		exits:          exits,
+		config:         CollectorConfig{Name: "waiting", ExitOnMatch: true},
+	}
+	waiting.Pattern, _ = regexp.Compile("^started")
+
+	collection := Collection{
+		collectors: []*Collector{waiting},
+		done:       make(chan struct{}),
+		started:    make(map[*Collector]bool),
+		exits:      exits,
+	}
+	collection.Start()
+
+	timeoutChannel <- time.Now()
+	collection.LetRun()
+	assert.Equal(t, ExitTimedOut, collection.ExitCode)
+}
+
+func TestCollectorProcessMatchAfterTimeout(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	matchFile := filepath.Join(tmpDir, "matches")
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: timeoutChannel,
+
+		config: CollectorConfig{
+			MatchAfterTimeout: true,
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", "echo $0 >> " + matchFile, "recovered"},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	// Matches while the pattern is steady don't run the command
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+	assertFileDoesNotExist(t, matchFile)
+
+	// Only the first one after a timeout does
+	timeoutChannel <- time.Now()
+	timeoutChannel <- time.Now()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+
+	content, err := ioutil.ReadFile(matchFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "recovered\n", string(content))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
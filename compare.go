@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// A collector's "compare" gates its matches on numbers pulled out of the line, for the
+// things a regular expression can't say, like "latency above 500ms". Each comparison takes
+// its number from a named group in the pattern or from a field of lines that are JSON
+// objects, the same as a severity, and a line only counts as a match if it matches the
+// pattern and every comparison holds. Lines where the value is missing or isn't a number
+// don't match.
+
+// validateComparisons checks a collector's comparisons against its pattern
+func validateComparisons(comparisons []ComparisonConfig, pattern Matcher) error {
+	for _, comparison := range comparisons {
+		if (comparison.Group == "") == (comparison.Field == "") {
+			return errors.New("A comparison needs either a group or a field")
+		}
+
+		switch comparison.Op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("Unknown comparison op %q, expected ==, !=, <, <=, > or >=", comparison.Op)
+		}
+
+		if comparison.Group != "" {
+			regex, ok := pattern.(*regexp.Regexp)
+			if !ok || !hasGroup(regex, comparison.Group) {
+				return fmt.Errorf("The comparison group %s isn't a named group in the pattern", comparison.Group)
+			}
+		}
+	}
+	return nil
+}
+
+// compare reports whether a line satisfies every one of a collector's comparisons
+func compare(comparisons []ComparisonConfig, line string, groups map[string]string) bool {
+	for _, comparison := range comparisons {
+		var value interface{}
+		if comparison.Group != "" {
+			value = groups[comparison.Group]
+		} else {
+			var ok bool
+			if value, ok = jsonField(line, comparison.Field); !ok {
+				return false
+			}
+		}
+
+		number, ok := asNumber(value)
+		if !ok {
+			return false
+		}
+		if holds, _ := compareValues(comparison.Op, number, comparison.Value); !holds {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateComparisons(t *testing.T) {
+	pattern := regexp.MustCompile(`latency=(?P<latency_ms>\d+)`)
+
+	assert.Nil(t, validateComparisons([]ComparisonConfig{
+		{Group: "latency_ms", Op: ">", Value: 500},
+		{Field: "status", Op: ">=", Value: 500},
+	}, pattern))
+
+	invalid := []ComparisonConfig{
+		{Op: ">", Value: 500},
+		{Group: "latency_ms", Field: "latency", Op: ">", Value: 500},
+		{Group: "latency_ms", Op: "=>", Value: 500},
+		{Group: "missing", Op: ">", Value: 500},
+	}
+	for _, comparison := range invalid {
+		assert.NotNil(t, validateComparisons([]ComparisonConfig{comparison}, pattern))
+	}
+
+	// Groups need a regular expression
+	assert.NotNil(t, validateComparisons([]ComparisonConfig{{Group: "latency_ms", Op: ">"}}, substringMatcher("latency")))
+}
+
+func TestCompare(t *testing.T) {
+	groups := map[string]string{"latency_ms": "750", "path": "/health"}
+	assert.True(t, compare(nil, "", groups))
+	assert.True(t, compare([]ComparisonConfig{{Group: "latency_ms", Op: ">", Value: 500}}, "", groups))
+	assert.False(t, compare([]ComparisonConfig{{Group: "latency_ms", Op: "<=", Value: 500}}, "", groups))
+
+	// Every comparison has to hold
+	assert.False(t, compare([]ComparisonConfig{
+		{Group: "latency_ms", Op: ">", Value: 500},
+		{Group: "latency_ms", Op: "<", Value: 600},
+	}, "", groups))
+
+	// Values that aren't numbers never match
+	assert.False(t, compare([]ComparisonConfig{{Group: "path", Op: "!=", Value: 0}}, "", groups))
+
+	line := `{"http": {"status": 503}, "user": "bob"}`
+	assert.True(t, compare([]ComparisonConfig{{Field: "http.status", Op: ">=", Value: 500}}, line, nil))
+	assert.False(t, compare([]ComparisonConfig{{Field: "http.status", Op: "==", Value: 200}}, line, nil))
+	assert.False(t, compare([]ComparisonConfig{{Field: "http.latency", Op: ">", Value: 0}}, line, nil))
+	assert.False(t, compare([]ComparisonConfig{{Field: "user", Op: ">", Value: 0}}, line, nil))
+	assert.False(t, compare([]ComparisonConfig{{Field: "http.status", Op: ">", Value: 0}}, "not json", nil))
+}
+
+func TestCollectorMatchCompare(t *testing.T) {
+	collector, err := newCollector(CollectorConfig{
+		Pattern: `latency=(?P<latency_ms>\d+)`,
+		Compare: []ComparisonConfig{{Group: "latency_ms", Op: ">", Value: 500}},
+	})
+	assert.Nil(t, err)
+
+	_, ok := collector.match("GET / latency=750")
+	assert.True(t, ok)
+	_, ok = collector.match("GET / latency=20")
+	assert.False(t, ok)
+}
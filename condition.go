@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a small boolean expression evaluated against the fields extracted from a
+// matching line (the named groups of a collector's pattern). It lets users express things
+// regular expressions can't, like numeric thresholds:
+//
+//	status >= 500 && latency_ms > 1000
+//
+// The language is deliberately tiny: comparisons (==, !=, <, <=, >, >=) between fields and
+// number or quoted string literals, combined with &&, || and ! and grouped with parentheses.
+// Comparisons are numeric whenever both sides look like numbers and fall back to comparing
+// strings otherwise.
+type Condition struct {
+	expression string
+	root       conditionNode
+}
+
+// ParseCondition compiles an expression into a Condition
+func ParseCondition(expression string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := conditionParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.peek().kind != tokenEnd {
+		return nil, fmt.Errorf("Unexpected %q in condition", parser.peek().text)
+	}
+
+	return &Condition{
+		expression: expression,
+		root:       root,
+	}, nil
+}
+
+// Evaluate runs the condition against a set of fields. Referring to a field that doesn't exist
+// or using a value as the wrong type is an error.
+func (condition *Condition) Evaluate(fields map[string]string) (bool, error) {
+	value, err := condition.root.evaluate(fields)
+	if err != nil {
+		return false, err
+	}
+	return asBool(value)
+}
+
+func (condition *Condition) String() string {
+	return condition.expression
+}
+
+// The kinds of tokens our expressions are made up of
+const (
+	tokenEnd = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type conditionToken struct {
+	kind int
+	text string
+}
+
+// tokenizeCondition splits an expression up into tokens
+func tokenizeCondition(expression string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(' || r == ')':
+			kind := tokenOpen
+			if r == ')' {
+				kind = tokenClose
+			}
+			tokens = append(tokens, conditionToken{kind, string(r)})
+			i++
+
+		case r == '"' || r == '\'':
+			// Quoted strings, with backslash escaping the next character
+			var value []rune
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				value = append(value, runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string in condition: %s", expression)
+			}
+			tokens = append(tokens, conditionToken{tokenString, string(value)})
+			i = j + 1
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, conditionToken{tokenNumber, string(runes[i:j])})
+			i = j
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, conditionToken{tokenIdent, string(runes[i:j])})
+			i = j
+
+		default:
+			// Operators, longest first so "<=" isn't read as "<" followed by "="
+			matched := false
+			for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, conditionToken{tokenOperator, op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("Unexpected character %q in condition: %s", r, expression)
+			}
+		}
+	}
+
+	return append(tokens, conditionToken{kind: tokenEnd}), nil
+}
+
+// conditionParser is a plain recursive descent parser over our tokens. From loosest to
+// tightest binding the grammar is:
+//
+//	or         := and ("||" and)*
+//	and        := unary ("&&" unary)*
+//	unary      := "!" unary | comparison
+//	comparison := primary (("==" | "!=" | "<" | "<=" | ">" | ">=") primary)?
+//	primary    := number | string | "true" | "false" | field | "(" or ")"
+type conditionParser struct {
+	tokens   []conditionToken
+	position int
+}
+
+func (parser *conditionParser) peek() conditionToken {
+	return parser.tokens[parser.position]
+}
+
+func (parser *conditionParser) next() conditionToken {
+	token := parser.tokens[parser.position]
+	if token.kind != tokenEnd {
+		parser.position++
+	}
+	return token
+}
+
+func (parser *conditionParser) parseOr() (conditionNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek().kind == tokenOperator && parser.peek().text == "||" {
+		parser.next()
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek().kind == tokenOperator && parser.peek().text == "&&" {
+		parser.next()
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *conditionParser) parseUnary() (conditionNode, error) {
+	if parser.peek().kind == tokenOperator && parser.peek().text == "!" {
+		parser.next()
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return parser.parseComparison()
+}
+
+func (parser *conditionParser) parseComparison() (conditionNode, error) {
+	left, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	token := parser.peek()
+	if token.kind == tokenOperator {
+		switch token.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			parser.next()
+			right, err := parser.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return comparisonNode{op: token.text, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (parser *conditionParser) parsePrimary() (conditionNode, error) {
+	token := parser.next()
+	switch token.kind {
+	case tokenNumber:
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %q in condition", token.text)
+		}
+		return literalNode{value: number}, nil
+	case tokenString:
+		return literalNode{value: token.text}, nil
+	case tokenIdent:
+		switch token.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		}
+		return fieldNode{name: token.text}, nil
+	case tokenOpen:
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if parser.next().kind != tokenClose {
+			return nil, fmt.Errorf("Missing closing parenthesis in condition")
+		}
+		return node, nil
+	case tokenEnd:
+		return nil, fmt.Errorf("Unexpected end of condition")
+	}
+	return nil, fmt.Errorf("Unexpected %q in condition", token.text)
+}
+
+// conditionNode is one piece of a parsed expression. Evaluating it results in a float64,
+// string or bool.
+type conditionNode interface {
+	evaluate(fields map[string]string) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (node literalNode) evaluate(fields map[string]string) (interface{}, error) {
+	return node.value, nil
+}
+
+type fieldNode struct {
+	name string
+}
+
+func (node fieldNode) evaluate(fields map[string]string) (interface{}, error) {
+	value, ok := fields[node.name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown field %s", node.name)
+	}
+	return value, nil
+}
+
+type notNode struct {
+	operand conditionNode
+}
+
+func (node notNode) evaluate(fields map[string]string) (interface{}, error) {
+	value, err := node.operand.evaluate(fields)
+	if err != nil {
+		return nil, err
+	}
+	b, err := asBool(value)
+	return !b, err
+}
+
+type logicalNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (node logicalNode) evaluate(fields map[string]string) (interface{}, error) {
+	value, err := node.left.evaluate(fields)
+	if err != nil {
+		return nil, err
+	}
+	left, err := asBool(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short circuit just like Go would
+	if node.op == "&&" && !left {
+		return false, nil
+	}
+	if node.op == "||" && left {
+		return true, nil
+	}
+
+	value, err = node.right.evaluate(fields)
+	if err != nil {
+		return nil, err
+	}
+	return asBool(value)
+}
+
+type comparisonNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (node comparisonNode) evaluate(fields map[string]string) (interface{}, error) {
+	left, err := node.left.evaluate(fields)
+	if err != nil {
+		return nil, err
+	}
+	right, err := node.right.evaluate(fields)
+	if err != nil {
+		return nil, err
+	}
+	return compareValues(node.op, left, right)
+}
+
+// compareValues compares two values numerically if both of them look like numbers and as
+// strings otherwise
+func compareValues(op string, left, right interface{}) (bool, error) {
+	leftNumber, leftOk := asNumber(left)
+	rightNumber, rightOk := asNumber(right)
+	if leftOk && rightOk {
+		switch op {
+		case "==":
+			return leftNumber == rightNumber, nil
+		case "!=":
+			return leftNumber != rightNumber, nil
+		case "<":
+			return leftNumber < rightNumber, nil
+		case "<=":
+			return leftNumber <= rightNumber, nil
+		case ">":
+			return leftNumber > rightNumber, nil
+		case ">=":
+			return leftNumber >= rightNumber, nil
+		}
+	}
+
+	leftString := fmt.Sprint(left)
+	rightString := fmt.Sprint(right)
+	switch op {
+	case "==":
+		return leftString == rightString, nil
+	case "!=":
+		return leftString != rightString, nil
+	case "<":
+		return leftString < rightString, nil
+	case "<=":
+		return leftString <= rightString, nil
+	case ">":
+		return leftString > rightString, nil
+	case ">=":
+		return leftString >= rightString, nil
+	}
+	return false, fmt.Errorf("Unknown operator %s", op)
+}
+
+// asNumber converts numbers, and strings holding numbers, to a float64
+func asNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func asBool(value interface{}) (bool, error) {
+	if b, ok := value.(bool); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("Expected a true or false value but got %v", value)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCondition(t *testing.T) {
+	fields := map[string]string{
+		"status":     "503",
+		"latency_ms": "1500",
+		"method":     "GET",
+		"path":       "/health",
+	}
+
+	tests := map[string]bool{
+		"status >= 500":                            true,
+		"status >= 500 && latency_ms > 1000":       true,
+		"status >= 500 && latency_ms > 2000":       false,
+		"status < 500 || latency_ms > 1000":        true,
+		"!(status < 500)":                          true,
+		"method == 'GET'":                          true,
+		`method != "GET"`:                          false,
+		"path == '/health' && !(method == 'POST')": true,
+		"latency_ms > -1":                          true,
+		"status == 503.0":                          true,
+		"true && !false":                           true,
+		"(status >= 500 || method == 'POST') && latency_ms <= 1500": true,
+	}
+
+	for expression, expected := range tests {
+		condition, err := ParseCondition(expression)
+		assert.Nil(t, err, expression)
+		if err != nil {
+			continue
+		}
+		result, err := condition.Evaluate(fields)
+		assert.Nil(t, err, expression)
+		assert.Equal(t, expected, result, expression)
+	}
+}
+
+func TestConditionEvaluationErrors(t *testing.T) {
+	// Unknown fields
+	condition, _ := ParseCondition("missing > 5")
+	_, err := condition.Evaluate(map[string]string{})
+	assert.NotNil(t, err)
+
+	// Fields aren't booleans
+	condition, _ = ParseCondition("status && true")
+	_, err = condition.Evaluate(map[string]string{"status": "200"})
+	assert.NotNil(t, err)
+}
+
+func TestConditionParseErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"status >",
+		"(status > 5",
+		"status > 5)",
+		"status = 5",
+		"method == 'GET",
+		"status > 5 latency",
+	} {
+		_, err := ParseCondition(expression)
+		assert.NotNil(t, err, expression)
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/elastic/beats/filebeat/harvester"
@@ -38,32 +42,482 @@ import (
 // This way, we can configure both our own system and FileBeats with the same YAML. Maybe hopefully...
 
 // CommandConfig contains the required arguments for executing a command
-// on the system.
+// on the system. With Shell, Program is a shell script run by /bin/sh -c
+// and Args are its positional parameters ($1, $2, ...). Dir is the
+// directory the command runs in, ours if it's empty. Instead of a program
+// a command can have a Systemd unit to restart or reload, see systemd.go,
+// a Metric to send, see metric.go, a file to Touch, write or append to,
+// see fileaction.go, a Signal to send, see signal.go, a GRPC method to
+// call, see grpc.go, or an SNS topic to publish to or a Lambda function to
+// invoke, see aws.go.
 type CommandConfig struct {
-	Program string   `config:"program"`
-	Args    []string `config:"args"`
+	Program    string            `config:"program"`
+	Systemd    SystemdConfig     `config:"systemd"`
+	Metric     MetricConfig      `config:"metric"`
+	Touch      string            `config:"touch"`
+	WriteFile  FileContentConfig `config:"write_file"`
+	AppendFile FileContentConfig `config:"append_file"`
+	Signal     SignalConfig      `config:"signal"`
+	GRPC       GRPCConfig        `config:"grpc"`
+	SNS        SNSConfig         `config:"sns"`
+	Lambda     LambdaConfig      `config:"lambda"`
+	Args       []string          `config:"args"`
+	Shell      bool              `config:"shell"`
+	Dir        string            `config:"dir"`
+	Sanitize   SanitizeConfig    `config:"sanitize"`
+	Output     string            `config:"output"`
+	Cooldown   time.Duration     `config:"cooldown"`
+	Timeout    time.Duration     `config:"timeout"`
+	Fallback   *CommandConfig    `config:"fallback"`
+
+	// What's written to the command's stdin, for batches
+	stdin string
+	// Where the output of a program is kept for the audit log, nil for nowhere
+	capture *outputCapture
 }
 
-// Cmd creates an exec.Cmd from the configured command
-func (commandConfig CommandConfig) Cmd() *exec.Cmd {
-	return exec.Command(commandConfig.Program, commandConfig.Args...)
+func (commandConfig CommandConfig) String() string {
+	if commandConfig.Systemd.Unit != "" {
+		return "systemd " + commandConfig.Systemd.action() + " " + commandConfig.Systemd.Unit
+	}
+	if commandConfig.Metric.Name != "" {
+		return "metric " + commandConfig.Metric.String()
+	}
+	if action, path, _ := commandConfig.fileAction(); action != "" {
+		return action + " " + path
+	}
+	if commandConfig.Signal.configured() {
+		return "signal " + commandConfig.Signal.String()
+	}
+	if commandConfig.GRPC.Address != "" {
+		return "grpc " + commandConfig.GRPC.String()
+	}
+	if commandConfig.SNS.TopicARN != "" {
+		return "sns " + commandConfig.SNS.TopicARN
+	}
+	if commandConfig.Lambda.Function != "" {
+		return "lambda " + commandConfig.Lambda.Function
+	}
+	return strings.Join(append([]string{commandConfig.Program}, commandConfig.Args...), " ")
 }
 
+// configured reports whether there's anything to run
+func (commandConfig CommandConfig) configured() bool {
+	return len(commandConfig.kinds()) > 0
+}
+
+// kinds lists what the command does: run a program, restart a systemd unit and so on. A
+// command should only ever do one of them.
+func (commandConfig CommandConfig) kinds() []string {
+	var kinds []string
+	for _, kind := range []struct {
+		name string
+		set  bool
+	}{
+		{"program", commandConfig.Program != ""},
+		{"systemd", commandConfig.Systemd.Unit != ""},
+		{"metric", commandConfig.Metric.Name != ""},
+		{FileTouch, commandConfig.Touch != ""},
+		{FileWrite, commandConfig.WriteFile.Path != ""},
+		{FileAppend, commandConfig.AppendFile.Path != ""},
+		{"signal", commandConfig.Signal.configured()},
+		{"grpc", commandConfig.GRPC.Address != ""},
+		{"sns", commandConfig.SNS.TopicARN != ""},
+		{"lambda", commandConfig.Lambda.Function != ""},
+	} {
+		if kind.set {
+			kinds = append(kinds, kind.name)
+		}
+	}
+	return kinds
+}
+
+// SystemdConfig restarts or reloads Unit through systemd, Action being
+// "restart" (the default) or "reload"
+type SystemdConfig struct {
+	Unit   string `config:"unit"`
+	Action string `config:"action"`
+}
+
+// MetricConfig sends a counter or gauge called Name to a statsd server
+// listening on the Statsd address or to the Pushgateway at the Pushgateway
+// URL. Type is "counter" (the default) or "gauge" and Value, a number or a
+// template expanding to one, defaults to 1. TLS applies to an https
+// Pushgateway.
+type MetricConfig struct {
+	Statsd      string    `config:"statsd"`
+	Pushgateway string    `config:"pushgateway"`
+	Name        string    `config:"name"`
+	Type        string    `config:"type"`
+	Value       string    `config:"value"`
+	TLS         TLSConfig `config:"tls"`
+}
+
+// SignalConfig sends the signal called Name ("HUP" by default, with or
+// without a "SIG") to the process whose pid is in Pidfile or to every
+// process named Process
+type SignalConfig struct {
+	Name    string `config:"name"`
+	Pidfile string `config:"pidfile"`
+	Process string `config:"process"`
+}
+
+// GRPCConfig calls Method ("/logpulse.Pulse/Event" by default) of the gRPC
+// server at Address, a host:port, over TLS. The TLS settings sit alongside
+// the address rather than in a block of their own.
+type GRPCConfig struct {
+	Address   string `config:"address"`
+	Method    string `config:"method"`
+	TLSConfig `config:",inline"`
+}
+
+// TLSConfig is how a network input, output or action sets up TLS, see tls.go.
+// CA is the PEM file of the certificates to trust instead of the system's,
+// Cert and Key a client certificate, MinVersion "1.0", "1.1" or "1.2" and
+// ServerName the name to expect on the server's certificate if it isn't the
+// host being connected to.
+type TLSConfig struct {
+	CA                 string `config:"ca"`
+	Cert               string `config:"cert"`
+	Key                string `config:"key"`
+	InsecureSkipVerify bool   `config:"insecure_skip_verify"`
+	MinVersion         string `config:"min_version"`
+	ServerName         string `config:"server_name"`
+}
+
+// SNSConfig publishes to the SNS topic TopicARN, with Subject for the
+// topic's email subscribers. Region defaults to the topic's.
+type SNSConfig struct {
+	TopicARN string `config:"topic_arn"`
+	Subject  string `config:"subject"`
+	Region   string `config:"region"`
+}
+
+// LambdaConfig invokes the Lambda Function, a name or ARN, waiting for it to
+// return unless Async is set. Region defaults to the function's, if it's an
+// ARN, or the usual AWS settings.
+type LambdaConfig struct {
+	Function string `config:"function"`
+	Async    bool   `config:"async"`
+	Region   string `config:"region"`
+}
+
+// FileContentConfig writes or appends Content, which can be a template, to
+// the file at Path
+type FileContentConfig struct {
+	Path    string `config:"path"`
+	Content string `config:"content"`
+}
+
+// SanitizeConfig cleans up the text taken from a line before it's handed to
+// a command, see sanitize.go. Mask replaces the matches of Pattern with
+// Replacement, or "***" if it's empty.
+type SanitizeConfig struct {
+	StripANSI          bool         `config:"strip_ansi"`
+	Mask               []MaskConfig `config:"mask"`
+	CollapseWhitespace bool         `config:"collapse_whitespace"`
+	Truncate           int          `config:"truncate"`
+}
+
+// MaskConfig is one of a SanitizeConfig's masks
+type MaskConfig struct {
+	Pattern     string `config:"pattern"`
+	Replacement string `config:"replacement"`
+}
+
+// commandWaitDelay is how long we wait for a command's output once it's exited or been killed
+const commandWaitDelay = time.Second
+
+// Cmd creates an exec.Cmd from the configured command. The command inherits our
+// environment along with any extra "KEY=value" variables in env.
+func (commandConfig CommandConfig) Cmd(env []string) *exec.Cmd {
+	program, args := commandConfig.Program, commandConfig.Args
+	if commandConfig.Shell {
+		// The first argument after the script is the shell's $0
+		program, args = "/bin/sh", append([]string{"-c", commandConfig.Program, "log-pulse"}, args...)
+	}
+	cmd := exec.Command(program, args...)
+	cmd.Dir = commandConfig.Dir
+	if commandConfig.Timeout > 0 {
+		// So that killing it when it times out kills whatever it started too, which would
+		// otherwise keep us waiting on the output it holds open
+		setProcessGroup(cmd)
+	}
+	if commandConfig.stdin != "" {
+		cmd.Stdin = strings.NewReader(commandConfig.stdin)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+var (
+	// ExecDisabled stops every configured command from being run, no matter what the config
+	// file says. It's set by the --no-exec flag for environments where log-pulse should only
+	// ever observe.
+	ExecDisabled = false
+
+	// DryRun turns every collector into a canary for good, see canary.go. It's set by the
+	// --dry-run flag to try a new configuration out against production logs.
+	DryRun = false
+
+	// ErrExecDisabled is returned when asked to run a command while ExecDisabled is set
+	ErrExecDisabled = errors.New("Command execution is disabled")
+)
+
 // Start the configured command asynchronously and then return the Cmd
-func (commandConfig CommandConfig) Start() (*exec.Cmd, error) {
+func (commandConfig CommandConfig) Start(env []string) (*exec.Cmd, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not executing: %s", commandConfig)
+		return nil, ErrExecDisabled
+	}
+
 	logp.Info("Executing command: %s", commandConfig)
 	// Let's just run it in the background
-	cmd := commandConfig.Cmd()
-	err := cmd.Start()
+	cmd := commandConfig.Cmd(env)
+	file, err := commandConfig.attachOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if file != nil {
+		file.Close()
+	}
 	return cmd, err
 }
 
+// FileOutputConfig appends every matching line to the file at Path, see
+// fileoutput.go. Format is an optional template for the line and the file is
+// rotated past MaxBytes, keeping MaxBackups old ones.
+type FileOutputConfig struct {
+	Path       string         `config:"path"`
+	Format     string         `config:"format"`
+	MaxBytes   int64          `config:"max_bytes"`
+	MaxBackups int            `config:"max_backups"`
+	Sanitize   SanitizeConfig `config:"sanitize"`
+}
+
+// ContextConfig hands the Before lines preceding a matching line and the
+// After lines following it to the match command, which waits at most Wait
+// for them, see context.go.
+type ContextConfig struct {
+	Before int           `config:"before"`
+	After  int           `config:"after"`
+	Wait   time.Duration `config:"wait"`
+}
+
 // TimeoutConfig holds the information for executing a command as the
 // result of a timeout.
 type TimeoutConfig struct {
+	Command  CommandConfig   `config:"command"`
+	Commands []CommandConfig `config:"commands"`
+	Interval time.Duration   `config:"interval"`
+	Once     bool            `config:"once"`
+	Misses   int             `config:"misses"`
+
+	MinMatches int `config:"min_matches"`
+
+	ClockJump          string        `config:"clock_jump"`
+	ClockJumpThreshold time.Duration `config:"clock_jump_threshold"`
+
+	ActiveHours []string                `config:"active_hours"`
+	Timezone    string                  `config:"timezone"`
+	Schedule    []TimeoutScheduleConfig `config:"schedule"`
+
+	Maintenance MaintenanceConfig `config:"maintenance"`
+
+	Tiers []TimeoutTierConfig `config:"tiers"`
+
+	RecoveryCommand CommandConfig `config:"recovery_command"`
+
+	StartDelay      time.Duration `config:"start_delay"`
+	ArmOnFirstMatch bool          `config:"arm_on_first_match"`
+
+	MaxFirings     int           `config:"max_firings"`
+	RepeatInterval time.Duration `config:"repeat_interval"`
+
+	Jitter string `config:"jitter"`
+}
+
+// MaintenanceConfig lists the windows a timeout is ignored during, as days or times in
+// Windows and the events of the iCalendar at ICal. See maintenance.go.
+type MaintenanceConfig struct {
+	Windows []string      `config:"windows"`
+	ICal    string        `config:"ical"`
+	Refresh time.Duration `config:"refresh"`
+	// For an https ICal
+	TLS TLSConfig `config:"tls"`
+}
+
+// TimeoutScheduleConfig is the timeout interval during Hours, in the same format as
+// active_hours. See schedule.go.
+type TimeoutScheduleConfig struct {
+	Hours    string        `config:"hours"`
+	Interval time.Duration `config:"interval"`
+}
+
+// TimeoutTierConfig runs Command and Commands once nothing has matched for
+// After, and again every After after that unless Once is set. See tiers.go.
+type TimeoutTierConfig struct {
+	After    time.Duration   `config:"after"`
+	Command  CommandConfig   `config:"command"`
+	Commands []CommandConfig `config:"commands"`
+	Once     bool            `config:"once"`
+}
+
+// SeverityConfig picks the command run for a matching line by its level,
+// which comes from the Group named group of the pattern or the Field JSON
+// field of the line. Levels without a command run the plain match command.
+type SeverityConfig struct {
+	Group    string                   `config:"group"`
+	Field    string                   `config:"field"`
+	Commands map[string]CommandConfig `config:"commands"`
+}
+
+// TimestampConfig drives a collector's timeout by the time in its lines
+// rather than the time they arrive. Pattern's first group captures the
+// timestamp, which is parsed with Layout (default RFC3339) in Timezone
+// (default local) if the layout doesn't have one.
+type TimestampConfig struct {
+	Pattern  string `config:"pattern"`
+	Layout   string `config:"layout"`
+	Timezone string `config:"timezone"`
+}
+
+// ThresholdConfig makes the pattern match command wait until the pattern
+// has been seen Count times within Window.
+type ThresholdConfig struct {
+	Count  int           `config:"count"`
+	Window time.Duration `config:"window"`
+}
+
+// RateConfig runs a command when the number of matches per second, measured
+// over every Window, goes above Above or below Below. Hysteresis is the fraction
+// the rate has to move back past the limit before it's considered normal again.
+type RateConfig struct {
+	Window     time.Duration `config:"window"`
+	Above      float64       `config:"above"`
+	Below      float64       `config:"below"`
+	Hysteresis float64       `config:"hysteresis"`
+	Command    CommandConfig `config:"command"`
+}
+
+// AnomalyConfig runs Command when a collector's line rate, measured over every
+// Window, strays more than Factor times above or below a baseline learned as an
+// exponentially weighted moving average with weight Alpha. Nothing is judged
+// until Warmup windows have gone into the baseline.
+type AnomalyConfig struct {
+	Window  time.Duration `config:"window"`
+	Alpha   float64       `config:"alpha"`
+	Factor  float64       `config:"factor"`
+	Warmup  int           `config:"warmup"`
+	Command CommandConfig `config:"command"`
+}
+
+// ReportConfig runs Command every Interval with the number of matches seen
+// during it, for trending counts without a metrics pipeline.
+type ReportConfig struct {
+	Interval time.Duration `config:"interval"`
+	Command  CommandConfig `config:"command"`
+}
+
+// BatchConfig runs Command with the matching lines on its stdin every
+// Interval, or as soon as MaxLines of them have been collected.
+type BatchConfig struct {
+	Interval time.Duration `config:"interval"`
+	MaxLines int           `config:"max_lines"`
 	Command  CommandConfig `config:"command"`
+}
+
+// SequenceConfig runs a command when a line matching Start isn't followed by
+// a line matching End within the Within duration.
+type SequenceConfig struct {
+	Start   string        `config:"start"`
+	End     string        `config:"end"`
+	Within  time.Duration `config:"within"`
+	Command CommandConfig `config:"command"`
+}
+
+// SocketConfig holds the settings for collectors with the "unix" type,
+// which listen on a Unix domain socket instead of tailing files.
+type SocketConfig struct {
+	Path string      `config:"path"`
+	Mode os.FileMode `config:"mode"`
+}
+
+// SSHConfig holds the settings for collectors with the "ssh" type, which
+// tail the collector's paths on a remote host through the ssh client.
+type SSHConfig struct {
+	Host         string        `config:"host"`
+	Port         int           `config:"port"`
+	User         string        `config:"user"`
+	IdentityFile string        `config:"identity_file"`
+	Options      []string      `config:"options"`
+	Program      string        `config:"program"`
+	Backoff      time.Duration `config:"backoff"`
+	MaxBackoff   time.Duration `config:"max_backoff"`
+}
+
+// ProcessConfig holds the settings for collectors with the "process" type,
+// which watch for a named process starting and exiting.
+type ProcessConfig struct {
+	Name     string        `config:"name"`
 	Interval time.Duration `config:"interval"`
-	Once     bool          `config:"once"`
+}
+
+// ProbeConfig holds the settings for collectors with the "probe" type, which
+// check that a network endpoint is up every Interval.
+type ProbeConfig struct {
+	Protocol     string        `config:"protocol"`
+	Address      string        `config:"address"`
+	Interval     time.Duration `config:"interval"`
+	Timeout      time.Duration `config:"timeout"`
+	ExpectStatus int           `config:"expect_status"`
+	// "ipv4" or "ipv6" to only probe the address over one of them
+	Family string `config:"family"`
+	// For http probes of https addresses
+	TLS TLSConfig `config:"tls"`
+}
+
+// SQLConfig holds the settings for collectors with the "sql" type, which run
+// Query against a database every Interval. Driver is postgres or mysql and DSN
+// is in the format that driver expects.
+type SQLConfig struct {
+	Driver   string        `config:"driver"`
+	DSN      string        `config:"dsn"`
+	Query    string        `config:"query"`
+	Interval time.Duration `config:"interval"`
+}
+
+// MultilineConfig mirrors FileBeat's multiline settings so that our own
+// inputs can assemble multiline events the same way its prospectors do.
+type MultilineConfig struct {
+	Pattern  string        `config:"pattern"`
+	Negate   bool          `config:"negate"`
+	Match    string        `config:"match"`
+	MaxLines int           `config:"max_lines"`
+	Timeout  time.Duration `config:"timeout"`
+}
+
+// MatchConfig is one part of a collector's match, which combines patterns with
+// and, or and not. Each part is either a Pattern or one of All (every part
+// matches), Any (at least one part matches) or Not (the part doesn't match).
+type MatchConfig struct {
+	Pattern string        `config:"pattern"`
+	All     []MatchConfig `config:"all"`
+	Any     []MatchConfig `config:"any"`
+	Not     *MatchConfig  `config:"not"`
+}
+
+// ComparisonConfig compares a number taken from a named group of the pattern
+// (Group) or a field of a JSON line (Field) against Value, with Op being one
+// of ==, !=, <, <=, > or >=.
+type ComparisonConfig struct {
+	Group string  `config:"group"`
+	Field string  `config:"field"`
+	Op    string  `config:"op"`
+	Value float64 `config:"value"`
 }
 
 // CollectorConfig contains all of the information necessary
@@ -71,11 +525,85 @@ type TimeoutConfig struct {
 // of the FileBeat's Prospector config and the raw ucfg will be
 // passed to it.
 type CollectorConfig struct {
-	Type    string        `config:"type"`
-	Paths   []string      `config:"paths"`
-	Pattern string        `config:"pattern"`
-	Command CommandConfig `config:"command"`
-	Timeout TimeoutConfig `config:"timeout"`
+	Name               string             `config:"name"`
+	Description        string             `config:"description"`
+	RunbookURL         string             `config:"runbook_url"`
+	Type               string             `config:"type"`
+	Paths              []string           `config:"paths"`
+	Pattern            string             `config:"pattern"`
+	PatternFile        string             `config:"pattern_file"`
+	Match              *MatchConfig       `config:"match"`
+	MatchType          string             `config:"match_type"`
+	PatternEngine      string             `config:"pattern_engine"`
+	SampleRate         float64            `config:"sample_rate"`
+	PatternFlags       string             `config:"pattern_flags"`
+	ExcludePattern     string             `config:"exclude_pattern"`
+	Condition          string             `config:"condition"`
+	Compare            []ComparisonConfig `config:"compare"`
+	Command            CommandConfig      `config:"command"`
+	Commands           []CommandConfig    `config:"commands"`
+	CommandsParallel   bool               `config:"commands_parallel"`
+	FileOutput         FileOutputConfig   `config:"file_output"`
+	Context            ContextConfig      `config:"context"`
+	SuppressFor        time.Duration      `config:"suppress_for"`
+	Debounce           time.Duration      `config:"debounce"`
+	MatchOnce          bool               `config:"match_once"`
+	MatchAfterTimeout  bool               `config:"match_after_timeout"`
+	ExitOnMatch        bool               `config:"exit_on_match"`
+	MaxRunningCommands int                `config:"max_running_commands"`
+	CommandOverflow    string             `config:"command_overflow"`
+	Severity           SeverityConfig     `config:"severity"`
+	Threshold          ThresholdConfig    `config:"threshold"`
+	Rate               RateConfig         `config:"rate"`
+	Report             ReportConfig       `config:"report"`
+	Batch              BatchConfig        `config:"batch"`
+	Anomaly            AnomalyConfig      `config:"anomaly"`
+	Timeout            TimeoutConfig      `config:"timeout"`
+	Sequence           SequenceConfig     `config:"sequence"`
+	Timestamp          TimestampConfig    `config:"timestamp"`
+	DependsOn          []string           `config:"depends_on"`
+	Socket             SocketConfig       `config:"socket"`
+	SSH                SSHConfig          `config:"ssh"`
+	Process            ProcessConfig      `config:"process"`
+	Probe              ProbeConfig        `config:"probe"`
+	SQL                SQLConfig          `config:"sql"`
+	Multiline          MultilineConfig    `config:"multiline"`
+	Priority           int                `config:"priority"`
+	Canary             bool               `config:"canary"`
+	CanaryFor          time.Duration      `config:"canary_for"`
+
+	Labels map[string]string `config:"labels"`
+}
+
+// commands lists every command a collector can run
+func (config CollectorConfig) commands() []CommandConfig {
+	commands := []CommandConfig{
+		config.Command,
+		config.Timeout.Command,
+		config.Timeout.RecoveryCommand,
+		config.Rate.Command,
+		config.Report.Command,
+		config.Batch.Command,
+		config.Anomaly.Command,
+		config.Sequence.Command,
+	}
+	commands = append(commands, config.Commands...)
+	commands = append(commands, config.Timeout.Commands...)
+	for _, command := range config.Severity.Commands {
+		commands = append(commands, command)
+	}
+	for _, tier := range config.Timeout.Tiers {
+		commands = append(commands, tier.Command)
+		commands = append(commands, tier.Commands...)
+	}
+
+	// Along with their fallbacks, and theirs
+	for i := 0; i < len(commands); i++ {
+		if commands[i].Fallback != nil {
+			commands = append(commands, *commands[i].Fallback)
+		}
+	}
+	return commands
 }
 
 // LogPulseConfig is the main holder for all of our configs. It is
@@ -135,6 +663,9 @@ func ParseConfig(data []byte) (*LogPulseConfig, []*common.Config, error) {
 		return nil, nil, err
 	}
 
+	// Give every collector a name so it can be referred to by others
+	setCollectorDefaults(config)
+
 	// Change some of Prospector's defaults
 	rawArray, err = setProspectorDefaults(rawArray)
 	if err != nil {
@@ -158,6 +689,30 @@ func ParseConfigFile(filename string) (*LogPulseConfig, []*common.Config, error)
 	return ParseConfig(data)
 }
 
+// EffectiveConfig is the configuration a collector actually ends up with, after our defaults
+// and FileBeat's prospector defaults have been merged in. Working that out from the YAML alone
+// is next to impossible with how ucfg merges things, so "log-pulse config show" prints it.
+func EffectiveConfig(config CollectorConfig, rawConfig *common.Config) (map[string]interface{}, error) {
+	effective := make(map[string]interface{})
+	if err := rawConfig.Unpack(&effective); err != nil {
+		return nil, err
+	}
+
+	// Our own defaults only make it into CollectorConfig
+	effective["name"] = config.Name
+	return effective, nil
+}
+
+// setCollectorDefaults fills in the fields of our own CollectorConfigs that the user
+// left out. Collectors without a name are named after their position in the file.
+func setCollectorDefaults(config LogPulseConfig) {
+	for i := range config {
+		if config[i].Name == "" {
+			config[i].Name = fmt.Sprintf("collector-%d", i)
+		}
+	}
+}
+
 var (
 	// DefaultProspectorConfig specifies the default fields we want to
 	// pass along for Prospector configuration to make file process
@@ -3,6 +3,7 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ func TestParseConfig(t *testing.T) {
   paths:
     - /var/tests/*.log
   pattern: .*
+  exclude_pattern: replay
   command:
     program: echo
     args:
@@ -32,6 +34,7 @@ func TestParseConfig(t *testing.T) {
 - type: log
   paths: ["/var/tests/*.log"]
   pattern: .*
+  exclude_pattern: replay
   command.program: echo
   command.args: ["Hello, World"]
   timeout.interval: 30s
@@ -52,6 +55,7 @@ func TestParseConfig(t *testing.T) {
 		assert.Equal(t, "log", conf.Type)
 		assert.Equal(t, "/var/tests/*.log", conf.Paths[0])
 		assert.Equal(t, ".*", conf.Pattern)
+		assert.Equal(t, "replay", conf.ExcludePattern)
 		assert.Equal(t, "echo", conf.Command.Program)
 		assert.Equal(t, "Hello, World", conf.Command.Args[0])
 		assert.Equal(t, 30*time.Second, conf.Timeout.Interval)
@@ -82,3 +86,71 @@ func TestSetProspectorDefaults(t *testing.T) {
 	assert.Equal(t, 1*time.Second, testConfig.MaxBackoff)
 	assert.Equal(t, 3*time.Second, testConfig.ScanFrequency)
 }
+
+func TestEffectiveConfig(t *testing.T) {
+	var data = `
+- paths: ["/var/tests/*.log"]
+  pattern: .*
+  tail_files: false
+`
+	config, rawConfig, err := ParseConfig([]byte(data))
+	assert.Nil(t, err)
+
+	effective, err := EffectiveConfig((*config)[0], rawConfig[0])
+	assert.Nil(t, err)
+
+	// Our defaults, FileBeat's defaults and what the user set all show up
+	assert.Equal(t, "collector-0", effective["name"])
+	assert.Equal(t, "log", effective["type"])
+	assert.Equal(t, ".*", effective["pattern"])
+	assert.Equal(t, false, effective["tail_files"])
+}
+
+func TestSetCollectorDefaults(t *testing.T) {
+	config := LogPulseConfig{
+		CollectorConfig{},
+		CollectorConfig{Name: "named"},
+	}
+	setCollectorDefaults(config)
+
+	assert.Equal(t, "collector-0", config[0].Name)
+	assert.Equal(t, "named", config[1].Name)
+}
+
+func TestCommandExecDisabled(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+	command := CommandConfig{
+		Program: "touch",
+		Args:    []string{touchedFile},
+	}
+
+	ExecDisabled = true
+	defer func() { ExecDisabled = false }()
+
+	cmd, err := command.Start(nil)
+	assert.Nil(t, cmd)
+	assert.Equal(t, ErrExecDisabled, err)
+	time.Sleep(10 * time.Millisecond)
+	assertFileDoesNotExist(t, touchedFile)
+}
+
+func TestCommandShell(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	command := CommandConfig{
+		Program: `echo "$1" | tr a-z A-Z > output`,
+		Args:    []string{"hello; rm -rf /"},
+		Shell:   true,
+		Dir:     tmpDir,
+	}
+	cmd, err := command.Start(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Wait())
+
+	output, _ := ioutil.ReadFile(filepath.Join(tmpDir, "output"))
+	assert.Equal(t, "HELLO; RM -RF /\n", string(output))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// A bare "ERROR" line is rarely enough to go on. With "context" a collector keeps the last
+// few lines it has seen, matching or not, and hands the ones before a matching line to its
+// match command along with it. With "after" the command waits for that many more lines to
+// come in as well, or for "wait" (5s by default) to pass, whichever comes first, so a stack
+// trace following an error makes it into the command too. The lines reach the command as
+// LOGPULSE_CONTEXT_BEFORE and LOGPULSE_CONTEXT_AFTER, one per line, and in its templates as
+// {{.Before}} and {{.After}}, all after its sanitize.
+
+// DefaultContextWait is how long a match command waits for its lines after, when no wait is
+// given
+const DefaultContextWait = 5 * time.Second
+
+// lineContext keeps the lines around our matches
+type lineContext struct {
+	config ContextConfig
+
+	// The last config.Before lines, a ring starting at next once it's full
+	history []string
+	next    int
+
+	// The match commands waiting for their lines after, oldest first
+	pending []*pendingContext
+}
+
+// pendingContext is a match command waiting for the lines after its line
+type pendingContext struct {
+	commands []CommandConfig
+	data     commandData
+	deadline time.Time
+}
+
+// newLineContext checks a context configuration, returning nil if there's none
+func newLineContext(config ContextConfig) (*lineContext, error) {
+	if config.Before < 0 || config.After < 0 || config.Wait < 0 {
+		return nil, errors.New("A context's before, after and wait can't be negative")
+	}
+	if config.Before == 0 && config.After == 0 {
+		return nil, nil
+	}
+	if config.Wait == 0 {
+		config.Wait = DefaultContextWait
+	}
+	return &lineContext{config: config}, nil
+}
+
+// remember adds a line to the history
+func (context *lineContext) remember(line string) {
+	if context.config.Before == 0 {
+		return
+	}
+	if len(context.history) < context.config.Before {
+		context.history = append(context.history, line)
+		return
+	}
+	context.history[context.next] = line
+	context.next = (context.next + 1) % context.config.Before
+}
+
+// before returns the lines in the history, oldest first
+func (context *lineContext) before() []string {
+	lines := make([]string, 0, len(context.history))
+	lines = append(lines, context.history[context.next:]...)
+	return append(lines, context.history[:context.next]...)
+}
+
+// wait holds a match command back until the lines after its line have come in
+func (context *lineContext) wait(commands []CommandConfig, data commandData, now time.Time) {
+	context.pending = append(context.pending, &pendingContext{
+		commands: commands,
+		data:     data,
+		deadline: now.Add(context.config.Wait),
+	})
+}
+
+// observe adds a line to the lines after of every waiting match command, returning the
+// ones that now have all of them
+func (context *lineContext) observe(line string) []*pendingContext {
+	for _, pending := range context.pending {
+		pending.data.After = append(pending.data.After, line)
+	}
+	// Everything waiting needs the same number of lines, so the oldest are done first
+	done := 0
+	for done < len(context.pending) && len(context.pending[done].data.After) >= context.config.After {
+		done++
+	}
+	return context.take(done)
+}
+
+// expired returns the waiting match commands that have run out of time
+func (context *lineContext) expired(now time.Time) []*pendingContext {
+	done := 0
+	for done < len(context.pending) && !now.Before(context.pending[done].deadline) {
+		done++
+	}
+	return context.take(done)
+}
+
+func (context *lineContext) take(n int) []*pendingContext {
+	if n == 0 {
+		return nil
+	}
+	taken := context.pending[:n:n]
+	context.pending = context.pending[n:]
+	return taken
+}
+
+// awaitContext holds back a match command until the lines after its line have come in
+func (collector *Collector) awaitContext(commands []CommandConfig, data commandData) {
+	collector.context.wait(commands, data, time.Now())
+	if len(collector.context.pending) == 1 {
+		collector.scheduleContext()
+	}
+}
+
+// observeContext feeds a line to our context, running the match commands it completes.
+// The line itself is remembered for the ones to come once it has been handled.
+func (collector *Collector) observeContext(line string) {
+	for _, pending := range collector.context.observe(line) {
+		collector.runCommands(MatchAction, pending.commands, pending.data)
+	}
+}
+
+// handleContextTimeout runs the match commands that have waited long enough for their lines
+// after, with however many came in
+func (collector *Collector) handleContextTimeout() {
+	for _, pending := range collector.context.expired(time.Now()) {
+		collector.runCommands(MatchAction, pending.commands, pending.data)
+	}
+	collector.scheduleContext()
+}
+
+// flushContext runs every match command still waiting, when we stop
+func (collector *Collector) flushContext() {
+	if collector.context == nil {
+		return
+	}
+	for _, pending := range collector.context.take(len(collector.context.pending)) {
+		collector.runCommands(MatchAction, pending.commands, pending.data)
+	}
+}
+
+// scheduleContext sets our timer for when the oldest waiting match command runs out of time
+func (collector *Collector) scheduleContext() {
+	if len(collector.context.pending) == 0 {
+		return
+	}
+	wait := collector.context.pending[0].deadline.Sub(time.Now())
+	if collector.contextTimer == nil {
+		collector.contextTimer = time.NewTimer(wait)
+		collector.contextChannel = collector.contextTimer.C
+		return
+	}
+	if !collector.contextTimer.Stop() {
+		select {
+		case <-collector.contextTimer.C:
+		default:
+		}
+	}
+	collector.contextTimer.Reset(wait)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLineContext(t *testing.T) {
+	context, err := newLineContext(ContextConfig{})
+	assert.Nil(t, context)
+	assert.Nil(t, err)
+
+	_, err = newLineContext(ContextConfig{Before: -1})
+	assert.NotNil(t, err)
+
+	context, err = newLineContext(ContextConfig{After: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultContextWait, context.config.Wait)
+}
+
+func TestLineContextHistory(t *testing.T) {
+	context, _ := newLineContext(ContextConfig{Before: 3})
+	assert.Equal(t, []string{}, context.before())
+
+	context.remember("1")
+	context.remember("2")
+	assert.Equal(t, []string{"1", "2"}, context.before())
+
+	for _, line := range []string{"3", "4", "5"} {
+		context.remember(line)
+	}
+	assert.Equal(t, []string{"3", "4", "5"}, context.before())
+}
+
+func TestLineContextAfter(t *testing.T) {
+	context, _ := newLineContext(ContextConfig{After: 2, Wait: time.Minute})
+	now := time.Now()
+
+	context.wait(nil, commandData{Line: "first"}, now)
+	assert.Nil(t, context.observe("a"))
+	context.wait(nil, commandData{Line: "second"}, now.Add(time.Second))
+
+	done := context.observe("b")
+	assert.Equal(t, 1, len(done))
+	assert.Equal(t, "first", done[0].data.Line)
+	assert.Equal(t, []string{"a", "b"}, done[0].data.After)
+
+	// Whatever has come in by the deadline goes
+	assert.Nil(t, context.expired(now.Add(time.Minute)))
+	done = context.expired(now.Add(time.Minute + time.Second))
+	assert.Equal(t, 1, len(done))
+	assert.Equal(t, []string{"b"}, done[0].data.After)
+	assert.Equal(t, 0, len(context.pending))
+}
+
+func TestCollectorProcessContext(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	config := CollectorConfig{
+		Pattern: "^ERROR",
+		Context: ContextConfig{Before: 2, After: 2, Wait: 100 * time.Millisecond},
+		Command: CommandConfig{
+			Program: "sh",
+			Args: []string{"-c", `printf '%s\n--\n%s\n--\n%s\n==\n' "$LOGPULSE_CONTEXT_BEFORE" "$1" "$LOGPULSE_CONTEXT_AFTER" >> ` + outputFile,
+				"log-pulse", "{{.Line}}"},
+		},
+	}
+	collector, err := newCollector(config)
+	assert.Nil(t, err)
+	collector.timeoutChannel = make(chan time.Time)
+
+	go collector.process()
+	for _, line := range []string{"starting", "handling request", "connecting", "ERROR no route", "  at dial()", "  at main()", "retrying"} {
+		collector.lines <- line
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Running out of lines after
+	collector.lines <- "ERROR again"
+	collector.lines <- "giving up"
+	time.Sleep(200 * time.Millisecond)
+
+	close(collector.Done)
+	<-collector.Stopped
+
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "handling request\nconnecting\n--\nERROR no route\n--\n  at dial()\n  at main()\n==\n"+
+		"  at main()\nretrying\n--\nERROR again\n--\ngiving up\n==\n", string(output))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Maintenance can legitimately pause a heartbeat and a drill needs the timeout command to
+// actually run. With --control-socket Log Pulse listens on a Unix socket for one line
+// requests naming an action and a collector:
+//
+//   reset <collector>   start counting its timeout again from now, as a match would
+//   fire <collector>    run its timeout commands right away
+//
+// Every request is answered with a single line, "ok" or "error: " and what went wrong.
+// "log-pulse control <action> <collector>" sends one and prints the answer.
+
+const (
+	// ControlReset restarts a collector's timeout
+	ControlReset = "reset"
+	// ControlFire runs a collector's timeout commands
+	ControlFire = "fire"
+)
+
+// controlTimeout is how long a control client has to send its request
+const controlTimeout = 10 * time.Second
+
+// controlRequest asks process to carry out a control action, the outcome being sent back
+// through reply
+type controlRequest struct {
+	action string
+	reply  chan error
+}
+
+// Control carries out a control action on the collector
+func (collector *Collector) Control(action string) error {
+	request := controlRequest{action: action, reply: make(chan error, 1)}
+	select {
+	case collector.controls <- request:
+		return <-request.reply
+	case <-collector.Stopped:
+		return fmt.Errorf("Collector %s has stopped", collector.config.Name)
+	}
+}
+
+// handleControl carries out a control action from process
+func (collector *Collector) handleControl(action string) error {
+	switch action {
+	case ControlReset:
+		logp.Info("Resetting the timeout of collector %s on request", collector.config.Name)
+		collector.resetTimeout()
+		collector.timedOutOnce = false
+		collector.missedBeats = 0
+		collector.timeoutFirings = 0
+		collector.intervalMatches = 0
+		return nil
+	case ControlFire:
+		commands := commandList(collector.config.Timeout.Command, collector.config.Timeout.Commands)
+		if len(commands) == 0 {
+			return fmt.Errorf("Collector %s has no timeout command", collector.config.Name)
+		}
+		logp.Info("Running the timeout command of collector %s on request", collector.config.Name)
+		collector.runCommands(TimeoutAction, commands, commandData{Collector: collector.config.Name})
+		return nil
+	}
+	return fmt.Errorf("Unknown action %q, expected reset or fire", action)
+}
+
+// Control carries out a control action on the named collector
+func (collection *Collection) Control(name string, action string) error {
+	collection.mutex.Lock()
+	collector := findCollector(collection.collectors, name)
+	var state string
+	var waitingOn []string
+	if collector != nil {
+		state, waitingOn = collection.dependencyState(collector)
+	}
+	collection.mutex.Unlock()
+	if collector == nil {
+		return fmt.Errorf("There's no collector called %s", name)
+	}
+	if state != CollectorStarted {
+		if len(waitingOn) > 0 {
+			return fmt.Errorf("Collector %s hasn't started yet, it's waiting on %s", name, strings.Join(waitingOn, ", "))
+		}
+		return fmt.Errorf("Collector %s hasn't started yet", name)
+	}
+	return collector.Control(action)
+}
+
+// ListenControl creates the control socket at path
+func ListenControl(path string) (net.Listener, error) {
+	// A socket left behind by a run that didn't shut down cleanly would make Listen fail, one
+	// that's still being listened on isn't ours to take
+	stale, err := checkSocketPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Whoever can reset a timeout can hide an outage, so only we get to
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serveControl answers control requests until the listener is closed
+func (collection *Collection) serveControl(listener net.Listener) {
+	logp.Info("Listening for control requests on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-collection.done:
+				// We're shutting down, so this is expected
+			default:
+				logp.Err("Unable to accept control connection: %s", err)
+			}
+			return
+		}
+		go collection.answerControl(conn)
+	}
+}
+
+// answerControl carries out a single control request and answers it
+func (collection *Collection) answerControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	request, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		logp.Warn("Unable to read control request: %s", err)
+		return
+	}
+	fields := strings.Fields(request)
+	if len(fields) != 2 {
+		err = errors.New("Expected an action and a collector")
+	} else {
+		err = collection.Control(fields[1], fields[0])
+	}
+
+	if err != nil {
+		logp.Warn("Control request %q failed: %s", strings.TrimSpace(request), err)
+		fmt.Fprintf(conn, "error: %s\n", err)
+		return
+	}
+	fmt.Fprintln(conn, "ok")
+}
+
+// sendControl sends a control request over the socket at path, returning our exit code
+func sendControl(path string, action string, name string) int {
+	if path == "" || action == "" || name == "" {
+		fmt.Fprintln(os.Stderr, "Usage: log-pulse --control-socket <path> control reset|fire <collector>")
+		return 2
+	}
+
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	fmt.Fprintf(conn, "%s %s\n", action, name)
+	answer, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	answer = strings.TrimSpace(answer)
+	if answer != "ok" {
+		fmt.Fprintln(os.Stderr, answer)
+		return 1
+	}
+	fmt.Println(answer)
+	return 0
+}
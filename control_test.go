@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorControl(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+	collector, err := newCollector(CollectorConfig{
+		Name:    "worker",
+		Pattern: "^Match",
+		Timeout: TimeoutConfig{
+			Interval: time.Hour,
+			Command:  CommandConfig{Program: "touch", Args: []string{touchedFile}},
+		},
+	})
+	assert.Nil(t, err)
+	collector.timedOutOnce = true
+
+	go collector.process()
+
+	assert.Nil(t, collector.Control(ControlReset))
+	// A reset isn't a match
+	assert.True(t, collector.Stats().LastMatch.IsZero())
+	assert.NotNil(t, collector.Control("explode"))
+
+	assert.Nil(t, collector.Control(ControlFire))
+	time.Sleep(100 * time.Millisecond)
+	assertFileExists(t, touchedFile)
+
+	close(collector.Done)
+	<-collector.Stopped
+	assert.False(t, collector.timedOutOnce)
+	assert.NotNil(t, collector.Control(ControlReset))
+
+	// A collector without a timeout command has nothing to fire
+	quiet, _ := newCollector(CollectorConfig{Name: "quiet", Pattern: "^Match"})
+	assert.NotNil(t, quiet.handleControl(ControlFire))
+}
+
+func TestControlSocket(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	collector, _ := newCollector(CollectorConfig{Name: "worker", Pattern: "^Match", Timeout: TimeoutConfig{Interval: time.Hour}})
+	waiting, _ := newCollector(CollectorConfig{Name: "waiting", Pattern: "^Match"})
+	collection := Collection{
+		collectors: []*Collector{collector, waiting},
+		started:    map[*Collector]bool{collector: true},
+		done:       make(chan struct{}),
+	}
+	go collector.process()
+	defer func() {
+		close(collector.Done)
+		<-collector.Stopped
+	}()
+
+	path := filepath.Join(tmpDir, "control.sock")
+	listener, err := ListenControl(path)
+	assert.Nil(t, err)
+	go collection.serveControl(listener)
+	defer func() {
+		close(collection.done)
+		listener.Close()
+	}()
+
+	request := func(line string) string {
+		conn, err := net.Dial("unix", path)
+		assert.Nil(t, err)
+		defer conn.Close()
+		fmt.Fprintln(conn, line)
+		answer, _ := bufio.NewReader(conn).ReadString('\n')
+		return answer
+	}
+
+	assert.Equal(t, "ok\n", request("reset worker"))
+	assert.Contains(t, request("fire worker"), "error: ")
+	assert.Contains(t, request("reset missing"), "error: ")
+	assert.Contains(t, request("reset waiting"), "error: ")
+	assert.Contains(t, request("reset"), "error: ")
+
+	assert.Equal(t, 0, sendControl(path, ControlReset, "worker"))
+	assert.Equal(t, 1, sendControl(path, ControlReset, "missing"))
+	assert.Equal(t, 2, sendControl("", ControlReset, "worker"))
+}
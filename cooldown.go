@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Any command can have a "cooldown", the least time between two runs of it for the same
+// trigger. Unlike suppress_for it's set on the command itself, so it works for timeout,
+// rate, severity and every other kind of command, and each of them cools down on its own.
+// What triggered a command still happens as usual while it's cooling down: matches keep
+// resetting the timeout, get counted and so on, only the command isn't run. When commands
+// last ran is kept in the collector's stats, so cooldowns hold across restarts with
+// --stats-file and across reloads.
+
+// validateCooldown checks a command's cooldown
+func validateCooldown(command CommandConfig) error {
+	if command.Cooldown < 0 {
+		return fmt.Errorf("The cooldown of %s can't be negative", command)
+	}
+	return nil
+}
+
+// coolingDown reports whether a command ran for an action less than its cooldown ago,
+// otherwise remembering that it's running now. Commands are told apart by their
+// configuration before their templates are expanded, so a templated command cools down
+// whatever the line it's run for.
+func (collector *Collector) coolingDown(action string, command CommandConfig, now time.Time) bool {
+	if command.Cooldown <= 0 {
+		return false
+	}
+
+	key := action + " " + command.String()
+	if last, ok := collector.stats.LastRuns[key]; ok && now.Sub(last) < command.Cooldown {
+		logp.Debug("log-pulse", "Not running %s command %s of collector %s, it ran %s ago",
+			action, command, collector.config.Name, now.Sub(last))
+		return true
+	}
+
+	if collector.stats.LastRuns == nil {
+		collector.stats.LastRuns = make(map[string]time.Time)
+	}
+	collector.stats.LastRuns[key] = now
+	return false
+}
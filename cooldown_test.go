@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoolingDown(t *testing.T) {
+	var collector Collector
+	command := CommandConfig{Program: "alert", Cooldown: time.Minute}
+	now := time.Now()
+
+	assert.False(t, collector.coolingDown(MatchAction, command, now))
+	assert.True(t, collector.coolingDown(MatchAction, command, now.Add(30*time.Second)))
+	// Each trigger cools down on its own
+	assert.False(t, collector.coolingDown(TimeoutAction, command, now.Add(30*time.Second)))
+	assert.False(t, collector.coolingDown(MatchAction, command, now.Add(time.Minute)))
+
+	// The last runs are part of the stats, so they carry over to a replacement or restart
+	replacement := Collector{stats: collector.stats.copy()}
+	assert.True(t, replacement.coolingDown(MatchAction, command, now.Add(90*time.Second)))
+
+	// Without a cooldown commands always run
+	assert.False(t, collector.coolingDown(MatchAction, CommandConfig{Program: "alert"}, now))
+	assert.False(t, collector.coolingDown(MatchAction, CommandConfig{Program: "alert"}, now))
+}
+
+func TestCooldownValidation(t *testing.T) {
+	_, err := newCollector(CollectorConfig{
+		Pattern: "a",
+		Timeout: TimeoutConfig{Command: CommandConfig{Program: "alert", Cooldown: -time.Minute}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestCollectorProcessCooldown(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: timeoutChannel,
+
+		config: CollectorConfig{
+			Command: CommandConfig{
+				Program:  "sh",
+				Args:     []string{"-c", "echo ran >> " + outputFile},
+				Cooldown: time.Hour,
+			},
+			Timeout: TimeoutConfig{Interval: time.Hour},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+	close(collector.Done)
+	<-collector.Stopped
+
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "ran\n", string(output))
+	// Every match still counted
+	assert.Equal(t, 3, collector.stats.Heatmap.Total())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// With "debounce" a collector's match command doesn't run for every matching line but once
+// the matches have stopped coming for that long, for signals like "deploy finished" that
+// tend to show up several times in a row. The command is run for the last line of the burst
+// and is told how many lines matched in it through LOGPULSE_MATCH_COUNT (or {{.Count}}).
+// Everything else about a match, resetting the timeout, counting towards the rate and so
+// on, still happens on every line. A burst still going when the collector is stopped, or
+// replaced by a reload, runs its command right away rather than being dropped.
+
+// pendingMatch is the burst of matches a debounced match command is waiting out
+type pendingMatch struct {
+	line      string
+	source    string
+	groups    map[string]string
+	recovered bool
+	count     int
+}
+
+// debounce adds a match to the current burst and restarts the wait for it to end
+func (collector *Collector) debounce(msg string, source string, groups map[string]string, recovered bool) {
+	if collector.pending == nil {
+		collector.pending = &pendingMatch{}
+	}
+	pending := collector.pending
+	pending.line = msg
+	pending.source = source
+	pending.groups = groups
+	pending.recovered = pending.recovered || recovered
+	pending.count++
+
+	if collector.debounceTimer == nil {
+		collector.debounceTimer = time.NewTimer(collector.config.Debounce)
+		collector.debounceChannel = collector.debounceTimer.C
+		return
+	}
+	// Only process reads the timer's channel, so if it has already fired the time is still
+	// waiting there and has to be thrown away before restarting it
+	if !collector.debounceTimer.Stop() {
+		select {
+		case <-collector.debounceTimer.C:
+		default:
+		}
+	}
+	collector.debounceTimer.Reset(collector.config.Debounce)
+}
+
+// handleDebounce runs the match command once a burst of matches has died down
+func (collector *Collector) handleDebounce() {
+	pending := collector.pending
+	collector.pending = nil
+	if pending == nil {
+		return
+	}
+
+	logp.Debug("log-pulse", "Collector %s saw %d matches before going quiet", collector.config.Name, pending.count)
+	collector.fireMatch(pending.line, pending.source, pending.groups, pending.recovered, pending.count)
+}
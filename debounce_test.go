@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorProcessDebounce(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+
+		config: CollectorConfig{
+			Debounce: 100 * time.Millisecond,
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", `echo "$LOGPULSE_MATCH_COUNT {{.Line}}" >> ` + outputFile},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	// Matches keep pushing the command back
+	for _, line := range []string{"Match 1", "Match 2", "Match 3"} {
+		collector.lines <- line
+		time.Sleep(50 * time.Millisecond)
+	}
+	_, err := os.Stat(outputFile)
+	assert.True(t, os.IsNotExist(err))
+
+	// Until they stop
+	time.Sleep(150 * time.Millisecond)
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "3 Match 3\n", string(output))
+
+	// And the next burst starts counting from scratch
+	collector.lines <- "Match 4"
+	time.Sleep(200 * time.Millisecond)
+	output, _ = ioutil.ReadFile(outputFile)
+	assert.Equal(t, "3 Match 3\n1 Match 4\n", string(output))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCollectorDebounceFlushedOnStop(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+
+		config: CollectorConfig{
+			Debounce: time.Hour,
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", `echo "$LOGPULSE_MATCH_COUNT {{.Line}}" >> ` + outputFile},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match 1"
+	collector.lines <- "Match 2"
+
+	// Stopping mid-burst runs the command rather than dropping the matches
+	close(collector.Done)
+	<-collector.Stopped
+	time.Sleep(100 * time.Millisecond)
+	output, _ := ioutil.ReadFile(outputFile)
+	assert.Equal(t, "2 Match 2\n", string(output))
+}
+
+func TestDebounceValidation(t *testing.T) {
+	_, err := newCollector(CollectorConfig{Pattern: "a", Debounce: -time.Second})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteDocs renders a configuration as a Markdown runbook: for every collector what it
+// watches, what it looks for and what it does about it, along with its description and
+// runbook_url. It's meant for the people who get paged, who shouldn't have to read YAML to
+// find out what a watchdog is for.
+func WriteDocs(w io.Writer, configs LogPulseConfig) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "# Log Pulse Collectors")
+
+	for _, config := range configs {
+		fmt.Fprintf(out, "\n## %s\n\n", config.Name)
+		if config.Description != "" {
+			fmt.Fprintf(out, "%s\n\n", config.Description)
+		}
+		if config.RunbookURL != "" {
+			fmt.Fprintf(out, "Runbook: %s\n\n", config.RunbookURL)
+		}
+		if config.Canary {
+			fmt.Fprintln(out, "This collector is a canary, its commands are only logged.")
+			fmt.Fprintln(out)
+		}
+
+		item := func(name string, format string, args ...interface{}) {
+			fmt.Fprintf(out, "- **%s:** %s\n", name, fmt.Sprintf(format, args...))
+		}
+
+		item("Watches", "%s", describeInput(config))
+		item("Looks for", "%s", describePattern(config))
+		if len(config.DependsOn) > 0 {
+			item("Starts after", "%s", strings.Join(config.DependsOn, ", "))
+		}
+
+		if commands := commandList(config.Command, config.Commands); len(commands) > 0 {
+			when := "Every matching line"
+			if config.Threshold.Count > 1 {
+				when = fmt.Sprintf("%d matching lines within %s", config.Threshold.Count, config.Threshold.Window)
+			}
+			if config.Debounce > 0 {
+				when = fmt.Sprintf("Once matches stop for %s", config.Debounce)
+			}
+			if config.MatchAfterTimeout {
+				when = "The first matching line after a timeout"
+			}
+			item("On match", "%s runs %s%s", when, describeCommands(config, commands), describeLimits(config))
+		}
+		for _, level := range sortedCommandLevels(config.Severity.Commands) {
+			item("On "+level+" match", "runs `%s`", config.Severity.Commands[level])
+		}
+		timeoutCommands := commandList(config.Timeout.Command, config.Timeout.Commands)
+		if config.Timeout.Interval > 0 && len(timeoutCommands) > 0 {
+			once := ""
+			if config.Timeout.Once {
+				once = ", once until the pattern is seen again"
+			}
+			if config.Timeout.RepeatInterval > 0 {
+				once += fmt.Sprintf(", repeating every %s", config.Timeout.RepeatInterval)
+			}
+			if config.Timeout.MaxFirings > 0 && !config.Timeout.Once {
+				once += fmt.Sprintf(", at most %d times until the pattern is seen again", config.Timeout.MaxFirings)
+			}
+			if config.Timeout.Jitter != "" {
+				once += fmt.Sprintf(", up to %s late", config.Timeout.Jitter)
+			}
+			if config.Timeout.ArmOnFirstMatch {
+				once += ", once the pattern has been seen"
+			}
+			if config.Timeout.StartDelay > 0 {
+				once += fmt.Sprintf(", not within %s of starting", config.Timeout.StartDelay)
+			}
+			for _, entry := range config.Timeout.Schedule {
+				once += fmt.Sprintf(", %s during %s", entry.Interval, entry.Hours)
+			}
+			if len(config.Timeout.ActiveHours) > 0 {
+				once += ", only during " + strings.Join(config.Timeout.ActiveHours, ", ")
+				if config.Timeout.Timezone != "" {
+					once += " (" + config.Timeout.Timezone + ")"
+				}
+			}
+			if maintenance := config.Timeout.Maintenance; len(maintenance.Windows) > 0 || maintenance.ICal != "" {
+				once += ", except during maintenance"
+			}
+			without := "without a match"
+			if config.Timeout.MinMatches > 1 {
+				without = fmt.Sprintf("with fewer than %d matches", config.Timeout.MinMatches)
+			}
+			item("On timeout", "%s %s runs %s%s", config.Timeout.Interval, without, describeCommands(config, timeoutCommands), once)
+		}
+		if config.Timeout.RecoveryCommand.configured() {
+			item("On recovery", "the first match after a timeout runs `%s`", config.Timeout.RecoveryCommand)
+		}
+		for _, tier := range config.Timeout.Tiers {
+			once := ""
+			if tier.Once {
+				once = ", once until the pattern is seen again"
+			}
+			item("On timeout", "%s without a match runs %s%s", tier.After, describeCommands(config, commandList(tier.Command, tier.Commands)), once)
+		}
+		if config.Rate.Window > 0 && config.Rate.Command.configured() {
+			item("On rate", "more than %g or fewer than %g matches a second, measured every %s, runs `%s`",
+				config.Rate.Above, config.Rate.Below, config.Rate.Window, config.Rate.Command)
+		}
+		if config.Sequence.Start != "" && config.Sequence.Command.configured() {
+			item("On sequence", "`%s` not followed by `%s` within %s runs `%s`",
+				config.Sequence.Start, config.Sequence.End, config.Sequence.Within, config.Sequence.Command)
+		}
+		if config.Anomaly.Window > 0 && config.Anomaly.Command.configured() {
+			item("On anomaly", "log volume straying from its usual level, measured every %s, runs `%s`",
+				config.Anomaly.Window, config.Anomaly.Command)
+		}
+		if config.FileOutput.Path != "" {
+			item("Writes", "matching lines to `%s`", config.FileOutput.Path)
+		}
+		if config.Batch.Command.configured() {
+			item("Batches", "matching lines to `%s`%s", config.Batch.Command, describeBatch(config.Batch))
+		}
+		if config.Report.Interval > 0 && config.Report.Command.configured() {
+			item("Reports", "the match count every %s to `%s`", config.Report.Interval, config.Report.Command)
+		}
+
+		if len(config.Labels) > 0 {
+			var labels []string
+			for _, key := range sortedKeys(config.Labels) {
+				labels = append(labels, key+"="+config.Labels[key])
+			}
+			item("Labels", "%s", strings.Join(labels, ", "))
+		}
+	}
+
+	return out.Flush()
+}
+
+// describeInput says where a collector's lines come from
+func describeInput(config CollectorConfig) string {
+	switch config.Type {
+	case UnixSocketType:
+		return fmt.Sprintf("lines sent to the Unix socket `%s`", config.Socket.Path)
+	case SSHType:
+		return fmt.Sprintf("`%s` on %s over ssh", strings.Join(config.Paths, "`, `"), config.SSH.Host)
+	case ProcessType:
+		return fmt.Sprintf("the `%s` process starting and exiting", config.Process.Name)
+	case ProbeType:
+		return fmt.Sprintf("%s probes of %s every %s", config.Probe.Protocol, config.Probe.Address, config.Probe.Interval)
+	case SQLType:
+		return fmt.Sprintf("the rows of `%s` on %s every %s", config.SQL.Query, config.SQL.Driver, config.SQL.Interval)
+	}
+	return fmt.Sprintf("`%s`", strings.Join(config.Paths, "`, `"))
+}
+
+// describePattern says which lines a collector matches
+func describePattern(config CollectorConfig) string {
+	var parts []string
+	if config.Match != nil {
+		parts = append(parts, "lines matching "+describeMatchTree(*config.Match))
+	} else {
+		if config.Pattern != "" {
+			parts = append(parts, fmt.Sprintf("lines matching `%s`", config.Pattern))
+		}
+		if config.PatternFile != "" {
+			parts = append(parts, fmt.Sprintf("any of the patterns in `%s`", config.PatternFile))
+		}
+	}
+	description := strings.Join(parts, " or ")
+	if config.MatchType != "" && config.MatchType != MatchRegex {
+		description += fmt.Sprintf(" (%s)", config.MatchType)
+	}
+
+	if config.ExcludePattern != "" {
+		description += fmt.Sprintf(", except those matching `%s`", config.ExcludePattern)
+	}
+	if config.Condition != "" {
+		description += fmt.Sprintf(", where `%s`", config.Condition)
+	}
+	for _, comparison := range config.Compare {
+		name := comparison.Group
+		if name == "" {
+			name = comparison.Field
+		}
+		description += fmt.Sprintf(", where `%s %s %g`", name, comparison.Op, comparison.Value)
+	}
+	return description
+}
+
+// describeMatchTree writes out a match tree as an expression
+func describeMatchTree(config MatchConfig) string {
+	join := func(children []MatchConfig, operator string) string {
+		parts := make([]string, len(children))
+		for i, child := range children {
+			parts[i] = describeMatchTree(child)
+		}
+		return "(" + strings.Join(parts, " "+operator+" ") + ")"
+	}
+
+	switch {
+	case config.Pattern != "":
+		return fmt.Sprintf("`%s`", config.Pattern)
+	case config.Not != nil:
+		return "not " + describeMatchTree(*config.Not)
+	case len(config.Any) > 0:
+		return join(config.Any, "or")
+	}
+	return join(config.All, "and")
+}
+
+// describeCommands describes the list of commands run for a match or timeout
+func describeCommands(config CollectorConfig, commands []CommandConfig) string {
+	parts := make([]string, len(commands))
+	for i, command := range commands {
+		parts[i] = fmt.Sprintf("`%s`", command)
+		for fallback := command.Fallback; fallback != nil; fallback = fallback.Fallback {
+			parts[i] += fmt.Sprintf(" (if that fails `%s`)", *fallback)
+		}
+	}
+	if config.CommandsParallel {
+		return strings.Join(parts, " and ") + " at the same time"
+	}
+	return strings.Join(parts, " then ")
+}
+
+// describeBatch says how often a batch is sent off
+func describeBatch(config BatchConfig) string {
+	var when []string
+	if config.Interval > 0 {
+		when = append(when, fmt.Sprintf("every %s", config.Interval))
+	}
+	if config.MaxLines > 0 {
+		when = append(when, fmt.Sprintf("every %d lines", config.MaxLines))
+	}
+	return " " + strings.Join(when, " or ")
+}
+
+// describeLimits describes what holds a match command back
+func describeLimits(config CollectorConfig) string {
+	var limits []string
+	if config.MatchOnce {
+		limits = append(limits, "only once until the next timeout")
+	}
+	if config.SuppressFor > 0 {
+		limits = append(limits, fmt.Sprintf("at most once every %s", config.SuppressFor))
+	}
+	if config.SampleRate > 0 && config.SampleRate < 1 {
+		limits = append(limits, fmt.Sprintf("looking at %g of lines", config.SampleRate))
+	}
+	if len(limits) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(limits, ", ")
+}
+
+func sortedCommandLevels(commands map[string]CommandConfig) []string {
+	var levels []string
+	for level := range commands {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	return levels
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDocs(t *testing.T) {
+	configs := LogPulseConfig{
+		CollectorConfig{
+			Name:        "payments",
+			Description: "Payment processing heartbeat.",
+			RunbookURL:  "https://wiki.example.com/payments",
+			Paths:       []string{"/var/log/payments/*.log"},
+			Pattern:     "^Heartbeat",
+			SuppressFor: 5 * time.Minute,
+			Command:     CommandConfig{Program: "notify", Args: []string{"beat"}},
+			Timeout: TimeoutConfig{
+				Interval: time.Minute,
+				Once:     true,
+				Command:  CommandConfig{Program: "page-oncall"},
+				Commands: []CommandConfig{{Program: "touch", Args: []string{"/tmp/down"}}},
+			},
+			Labels: map[string]string{"team": "payments", "tier": "1"},
+		},
+		CollectorConfig{
+			Name: "api",
+			Type: ProbeType,
+			Probe: ProbeConfig{
+				Protocol: "http",
+				Address:  "http://localhost:8080/health",
+				Interval: 10 * time.Second,
+			},
+			Match: &MatchConfig{All: []MatchConfig{
+				{Pattern: "down"},
+				{Not: &MatchConfig{Pattern: "maintenance"}},
+			}},
+			Compare:   []ComparisonConfig{{Field: "latency_ms", Op: ">", Value: 500}},
+			Threshold: ThresholdConfig{Count: 3, Window: time.Minute},
+			Command:   CommandConfig{Program: "restart-api"},
+		},
+	}
+
+	var output bytes.Buffer
+	assert.Nil(t, WriteDocs(&output, configs))
+	assert.Equal(t, "# Log Pulse Collectors\n"+
+		"\n## payments\n\n"+
+		"Payment processing heartbeat.\n\n"+
+		"Runbook: https://wiki.example.com/payments\n\n"+
+		"- **Watches:** `/var/log/payments/*.log`\n"+
+		"- **Looks for:** lines matching `^Heartbeat`\n"+
+		"- **On match:** Every matching line runs `notify beat`, at most once every 5m0s\n"+
+		"- **On timeout:** 1m0s without a match runs `page-oncall` then `touch /tmp/down`, once until the pattern is seen again\n"+
+		"- **Labels:** team=payments, tier=1\n"+
+		"\n## api\n\n"+
+		"- **Watches:** http probes of http://localhost:8080/health every 10s\n"+
+		"- **Looks for:** lines matching (`down` and not `maintenance`), where `latency_ms > 500`\n"+
+		"- **On match:** 3 matching lines within 1m0s runs `restart-api`\n",
+		output.String())
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// By default a collector's timeout runs on the wall clock: a match resets it and it fires
+// once interval goes by without one. That falls apart when FileBeat backfills a cold file,
+// hours of lines arrive in a second and a gap in the middle of them goes unnoticed. With a
+// timestamp configured every line's own time drives an event clock instead, and a timeout
+// fires whenever the event clock moves interval past the last match. The wall clock timer
+// is still there for when no lines come in at all, but any line with a timestamp resets it
+// since from then on noticing missing matches is the event clock's job.
+
+// timestampParser pulls the time out of a line
+type timestampParser struct {
+	pattern  *regexp.Regexp
+	layout   string
+	location *time.Location
+}
+
+func newTimestampParser(config TimestampConfig) (*timestampParser, error) {
+	pattern, err := regexp.Compile(config.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if pattern.NumSubexp() < 1 {
+		return nil, errors.New("The timestamp pattern needs a group capturing the timestamp")
+	}
+
+	layout := config.Layout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	location := time.Local
+	if config.Timezone != "" {
+		if location, err = time.LoadLocation(config.Timezone); err != nil {
+			return nil, fmt.Errorf("Unknown timestamp timezone %s: %s", config.Timezone, err)
+		}
+	}
+
+	return &timestampParser{
+		pattern:  pattern,
+		layout:   layout,
+		location: location,
+	}, nil
+}
+
+// parse returns the time in a line, if it has one. Layouts without a timezone are taken to
+// be in our configured one.
+func (parser *timestampParser) parse(line string) (time.Time, bool) {
+	submatches := parser.pattern.FindStringSubmatch(line)
+	if submatches == nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation(parser.layout, submatches[1], parser.location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// advanceEventClock moves our event clock along with the time of a line, firing the timeout
+// for the intervals it passes without a match. However long a gap is it only fires as many
+// times as it takes to get past timeout.misses, so backfilling days of logs doesn't run the
+// timeout command thousands of times.
+func (collector *Collector) advanceEventClock(t time.Time, matched bool) {
+	// Lines are flowing, so leave noticing missing matches to the event clock. Tiers only go
+	// by the wall clock so they're left alone.
+	collector.resetTimeoutTimer()
+
+	if t.After(collector.eventNow) {
+		collector.eventNow = t
+	}
+	if collector.eventTimeoutBase.IsZero() || (matched && t.After(collector.eventTimeoutBase)) {
+		collector.eventTimeoutBase = t
+		return
+	}
+
+	interval := collector.config.Timeout.Interval
+	if interval <= 0 {
+		return
+	}
+
+	missed := int(collector.eventNow.Sub(collector.eventTimeoutBase) / interval)
+	if missed < 1 {
+		return
+	}
+	collector.eventTimeoutBase = collector.eventTimeoutBase.Add(time.Duration(missed) * interval)
+	logp.Debug("log-pulse", "Event time passed %d timeout intervals without a match", missed)
+
+	fire := collector.config.Timeout.Misses
+	if fire < 1 {
+		fire = 1
+	}
+	if missed < fire {
+		fire = missed
+	}
+	for i := 0; i < fire; i++ {
+		collector.handleTimeout()
+	}
+}
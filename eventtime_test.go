@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampParser(t *testing.T) {
+	_, err := newTimestampParser(TimestampConfig{Pattern: `^\S+`})
+	assert.NotNil(t, err)
+	_, err = newTimestampParser(TimestampConfig{Pattern: `^(\S+)`, Timezone: "Mars/Olympus_Mons"})
+	assert.NotNil(t, err)
+
+	parser, err := newTimestampParser(TimestampConfig{Pattern: `^(\S+)`})
+	assert.Nil(t, err)
+	parsed, ok := parser.parse("2017-09-01T12:00:00Z INFO heartbeat")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2017, 9, 1, 12, 0, 0, 0, time.UTC), parsed.UTC())
+
+	_, ok = parser.parse("INFO heartbeat")
+	assert.False(t, ok)
+
+	parser, err = newTimestampParser(TimestampConfig{
+		Pattern:  `^\[([^\]]+)\]`,
+		Layout:   "2006-01-02 15:04:05",
+		Timezone: "America/New_York",
+	})
+	assert.Nil(t, err)
+	parsed, ok = parser.parse("[2017-09-01 08:00:00] INFO heartbeat")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2017, 9, 1, 12, 0, 0, 0, time.UTC), parsed.UTC())
+}
+
+func TestCollectorAdvanceEventClock(t *testing.T) {
+	collector := Collector{
+		config: CollectorConfig{
+			Timeout: TimeoutConfig{Interval: time.Minute},
+		},
+	}
+	start := time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	// Lines within the interval are fine
+	collector.advanceEventClock(start, true)
+	collector.advanceEventClock(start.Add(30*time.Second), false)
+	assert.Equal(t, 0, collector.missedBeats)
+
+	// A gap of five intervals only fires once
+	collector.advanceEventClock(start.Add(5*time.Minute+10*time.Second), false)
+	assert.Equal(t, 1, collector.missedBeats)
+	assert.True(t, collector.timedOutOnce)
+
+	// The next interval is counted from where the gap left off
+	collector.advanceEventClock(start.Add(5*time.Minute+50*time.Second), false)
+	assert.Equal(t, 1, collector.missedBeats)
+	collector.advanceEventClock(start.Add(6*time.Minute), false)
+	assert.Equal(t, 2, collector.missedBeats)
+
+	// A match starts the interval again, and lines from before it don't move the clock back
+	collector.missedBeats = 0
+	collector.advanceEventClock(start.Add(10*time.Minute), true)
+	collector.advanceEventClock(start.Add(2*time.Minute), false)
+	collector.advanceEventClock(start.Add(10*time.Minute+59*time.Second), false)
+	assert.Equal(t, 0, collector.missedBeats)
+
+	// Enough firings to get past misses
+	collector.config.Timeout.Misses = 3
+	collector.advanceEventClock(start.Add(time.Hour), false)
+	assert.Equal(t, 3, collector.missedBeats)
+}
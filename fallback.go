@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// A command's "fallback" is a second command that only runs when the first one fails:
+// when it exits with anything other than success, can't be started at all or runs for
+// longer than its "timeout" and gets killed. The fallback runs for the same trigger as the
+// command, with the same line, groups and so on, and can have a fallback of its own. The
+// classic is restarting a service and paging someone if that doesn't work.
+
+// fallback returns a function running a command's fallback, or nil if it has none. It's
+// only ever called from process.
+func (collector *Collector) fallback(action string, command CommandConfig, data commandData, env []string) func() {
+	if command.Fallback == nil {
+		return nil
+	}
+	fallback := *command.Fallback
+	return func() {
+		logp.Warn("The %s command %s of collector %s failed, running its fallback %s", action, command, collector.config.Name, fallback)
+		collector.runCommand(action, fallback, data, env)
+	}
+}
+
+// waitWithTimeout returns a function waiting for a started command to exit, killing it if
+// it's still running after timeout. Zero waits for as long as it takes. Everything the
+// command started is killed along with it if it was started in its own process group, as
+// Cmd does for commands with a timeout. Otherwise a shell's children would carry on, and
+// keep us waiting on its output, after the shell itself was killed.
+func waitWithTimeout(cmd *exec.Cmd, timeout time.Duration) func() error {
+	if timeout <= 0 {
+		return func() error {
+			return waitForOutput(cmd)
+		}
+	}
+	return func() error {
+		timer := time.AfterFunc(timeout, func() {
+			killCommand(cmd)
+		})
+		err := waitForOutput(cmd)
+		if !timer.Stop() {
+			return &commandTimedOut{timeout: timeout, err: err}
+		}
+		return err
+	}
+}
+
+// commandTimedOut is the error of a command killed for running for longer than its timeout,
+// err being what waiting for it returned
+type commandTimedOut struct {
+	timeout time.Duration
+	err     error
+}
+
+func (timedOut *commandTimedOut) Error() string {
+	return fmt.Sprintf("killed after running for more than %s: %s", timedOut.timeout, timedOut.err)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitWithTimeout(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	assert.Nil(t, cmd.Start())
+	start := time.Now()
+	err := waitWithTimeout(cmd, 50*time.Millisecond)()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "killed after")
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	cmd = exec.Command("true")
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, waitWithTimeout(cmd, time.Second)())
+}
+
+func TestWaitWithTimeoutKillsChildren(t *testing.T) {
+	// The shell's children hold on to its output, so only killing the shell would leave us
+	// waiting on them
+	command := CommandConfig{Program: "sleep 60 & sleep 60", Shell: true, Output: OutputLog, Timeout: 50 * time.Millisecond}
+	cmd, err := command.Start(nil)
+	assert.Nil(t, err)
+	start := time.Now()
+	err = waitWithTimeout(cmd, command.Timeout)()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "killed after")
+	assert.True(t, time.Since(start) < commandWaitDelay)
+}
+
+func TestCollectorFallback(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	collectorWithFallback := func(program string) *Collector {
+		collector, err := newCollector(CollectorConfig{
+			Pattern: "^Match",
+			Command: CommandConfig{
+				Program: program,
+				Fallback: &CommandConfig{
+					Program: "sh",
+					Args:    []string{"-c", "echo \"$1\" >> " + filepath.Join(tmpDir, program), "sh", "{{.Line}}"},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		return collector
+	}
+
+	// Only a failing command falls back
+	for _, program := range []string{"true", "false", "log-pulse-no-such-program"} {
+		collector := collectorWithFallback(program)
+		go collector.process()
+		collector.lines <- "Match " + program
+		time.Sleep(100 * time.Millisecond)
+		close(collector.Done)
+		<-collector.Stopped
+	}
+
+	_, err := os.Stat(filepath.Join(tmpDir, "true"))
+	assert.True(t, os.IsNotExist(err))
+	for _, program := range []string{"false", "log-pulse-no-such-program"} {
+		contents, err := ioutil.ReadFile(filepath.Join(tmpDir, program))
+		assert.Nil(t, err)
+		assert.Equal(t, "Match "+program+"\n", string(contents))
+	}
+}
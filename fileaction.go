@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// By far the most common command is dropping a flag file for something else to notice, and
+// starting touch or sh for it costs a process every time and doesn't work on Windows at all.
+// Instead of a program any command can "touch" a file, creating it if it doesn't exist, or
+// "write_file" or "append_file" some content, which can be a template like a command's
+// args. A newline is added to content that doesn't end with one so appended lines don't run
+// together. write_file replaces the file in one go, through a temporary file renamed over
+// it, so whatever reads it never sees half of it.
+//
+// Paths aren't templates, a line shouldn't get to choose which file is written to.
+
+const (
+	// FileTouch creates a file or updates its modification time
+	FileTouch = "touch"
+	// FileWrite replaces a file's content
+	FileWrite = "write_file"
+	// FileAppend adds to a file's content
+	FileAppend = "append_file"
+)
+
+// fileAction returns which of touch, write_file and append_file a command does, along with
+// its path and content, or "" if it does none of them
+func (commandConfig CommandConfig) fileAction() (string, string, string) {
+	switch {
+	case commandConfig.Touch != "":
+		return FileTouch, commandConfig.Touch, ""
+	case commandConfig.WriteFile.Path != "":
+		return FileWrite, commandConfig.WriteFile.Path, commandConfig.WriteFile.Content
+	case commandConfig.AppendFile.Path != "":
+		return FileAppend, commandConfig.AppendFile.Path, commandConfig.AppendFile.Content
+	}
+	return "", "", ""
+}
+
+// validateFileAction checks a command's file action, and that it doesn't do anything else
+func validateFileAction(command CommandConfig) error {
+	if command.WriteFile.Content != "" && command.WriteFile.Path == "" {
+		return errors.New("write_file needs a path")
+	}
+	if command.AppendFile.Content != "" && command.AppendFile.Path == "" {
+		return errors.New("append_file needs a path")
+	}
+
+	if kinds := command.kinds(); len(kinds) > 1 {
+		return fmt.Errorf("A command can only do one thing, %s does %s", command, strings.Join(kinds, " and "))
+	}
+	return nil
+}
+
+// startFileAction does a command's file action, returning a function that waits for it to
+// be done
+func (commandConfig CommandConfig) startFileAction() (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not executing: %s", commandConfig)
+		return nil, ErrExecDisabled
+	}
+
+	action, path, content := commandConfig.fileAction()
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	logp.Info("Executing command: %s", commandConfig)
+	switch action {
+	case FileTouch:
+		return func() error { return touchFile(path) }, nil
+	case FileWrite:
+		return func() error { return writeFile(path, content) }, nil
+	}
+	return func() error { return appendFile(path, content) }, nil
+}
+
+// touchFile creates a file if it doesn't exist and sets its modification time to now
+func touchFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// writeFile replaces a file's content, through a temporary file next to it
+func writeFile(path string, content string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// TempFile creates files only we can read, a flag file is for others to see
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// appendFile adds content to the end of a file, creating it if it doesn't exist
+func appendFile(path string, content string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
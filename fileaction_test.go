@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFileAction(t *testing.T) {
+	assert.Nil(t, validateFileAction(CommandConfig{Touch: "/tmp/flag"}))
+	assert.Nil(t, validateFileAction(CommandConfig{WriteFile: FileContentConfig{Path: "/tmp/flag", Content: "{{.Line}}"}}))
+	assert.Nil(t, validateFileAction(CommandConfig{Program: "true"}))
+
+	assert.NotNil(t, validateFileAction(CommandConfig{Program: "true", Touch: "/tmp/flag"}))
+	assert.NotNil(t, validateFileAction(CommandConfig{Touch: "/tmp/flag", AppendFile: FileContentConfig{Path: "/tmp/log"}}))
+	assert.NotNil(t, validateFileAction(CommandConfig{AppendFile: FileContentConfig{Content: "no path"}}))
+}
+
+func TestFileActions(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	run := func(command CommandConfig, data commandData) {
+		expanded, err := command.expand(data)
+		assert.Nil(t, err)
+		wait, err := expanded.startFileAction()
+		assert.Nil(t, err)
+		assert.Nil(t, wait())
+	}
+	data := commandData{Line: "deploy 1.2 finished", Groups: map[string]string{"version": "1.2"}}
+
+	// Touching creates the file, and again bumps its modification time
+	flag := filepath.Join(tmpDir, "flag")
+	run(CommandConfig{Touch: flag}, data)
+	assertFileExists(t, flag)
+	old := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(flag, old, old))
+	run(CommandConfig{Touch: flag}, data)
+	info, err := os.Stat(flag)
+	assert.Nil(t, err)
+	assert.True(t, info.ModTime().After(old.Add(time.Minute)))
+
+	// Writing replaces the content
+	version := filepath.Join(tmpDir, "version")
+	write := CommandConfig{WriteFile: FileContentConfig{Path: version, Content: "{{.Groups.version}}"}}
+	run(write, data)
+	run(write, commandData{Groups: map[string]string{"version": "1.3"}})
+	contents, err := ioutil.ReadFile(version)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3\n", string(contents))
+
+	// Appending adds to it
+	deploys := filepath.Join(tmpDir, "deploys.log")
+	appendLine := CommandConfig{AppendFile: FileContentConfig{Path: deploys, Content: "{{.Line}}"}}
+	run(appendLine, data)
+	run(appendLine, data)
+	contents, err = ioutil.ReadFile(deploys)
+	assert.Nil(t, err)
+	assert.Equal(t, "deploy 1.2 finished\ndeploy 1.2 finished\n", string(contents))
+
+	// Content can span lines, whether the template or what it's filled in with does
+	events := filepath.Join(tmpDir, "events.log")
+	appendEvent := CommandConfig{AppendFile: FileContentConfig{Path: events, Content: "{{.Collector}} matched:\n{{.Line}}"}}
+	run(appendEvent, commandData{Collector: "app", Line: "Exception\n  at Main"})
+	contents, err = ioutil.ReadFile(events)
+	assert.Nil(t, err)
+	assert.Equal(t, "app matched:\nException\n  at Main\n", string(contents))
+
+	// Nothing's left behind next to the files
+	files, _ := ioutil.ReadDir(tmpDir)
+	assert.Equal(t, 4, len(files))
+
+	assert.Equal(t, "write_file "+version, write.String())
+	assert.True(t, write.configured())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// "file_output" appends every matching line to a file, for pulling a filtered log out of a
+// busy one without running a command per line. The line can be reformatted with a template
+// taking the same placeholders as commands, and the file is rotated once it grows past
+// max_bytes, keeping max_backups old files named <path>.1 (the newest) to <path>.N.
+//
+// Lines are written as they're matched, whatever the collector's threshold, suppression and
+// so on say about running its command. Canaries only log that they would have written them.
+
+// fileOutput is an open file_output
+type fileOutput struct {
+	config FileOutputConfig
+	// nil writes the line as it is
+	format *template.Template
+
+	file *os.File
+	size int64
+}
+
+// newFileOutput checks a file_output configuration, returning nil if there's none. The file
+// isn't opened until the first line is written.
+func newFileOutput(config FileOutputConfig) (*fileOutput, error) {
+	if config.Path == "" {
+		if config.Format != "" || config.MaxBytes != 0 || config.MaxBackups != 0 {
+			return nil, errors.New("A file_output needs a path")
+		}
+		return nil, nil
+	}
+	if config.MaxBytes < 0 || config.MaxBackups < 0 {
+		return nil, errors.New("A file_output's max_bytes and max_backups can't be negative")
+	}
+	if err := validateSanitize(config.Sanitize); err != nil {
+		return nil, err
+	}
+
+	output := &fileOutput{config: config}
+	if config.Format != "" {
+		format, err := parseTemplate(config.Format)
+		if err != nil {
+			return nil, err
+		}
+		output.format = format
+	}
+	return output, nil
+}
+
+// write appends a matching line to the file, rotating it first if it's grown too big
+func (output *fileOutput) write(data commandData) error {
+	data.Line = sanitize(output.config.Sanitize, data.Line)
+	data.Groups = sanitizeGroups(output.config.Sanitize, data.Groups)
+
+	text := []byte(data.Line)
+	if output.format != nil {
+		var buffer bytes.Buffer
+		if err := output.format.Execute(&buffer, data); err != nil {
+			return err
+		}
+		text = buffer.Bytes()
+	}
+	text = append(text, '\n')
+
+	if output.file != nil && output.config.MaxBytes > 0 && output.size+int64(len(text)) > output.config.MaxBytes {
+		if err := output.rotate(); err != nil {
+			return err
+		}
+	}
+	if output.file == nil {
+		if err := output.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := output.file.Write(text)
+	output.size += int64(n)
+	return err
+}
+
+func (output *fileOutput) open() error {
+	file, err := os.OpenFile(output.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	output.file = file
+	output.size = info.Size()
+	return nil
+}
+
+// rotate moves every file along by one, dropping the oldest, and leaves the next write to
+// start a new one
+func (output *fileOutput) rotate() error {
+	output.close()
+
+	path := output.config.Path
+	if output.config.MaxBackups == 0 {
+		return os.Remove(path)
+	}
+	for i := output.config.MaxBackups - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+func (output *fileOutput) close() {
+	if output != nil && output.file != nil {
+		output.file.Close()
+		output.file = nil
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFileOutput(t *testing.T) {
+	output, err := newFileOutput(FileOutputConfig{})
+	assert.Nil(t, output)
+	assert.Nil(t, err)
+
+	_, err = newFileOutput(FileOutputConfig{Format: "{{.Line}}"})
+	assert.NotNil(t, err)
+	_, err = newFileOutput(FileOutputConfig{Path: "/tmp/out", Format: "{{.Line"})
+	assert.NotNil(t, err)
+	_, err = newFileOutput(FileOutputConfig{Path: "/tmp/out", MaxBytes: -1})
+	assert.NotNil(t, err)
+}
+
+func TestFileOutputRotation(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "matches.log")
+	output, err := newFileOutput(FileOutputConfig{
+		Path:       path,
+		Format:     "{{.Collector}}: {{.Line}}",
+		MaxBytes:   24,
+		MaxBackups: 2,
+	})
+	assert.Nil(t, err)
+	defer output.close()
+
+	// Each line is 12 bytes, so every file holds two of them
+	for _, line := range []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7"} {
+		assert.Nil(t, output.write(commandData{Collector: "app", Line: line}))
+	}
+
+	read := func(path string) string {
+		contents, _ := ioutil.ReadFile(path)
+		return string(contents)
+	}
+	assert.Equal(t, "app: line 7\n", read(path))
+	assert.Equal(t, "app: line 5\napp: line 6\n", read(path+".1"))
+	assert.Equal(t, "app: line 3\napp: line 4\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCollectorProcessFileOutput(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "matches.log")
+	config := CollectorConfig{
+		Pattern:     "^Match",
+		SuppressFor: time.Hour,
+		FileOutput:  FileOutputConfig{Path: path},
+	}
+	collector, err := newCollector(config)
+	assert.Nil(t, err)
+	collector.timeoutChannel = make(chan time.Time)
+
+	go collector.process()
+	collector.lines <- "Match 1"
+	collector.lines <- "No match"
+	collector.lines <- "Match 2"
+	close(collector.Done)
+	<-collector.Stopped
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "Match 1\nMatch 2\n", string(contents))
+}
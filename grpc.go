@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"golang.org/x/net/http2"
+)
+
+// Automation platforms tend to want a typed RPC rather than a program run or a webhook.
+// Instead of a program any command can have a "grpc" endpoint, which gets a unary call with
+// a PulseEvent describing what set the command off, as defined in pulse.proto. The call
+// counts as failed unless it returns an OK status.
+//
+// Like the metrics in metric.go there's no client library behind it: a unary call is an
+// HTTP/2 POST with a length prefixed protobuf message, and the PulseEvent is simple enough
+// to encode by hand. That does mean the endpoint has to speak TLS, as Go's HTTP/2 client
+// only does HTTP/2 over TLS, set up like the rest of our TLS (see tls.go). With a cert and
+// key we present a client certificate too, for mTLS.
+
+// DefaultGRPCMethod is the method called when none is configured
+const DefaultGRPCMethod = "/logpulse.Pulse/Event"
+
+// grpcTimeout is how long a call gets unless the command has a timeout
+const grpcTimeout = 10 * time.Second
+
+// pulseEvent is what a grpc command sends, see pulse.proto. The sns and lambda commands in
+// aws.go send it as JSON.
+type pulseEvent struct {
+	Collector   string            `json:"collector"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Type        string            `json:"type"`
+	Line        string            `json:"line,omitempty"`
+	File        string            `json:"file,omitempty"`
+	Groups      map[string]string `json:"groups,omitempty"`
+	Severity    string            `json:"severity,omitempty"`
+	Count       int               `json:"count,omitempty"`
+	Before      []string          `json:"before,omitempty"`
+	After       []string          `json:"after,omitempty"`
+	Time        time.Time         `json:"time"`
+	LastMatch   *time.Time        `json:"last_match,omitempty"`
+	Description string            `json:"description,omitempty"`
+	RunbookURL  string            `json:"runbook_url,omitempty"`
+}
+
+// validateGRPC checks a command's grpc endpoint
+func validateGRPC(command CommandConfig) error {
+	config := command.GRPC
+	if config.Address == "" {
+		if config.Method != "" || config.TLSConfig.isSet() {
+			return errors.New("A grpc command needs an address")
+		}
+		return nil
+	}
+	if len(command.kinds()) > 1 {
+		return fmt.Errorf("A grpc command can't do anything else, %s does", command)
+	}
+	if err := config.TLSConfig.validate(); err != nil {
+		return err
+	}
+	if config.Method != "" && !strings.HasPrefix(config.Method, "/") {
+		return fmt.Errorf("The grpc method %q should look like /package.Service/Method", config.Method)
+	}
+	return nil
+}
+
+// method is the full name of the method called
+func (config GRPCConfig) method() string {
+	if config.Method == "" {
+		return DefaultGRPCMethod
+	}
+	return config.Method
+}
+
+// String describes the call for log messages and docs
+func (config GRPCConfig) String() string {
+	return config.Address + config.method()
+}
+
+// tlsConfig sets up TLS for the call, reading the certificates every time so they can be
+// rotated underneath us
+func (config GRPCConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig, err := config.TLSConfig.load()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.NextProtos = []string{"h2"}
+	return tlsConfig, nil
+}
+
+// Start makes the call, returning a function that waits for its result
+func (config GRPCConfig) Start(event pulseEvent, timeout time.Duration) (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not calling %s", config)
+		return nil, ErrExecDisabled
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = grpcTimeout
+	}
+
+	logp.Info("Calling %s", config)
+	return func() error {
+		// net/http only speaks HTTP/2 by itself without a TLS config of our own
+		transport := &http.Transport{DialContext: networkDialer.DialContext, TLSClientConfig: tlsConfig}
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return err
+		}
+		defer transport.CloseIdleConnections()
+		client := http.Client{Transport: transport, Timeout: timeout}
+		return callGRPC(&client, config, event.marshal())
+	}, nil
+}
+
+// callGRPC makes a unary call, reporting whether it returned an OK status
+func callGRPC(client *http.Client, config GRPCConfig, message []byte) error {
+	body := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(message)))
+	body = append(body, message...)
+
+	endpoint := url.URL{Scheme: "https", Host: config.Address, Path: config.method()}
+	req, err := http.NewRequest("POST", endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The status comes in the trailers, which are only there once the body has been read
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		return fmt.Errorf("%s doesn't speak HTTP/2, it can't be a gRPC server", config.Address)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("The gRPC server answered with %s", resp.Status)
+	}
+
+	// A call failing straight away puts its status in the headers instead
+	status, reason := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, reason = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return errors.New("The gRPC server didn't send a status")
+	}
+	if decoded, err := url.PathUnescape(reason); err == nil {
+		reason = decoded
+	}
+	return fmt.Errorf("The gRPC call failed with status %s: %s", status, reason)
+}
+
+// pulseEvent describes what set a grpc, sns or lambda command off
+func (collector *Collector) pulseEvent(action string, command CommandConfig, data commandData) pulseEvent {
+	event := pulseEvent{
+		Collector:   data.Collector,
+		Labels:      collector.config.Labels,
+		Type:        action,
+		Line:        sanitize(command.Sanitize, data.Line),
+		File:        data.File,
+		Groups:      sanitizeGroups(command.Sanitize, data.Groups),
+		Severity:    data.Severity,
+		Count:       data.Count,
+		Before:      sanitizeLines(command.Sanitize, data.Before),
+		After:       sanitizeLines(command.Sanitize, data.After),
+		Time:        time.Now(),
+		Description: data.Description,
+		RunbookURL:  data.RunbookURL,
+	}
+	if lastMatch := collector.stats.LastMatch; !lastMatch.IsZero() {
+		event.LastMatch = &lastMatch
+	}
+	return event
+}
+
+// marshal encodes the event in protobuf's wire format, leaving out empty fields like proto3
+// does
+func (event pulseEvent) marshal() []byte {
+	var buf protoBuffer
+	buf.string(1, event.Collector)
+	buf.stringMap(2, event.Labels)
+	buf.string(3, event.Type)
+	buf.string(4, event.Line)
+	buf.string(5, event.File)
+	buf.stringMap(6, event.Groups)
+	buf.string(7, event.Severity)
+	buf.int64(8, int64(event.Count))
+	for _, line := range event.Before {
+		buf.bytes(9, []byte(validUTF8(line)))
+	}
+	for _, line := range event.After {
+		buf.bytes(10, []byte(validUTF8(line)))
+	}
+	if !event.Time.IsZero() {
+		buf.int64(11, event.Time.UnixNano())
+	}
+	if event.LastMatch != nil {
+		buf.int64(12, event.LastMatch.UnixNano())
+	}
+	buf.string(13, event.Description)
+	buf.string(14, event.RunbookURL)
+	return buf.Bytes()
+}
+
+// protoBuffer writes protobuf fields
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (buf *protoBuffer) varint(value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	buf.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
+
+// bytes writes a length delimited field, even if it's empty
+func (buf *protoBuffer) bytes(field int, value []byte) {
+	buf.varint(uint64(field)<<3 | 2)
+	buf.varint(uint64(len(value)))
+	buf.Write(value)
+}
+
+// string writes a string field. proto3 strings have to be UTF-8, which log lines needn't be.
+func (buf *protoBuffer) string(field int, value string) {
+	if value != "" {
+		buf.bytes(field, []byte(validUTF8(value)))
+	}
+}
+
+// validUTF8 replaces every byte of value that isn't part of valid UTF-8 with U+FFFD
+func validUTF8(value string) string {
+	if utf8.ValidString(value) {
+		return value
+	}
+	// Which is what converting to runes does
+	return string([]rune(value))
+}
+
+func (buf *protoBuffer) int64(field int, value int64) {
+	if value != 0 {
+		buf.varint(uint64(field) << 3)
+		buf.varint(uint64(value))
+	}
+}
+
+// stringMap writes a map<string, string>, an entry message with the key and value for each
+func (buf *protoBuffer) stringMap(field int, values map[string]string) {
+	for _, key := range sortedKeys(values) {
+		var entry protoBuffer
+		entry.string(1, key)
+		entry.string(2, values[key])
+		buf.bytes(field, entry.Bytes())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGRPC(t *testing.T) {
+	assert.Nil(t, validateGRPC(CommandConfig{Program: "touch"}))
+	assert.Nil(t, validateGRPC(CommandConfig{GRPC: GRPCConfig{Address: "automation:443"}}))
+	assert.Nil(t, validateGRPC(CommandConfig{GRPC: GRPCConfig{Address: "automation:443", TLSConfig: TLSConfig{Cert: "client.pem", Key: "client.key"}}}))
+
+	assert.NotNil(t, validateGRPC(CommandConfig{GRPC: GRPCConfig{TLSConfig: TLSConfig{CA: "ca.pem"}}}))
+	assert.NotNil(t, validateGRPC(CommandConfig{GRPC: GRPCConfig{Address: "automation:443", TLSConfig: TLSConfig{Cert: "client.pem"}}}))
+	assert.NotNil(t, validateGRPC(CommandConfig{GRPC: GRPCConfig{Address: "automation:443", Method: "Pulse/Event"}}))
+	assert.NotNil(t, validateGRPC(CommandConfig{Program: "touch", GRPC: GRPCConfig{Address: "automation:443"}}))
+}
+
+// protoFields decodes a message into its length delimited and varint fields
+func protoFields(t *testing.T, message []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		message = message[n:]
+		field := int(key >> 3)
+		if key&7 == 0 {
+			_, n = binary.Uvarint(message)
+			fields[field] = append(fields[field], message[:n])
+			message = message[n:]
+			continue
+		}
+		assert.Equal(t, uint64(2), key&7)
+		length, n := binary.Uvarint(message)
+		message = message[n:]
+		fields[field] = append(fields[field], message[:length])
+		message = message[length:]
+	}
+	return fields
+}
+
+func TestPulseEventMarshal(t *testing.T) {
+	fields := protoFields(t, pulseEvent{
+		Collector: "payments",
+		Type:      MatchAction,
+		Line:      "ERROR payment failed",
+		Groups:    map[string]string{"b": "2", "a": "1"},
+		Before:    []string{"one", ""},
+		Time:      time.Unix(0, 300),
+	}.marshal())
+
+	assert.Equal(t, [][]byte{[]byte("payments")}, fields[1])
+	assert.Equal(t, [][]byte{[]byte(MatchAction)}, fields[3])
+	assert.Equal(t, [][]byte{[]byte("ERROR payment failed")}, fields[4])
+	assert.Equal(t, [][]byte{[]byte("one"), []byte("")}, fields[9])
+	value, _ := binary.Uvarint(fields[11][0])
+	assert.Equal(t, uint64(300), value)
+
+	// Map entries come in key order
+	assert.Equal(t, 2, len(fields[6]))
+	entry := protoFields(t, fields[6][0])
+	assert.Equal(t, "a", string(entry[1][0]))
+	assert.Equal(t, "1", string(entry[2][0]))
+
+	// Empty fields are left out
+	_, ok := fields[5]
+	assert.False(t, ok)
+	_, ok = fields[12]
+	assert.False(t, ok)
+}
+
+func TestPulseEventMarshalInvalidUTF8(t *testing.T) {
+	// Log lines needn't be UTF-8, but proto3 strings have to be
+	fields := protoFields(t, pulseEvent{
+		Line:   "caf\xe9 closed",
+		Groups: map[string]string{"user": "\xff"},
+		After:  []string{"ok", "\xc3"},
+	}.marshal())
+
+	assert.Equal(t, "caf\uFFFD closed", string(fields[4][0]))
+	assert.Equal(t, "\uFFFD", string(protoFields(t, fields[6][0])[2][0]))
+	assert.Equal(t, [][]byte{[]byte("ok"), []byte("\uFFFD")}, fields[10])
+}
+
+func TestGRPCCommand(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	var received map[int][][]byte
+	status := "0"
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, DefaultGRPCMethod, r.URL.Path)
+		assert.Equal(t, "application/grpc+proto", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, byte(0), body[0])
+		assert.Equal(t, uint32(len(body)-5), binary.BigEndian.Uint32(body[1:5]))
+		received = protoFields(t, body[5:])
+
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", status)
+		w.Header().Set("Grpc-Message", "no%20such%20job")
+	}))
+	server.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	server.StartTLS()
+	defer server.Close()
+
+	ca := filepath.Join(tmpDir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+
+	config := GRPCConfig{Address: server.Listener.Addr().String(), TLSConfig: TLSConfig{CA: ca}}
+	wait, err := config.Start(pulseEvent{Collector: "payments", Type: TimeoutAction}, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, wait())
+	assert.Equal(t, "payments", string(received[1][0]))
+	assert.Equal(t, TimeoutAction, string(received[3][0]))
+
+	status = "5"
+	wait, err = config.Start(pulseEvent{Collector: "payments"}, 0)
+	assert.Nil(t, err)
+	err = wait()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 5: no such job")
+
+	// Without the CA the server isn't trusted
+	wait, err = GRPCConfig{Address: config.Address}.Start(pulseEvent{}, time.Second)
+	assert.Nil(t, err)
+	assert.NotNil(t, wait())
+
+	_, err = GRPCConfig{Address: config.Address, TLSConfig: TLSConfig{Cert: filepath.Join(tmpDir, "missing.pem"), Key: filepath.Join(tmpDir, "missing.key")}}.Start(pulseEvent{}, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// histogramBounds are the upper bounds of a DurationHistogram's buckets. Anything slower
+// than the last one lands in a final overflow bucket.
+var histogramBounds = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// DurationHistogram counts how long something took in fixed buckets, which is enough to
+// tell a command that usually takes 50ms from one that's started taking 30s without
+// keeping every duration around
+type DurationHistogram struct {
+	// One count per histogramBounds entry plus the overflow
+	Buckets []int         `json:"buckets"`
+	Count   int           `json:"count"`
+	Sum     time.Duration `json:"sum"`
+	// How many of them exited with anything other than success
+	Failures int `json:"failures"`
+}
+
+func (histogram *DurationHistogram) record(duration time.Duration) {
+	if len(histogram.Buckets) != len(histogramBounds)+1 {
+		histogram.Buckets = make([]int, len(histogramBounds)+1)
+	}
+
+	bucket := len(histogramBounds)
+	for i, bound := range histogramBounds {
+		if duration <= bound {
+			bucket = i
+			break
+		}
+	}
+	histogram.Buckets[bucket]++
+	histogram.Count++
+	histogram.Sum += duration
+}
+
+// Mean is the average duration
+func (histogram DurationHistogram) Mean() time.Duration {
+	if histogram.Count == 0 {
+		return 0
+	}
+	return histogram.Sum / time.Duration(histogram.Count)
+}
+
+// String describes the histogram on one line, leaving out empty buckets
+func (histogram DurationHistogram) String() string {
+	parts := []string{fmt.Sprintf("%d runs, mean %s", histogram.Count, histogram.Mean())}
+	if histogram.Failures > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", histogram.Failures))
+	}
+	for i, count := range histogram.Buckets {
+		if count == 0 {
+			continue
+		}
+		if i < len(histogramBounds) {
+			parts = append(parts, fmt.Sprintf("<=%s: %d", histogramBounds[i], count))
+		} else {
+			parts = append(parts, fmt.Sprintf(">%s: %d", histogramBounds[len(histogramBounds)-1], count))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationHistogram(t *testing.T) {
+	var histogram DurationHistogram
+	assert.Equal(t, time.Duration(0), histogram.Mean())
+
+	histogram.record(5 * time.Millisecond)
+	histogram.record(10 * time.Millisecond)
+	histogram.record(2 * time.Second)
+	histogram.record(2 * time.Minute)
+
+	assert.Equal(t, 4, histogram.Count)
+	assert.Equal(t, 2, histogram.Buckets[0])
+	assert.Equal(t, 1, histogram.Buckets[5])
+	assert.Equal(t, 1, histogram.Buckets[len(histogramBounds)])
+	assert.Equal(t, 30*time.Second+503750*time.Microsecond, histogram.Mean())
+	assert.Equal(t, "4 runs, mean 30.50375s, <=10ms: 2, <=5s: 1, >1m0s: 1", histogram.String())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// DefaultInfluxInterval is how often match counts are pushed to InfluxDB when no interval
+// is given
+const DefaultInfluxInterval = time.Minute
+
+// influxTimeout is how long we give InfluxDB to accept a write
+const influxTimeout = 10 * time.Second
+
+// For edge hosts where running a scraper isn't an option Log Pulse can push the history of
+// its collectors straight to InfluxDB instead. Every interval it writes a "logpulse" point
+// per collector, tagged with the collector's name, holding:
+//
+//   matches    - how many lines matched during the interval
+//   match_rate - matches per second over the interval
+//   silence    - seconds since the pattern last matched, left out if it never has
+//
+// using InfluxDB's line protocol, so anything that accepts it (InfluxDB 1.x's /write or
+// Telegraf's http_listener for instance) can take them.
+
+// writeInfluxPeriodically pushes our collectors' counts to InfluxURL every InfluxInterval
+// until we're stopped
+func (collection *Collection) writeInfluxPeriodically() {
+	interval := collection.InfluxInterval
+	if interval <= 0 {
+		interval = DefaultInfluxInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Only count what matches from here on, not what was loaded from the stats file
+	previous := matchTotals(collection.Stats())
+	for {
+		select {
+		case now := <-ticker.C:
+			stats := collection.Stats()
+			body := influxLines(stats, previous, interval, now)
+			if err := writeInflux(collection.InfluxURL, collection.InfluxTLS, body); err != nil {
+				logp.Err("Unable to write to InfluxDB at %s: %s", collection.InfluxURL, err)
+			}
+			previous = matchTotals(stats)
+		case <-collection.done:
+			return
+		}
+	}
+}
+
+// matchTotals is how many times each collector has matched altogether
+func matchTotals(stats map[string]CollectorStats) map[string]int {
+	totals := make(map[string]int)
+	for name, collectorStats := range stats {
+		totals[name] = collectorStats.Heatmap.Total()
+	}
+	return totals
+}
+
+// influxLines builds the line protocol points for an interval ending at now
+func influxLines(stats map[string]CollectorStats, previous map[string]int, interval time.Duration, now time.Time) string {
+	var names []string
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines bytes.Buffer
+	for _, name := range names {
+		collectorStats := stats[name]
+		matches := collectorStats.Heatmap.Total() - previous[name]
+		fmt.Fprintf(&lines, "logpulse%s matches=%di,match_rate=%g", influxTags(name, collectorStats.Labels), matches, float64(matches)/interval.Seconds())
+		if !collectorStats.LastMatch.IsZero() {
+			fmt.Fprintf(&lines, ",silence=%g", now.Sub(collectorStats.LastMatch).Seconds())
+		}
+		fmt.Fprintf(&lines, " %d\n", now.UnixNano())
+	}
+	return lines.String()
+}
+
+// influxTags are a collector's tags, its name and labels like metricLabels, in the sorted
+// order InfluxDB prefers. Empty values are left out as line protocol has no room for them.
+func influxTags(name string, labels map[string]string) string {
+	tags := map[string]string{"collector": name}
+	for key, value := range labels {
+		tags[key] = value
+	}
+
+	var buffer bytes.Buffer
+	for _, key := range sortedKeys(tags) {
+		if key == "" || tags[key] == "" {
+			continue
+		}
+		fmt.Fprintf(&buffer, ",%s=%s", influxEscape(key), influxEscape(tags[key]))
+	}
+	return buffer.String()
+}
+
+// influxEscape escapes the characters that are special in line protocol tag keys and values
+func influxEscape(value string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(value)
+}
+
+// writeInflux posts line protocol points to an InfluxDB write endpoint
+func writeInflux(url string, tlsConfig TLSConfig, body string) error {
+	client, err := tlsConfig.httpClient(influxTimeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("InfluxDB answered with %s", resp.Status)
+	}
+	return nil
+}
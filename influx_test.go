@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxLines(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	var web CollectorStats
+	web.Heatmap[time.Monday][9] = 130
+	web.LastMatch = now.Add(-15 * time.Second)
+	web.Labels = map[string]string{"team": "front end", "env": "prod", "empty": ""}
+	var quiet CollectorStats
+
+	stats := map[string]CollectorStats{"web, public=1": web, "quiet": quiet}
+	previous := map[string]int{"web, public=1": 10}
+
+	assert.Equal(t, `logpulse,collector=quiet matches=0i,match_rate=0 1500000000000000000
+logpulse,collector=web\,\ public\=1,env=prod,team=front\ end matches=120i,match_rate=2,silence=15 1500000000000000000
+`, influxLines(stats, previous, time.Minute, now))
+}
+
+func TestWriteInflux(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	assert.Nil(t, writeInflux(server.URL+"/write?db=logpulse", TLSConfig{}, "logpulse,collector=a matches=1i 1\n"))
+	assert.Equal(t, "logpulse,collector=a matches=1i 1\n", body)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	assert.NotNil(t, writeInflux(failing.URL, TLSConfig{}, "logpulse,collector=a matches=1i 1\n"))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A fleet of hosts running the same config, and started by the same deploy, times out at the
+// same second and has every one of them hit the same webhook at once. "timeout.jitter" holds
+// each timeout back by a random amount of up to either a duration ("30s") or a percentage of
+// the interval being waited out ("10%"), picked again every time. The timeout still counts from the last
+// match, so a match within the jitter means the command doesn't run at all.
+
+var (
+	// Seeded per process, so hosts started at the same time still pick different delays
+	jitterRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMutex sync.Mutex
+)
+
+// jitterSetting is a parsed timeout.jitter, either a duration or a fraction of the interval
+// being waited out
+type jitterSetting struct {
+	duration time.Duration
+	fraction float64
+}
+
+// longest returns the longest delay the setting allows for an interval
+func (setting jitterSetting) longest(interval time.Duration) time.Duration {
+	if setting.fraction > 0 {
+		return time.Duration(float64(interval) * setting.fraction)
+	}
+	return setting.duration
+}
+
+// parseJitter parses a jitter setting
+func parseJitter(value string) (jitterSetting, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return jitterSetting{}, nil
+	}
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return jitterSetting{}, fmt.Errorf("Invalid jitter %q, expected a percentage between 0%% and 100%%", value)
+		}
+		return jitterSetting{fraction: percent / 100}, nil
+	}
+
+	jitter, err := time.ParseDuration(value)
+	if err != nil || jitter < 0 {
+		return jitterSetting{}, fmt.Errorf("Invalid jitter %q, expected a duration like 30s or a percentage like 10%%", value)
+	}
+	return jitterSetting{duration: jitter}, nil
+}
+
+// jitter picks how long to hold back a timeout that's interval away, which a schedule or a
+// repeat_interval can make different from timeout.interval
+func (collector *Collector) jitter(interval time.Duration) time.Duration {
+	longest := collector.timeoutJitter.longest(interval)
+	if longest <= 0 {
+		return 0
+	}
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(longest)))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJitter(t *testing.T) {
+	jitter, err := parseJitter("")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), jitter.longest(time.Minute))
+
+	jitter, err = parseJitter("30s")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, jitter.longest(time.Minute))
+	assert.Equal(t, 30*time.Second, jitter.longest(time.Hour))
+
+	// A percentage is of whichever interval is being waited out
+	jitter, err = parseJitter("10%")
+	assert.Nil(t, err)
+	assert.Equal(t, 6*time.Second, jitter.longest(time.Minute))
+	assert.Equal(t, 6*time.Minute, jitter.longest(time.Hour))
+
+	for _, invalid := range []string{"soon", "-5s", "-10%", "150%", "x%"} {
+		_, err := parseJitter(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	collector := Collector{}
+	assert.Equal(t, time.Duration(0), collector.jitter(time.Minute))
+
+	collector.timeoutJitter = jitterSetting{duration: time.Second}
+	for i := 0; i < 100; i++ {
+		jitter := collector.jitter(time.Minute)
+		assert.True(t, jitter >= 0 && jitter < time.Second)
+	}
+
+	collector.timeoutJitter = jitterSetting{fraction: 0.5}
+	for i := 0; i < 100; i++ {
+		jitter := collector.jitter(time.Second)
+		assert.True(t, jitter >= 0 && jitter < 500*time.Millisecond)
+	}
+
+	_, err := newCollector(CollectorConfig{Pattern: "x", Timeout: TimeoutConfig{Interval: time.Minute, Jitter: "soon"}})
+	assert.NotNil(t, err)
+}
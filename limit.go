@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Every matching line can start a process, so a log storm can start thousands of them at
+// once. A collector's "max_running_commands" caps how many of its commands run at the same
+// time and --max-running-commands caps it across every collector. A command that doesn't
+// fit under the caps is dropped, or with "command_overflow: queue" waits for a slot.
+//
+// The caps are buffered channels with one slot per command that may run, taken before a
+// command starts and given back once it exits. A nil channel is no cap at all.
+
+const (
+	// OverflowDrop drops commands that don't fit under the caps, the default
+	OverflowDrop = "drop"
+	// OverflowQueue holds commands that don't fit under the caps until a slot frees up
+	OverflowQueue = "queue"
+)
+
+// newCommandSlots creates the slots for a cap on running commands, nil meaning no cap
+func newCommandSlots(max int) chan struct{} {
+	if max <= 0 {
+		return nil
+	}
+	return make(chan struct{}, max)
+}
+
+// validateCommandLimit checks a collector's cap on running commands
+func validateCommandLimit(config CollectorConfig) error {
+	if config.MaxRunningCommands < 0 {
+		return fmt.Errorf("max_running_commands can't be negative, got %d", config.MaxRunningCommands)
+	}
+	switch config.CommandOverflow {
+	case "", OverflowDrop, OverflowQueue:
+		return nil
+	}
+	return fmt.Errorf("Unknown command_overflow %q, expected drop or queue", config.CommandOverflow)
+}
+
+// tryAcquireSlots takes a slot from every cap without waiting, taking none if any of them
+// is full
+func tryAcquireSlots(slots ...chan struct{}) bool {
+	for i, s := range slots {
+		if s == nil {
+			continue
+		}
+		select {
+		case s <- struct{}{}:
+		default:
+			releaseSlots(slots[:i]...)
+			return false
+		}
+	}
+	return true
+}
+
+// acquireSlots waits for a slot from every cap, giving up if done is closed first. Slots are
+// always taken in the same order so that two waiting commands can't each hold what the
+// other is waiting for.
+func acquireSlots(done <-chan struct{}, slots ...chan struct{}) bool {
+	for i, s := range slots {
+		if s == nil {
+			continue
+		}
+		select {
+		case s <- struct{}{}:
+		case <-done:
+			releaseSlots(slots[:i]...)
+			return false
+		}
+	}
+	return true
+}
+
+// releaseSlots gives back the slots taken by acquireSlots or tryAcquireSlots
+func releaseSlots(slots ...chan struct{}) {
+	for _, s := range slots {
+		if s != nil {
+			<-s
+		}
+	}
+}
+
+// startLimited starts a command once it fits under the collector's caps, recording how long
+// it ran for once it exits
+func (collector *Collector) startLimited(action string, prepared preparedCommand) {
+	slots := collector.slots()
+	if tryAcquireSlots(slots...) {
+		if wait, start, ok := collector.startCommand(action, prepared, slots); ok {
+			go collector.waitForCommand(action, prepared, wait, start, slots)
+		}
+		return
+	}
+
+	if collector.config.CommandOverflow != OverflowQueue {
+		logp.Warn("Too many commands running, dropping %s command %s of collector %s", action, prepared.command, collector.config.Name)
+		return
+	}
+
+	logp.Info("Too many commands running, queueing %s command %s of collector %s", action, prepared.command, collector.config.Name)
+	go func() {
+		if !acquireSlots(collector.Done, slots...) {
+			return
+		}
+		if wait, start, ok := collector.startCommand(action, prepared, slots); ok {
+			collector.waitForCommand(action, prepared, wait, start, slots)
+		}
+	}()
+}
+
+// slots are the caps our commands have to fit under
+func (collector *Collector) slots() []chan struct{} {
+	return []chan struct{}{collector.commandSlots, collector.sharedCommandSlots}
+}
+
+// startCommand starts a command holding slots, giving them back if it couldn't be started.
+// Otherwise it returns a function waiting for the command to finish and waitForCommand
+// gives them back once it has.
+func (collector *Collector) startCommand(action string, prepared preparedCommand, slots []chan struct{}) (func() error, time.Time, bool) {
+	command := prepared.command
+	start := time.Now()
+	var wait func() error
+	var err error
+	if command.Systemd.Unit != "" {
+		wait, err = command.Systemd.Start()
+	} else if command.Metric.Name != "" {
+		wait, err = command.Metric.Start(collector.metricLabels())
+	} else if action, _, _ := command.fileAction(); action != "" {
+		wait, err = command.startFileAction()
+	} else if command.Signal.configured() {
+		wait, err = command.Signal.Start()
+	} else if command.GRPC.Address != "" {
+		wait, err = command.GRPC.Start(prepared.event, command.Timeout)
+	} else if command.SNS.TopicARN != "" {
+		wait, err = command.SNS.Start(prepared.event, command.Timeout)
+	} else if command.Lambda.Function != "" {
+		wait, err = command.Lambda.Start(prepared.event, command.Timeout)
+	} else {
+		var cmd *exec.Cmd
+		if cmd, err = command.Start(prepared.env); err == nil {
+			wait = waitWithTimeout(cmd, command.Timeout)
+		}
+	}
+	if err != nil {
+		releaseSlots(slots...)
+		if err != ErrExecDisabled {
+			logp.Err("Unable to run %s command %s: %s", action, command, err)
+			collector.audit(action, command, start, err)
+			go collector.finished(commandDuration{action: action, failed: true, fallback: prepared.fallback})
+		}
+		return nil, start, false
+	}
+	return wait, start, true
+}
+
+// waitForCommand waits for a command to exit, logging how it went and recording how long it
+// took
+func (collector *Collector) waitForCommand(action string, prepared preparedCommand, wait func() error, start time.Time, slots []chan struct{}) {
+	err := wait()
+	releaseSlots(slots...)
+	collector.audit(action, prepared.command, start, err)
+
+	if err != nil {
+		logp.Warn("%s command %s of collector %s failed: %s", action, prepared.command, collector.config.Name, err)
+	} else {
+		logp.Debug("log-pulse", "%s command %s of collector %s exited successfully", action, prepared.command, collector.config.Name)
+	}
+	collector.finished(commandDuration{
+		action:   action,
+		duration: time.Since(start),
+		failed:   err != nil,
+		fallback: prepared.fallback,
+	})
+}
+
+// finished hands how a command went back to process
+func (collector *Collector) finished(finished commandDuration) {
+	select {
+	case collector.finishedCommands <- finished:
+	case <-collector.Done:
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandSlots(t *testing.T) {
+	assert.Nil(t, newCommandSlots(0))
+
+	one := newCommandSlots(1)
+	two := newCommandSlots(2)
+	assert.True(t, tryAcquireSlots(one, nil, two))
+	assert.Equal(t, 1, len(two))
+
+	// When one cap is full nothing is taken from the others
+	assert.False(t, tryAcquireSlots(two, one))
+	assert.Equal(t, 1, len(two))
+
+	done := make(chan struct{})
+	close(done)
+	assert.False(t, acquireSlots(done, two, one))
+	assert.Equal(t, 1, len(two))
+
+	releaseSlots(one, nil, two)
+	assert.Equal(t, 0, len(one))
+	assert.Equal(t, 0, len(two))
+	assert.True(t, acquireSlots(make(chan struct{}), one))
+}
+
+func TestValidateCommandLimit(t *testing.T) {
+	assert.Nil(t, validateCommandLimit(CollectorConfig{MaxRunningCommands: 2, CommandOverflow: OverflowQueue}))
+	assert.NotNil(t, validateCommandLimit(CollectorConfig{MaxRunningCommands: -1}))
+	assert.NotNil(t, validateCommandLimit(CollectorConfig{CommandOverflow: "wait"}))
+}
+
+func testCommandOverflow(t *testing.T, overflow string) string {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   make(chan time.Time),
+		finishedCommands: make(chan commandDuration),
+		commandSlots:     newCommandSlots(1),
+
+		config: CollectorConfig{
+			CommandOverflow: overflow,
+			Command: CommandConfig{
+				Program: "sh",
+				Args:    []string{"-c", "echo ran >> " + outputFile + "; sleep 0.2"},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "Match"
+	time.Sleep(600 * time.Millisecond)
+	close(collector.Done)
+	<-collector.Stopped
+
+	output, _ := ioutil.ReadFile(outputFile)
+	return string(output)
+}
+
+func TestCollectorCommandOverflowDrop(t *testing.T) {
+	assert.Equal(t, "ran\n", testCommandOverflow(t, ""))
+}
+
+func TestCollectorCommandOverflowQueue(t *testing.T) {
+	assert.Equal(t, "ran\nran\n", testCommandOverflow(t, OverflowQueue))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SelfLimits describes how log-pulse should restrain its own resource usage so that the
+// watchdog never meaningfully competes with the workloads it's watching. They're set with
+// command line flags and are only supported on Linux.
+type SelfLimits struct {
+	// Added to our scheduling niceness, positive values lower our priority
+	Nice int
+	// Only do disk I/O when nobody else wants the disk
+	IOIdle bool
+
+	// A cgroup (v2) directory to create and move ourselves into, along with the limits to
+	// give it. The limits require the cgroup.
+	Cgroup string
+	// How many CPUs worth of time we may use, ie: 0.5 is half of one CPU
+	CPU float64
+	// A memory limit in bytes, optionally with a K, M or G suffix
+	Memory string
+}
+
+// parseByteSize parses sizes like 512, 64K, 128M or 1G into bytes
+func parseByteSize(size string) (int64, error) {
+	size = strings.TrimSpace(strings.ToUpper(size))
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(size, suffix) {
+			multiplier = m
+			size = strings.TrimSuffix(size, suffix)
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("Invalid size %q", size)
+	}
+	return value * multiplier, nil
+}
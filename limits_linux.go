@@ -0,0 +1,178 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const (
+	// Where cgroup v2 is mounted
+	cgroupRoot = "/sys/fs/cgroup"
+	// The period we give our CPU quota in, in microseconds
+	cgroupCPUPeriod = 100000
+
+	// From linux/ioprio.h
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// ApplySelfLimits applies our limits to the running process. Whether or not we were asked to
+// create a cgroup we also make sure we don't run more threads than the CPU quota of the
+// cgroup we end up in allows, which is how we respect limits put on us by someone else.
+func ApplySelfLimits(limits SelfLimits) error {
+	if limits.Cgroup == "" && (limits.CPU > 0 || limits.Memory != "") {
+		return errors.New("CPU and memory limits need a cgroup to be set")
+	}
+
+	// Linux treats every thread separately when it comes to priorities. New threads take after
+	// the thread that created them, so doing this early on covers everything.
+	if limits.Nice != 0 {
+		err := forEachThread(func(tid int) error {
+			return syscall.Setpriority(syscall.PRIO_PROCESS, tid, limits.Nice)
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to set nice: %s", err)
+		}
+	}
+
+	if limits.IOIdle {
+		err := forEachThread(func(tid int) error {
+			_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift)
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to set I/O priority: %s", err)
+		}
+	}
+
+	if limits.Cgroup != "" {
+		var memory int64
+		if limits.Memory != "" {
+			var err error
+			if memory, err = parseByteSize(limits.Memory); err != nil {
+				return err
+			}
+		}
+
+		if err := joinCgroup(limits.Cgroup, limits.CPU, memory, os.Getpid()); err != nil {
+			return fmt.Errorf("Unable to join cgroup %s: %s", limits.Cgroup, err)
+		}
+		logp.Info("Joined cgroup %s", limits.Cgroup)
+	}
+
+	if cpus, ok := cgroupCPUs(); ok && cpus < runtime.GOMAXPROCS(0) {
+		logp.Info("Limiting ourselves to %d CPUs to fit our cgroup's quota", cpus)
+		runtime.GOMAXPROCS(cpus)
+	}
+
+	return nil
+}
+
+// forEachThread calls fn with the id of every thread in our process
+func forEachThread(fn func(tid int) error) error {
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := fn(tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinCgroup creates a cgroup v2 directory, sets its limits and moves pid into it
+func joinCgroup(path string, cpu float64, memory int64, pid int) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	if cpu > 0 {
+		quota := int64(cpu * cgroupCPUPeriod)
+		if err := writeCgroupFile(path, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)); err != nil {
+			return err
+		}
+	}
+
+	if memory > 0 {
+		if err := writeCgroupFile(path, "memory.max", strconv.FormatInt(memory, 10)); err != nil {
+			return err
+		}
+	}
+
+	return writeCgroupFile(path, "cgroup.procs", strconv.Itoa(pid))
+}
+
+func writeCgroupFile(path, name, value string) error {
+	return ioutil.WriteFile(filepath.Join(path, name), []byte(value), 0644)
+}
+
+// cgroupCPUs works out how many CPUs the quota of the cgroup we're in adds up to
+func cgroupCPUs() (int, bool) {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	// cgroup v2 has a single "0::/path" entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			content, err := ioutil.ReadFile(filepath.Join(cgroupRoot, path, "cpu.max"))
+			if err != nil {
+				return 0, false
+			}
+			return parseCPUMax(string(content))
+		}
+	}
+	return 0, false
+}
+
+// parseCPUMax turns the contents of a cpu.max file ("$QUOTA $PERIOD", where the quota may be
+// "max") into a number of CPUs, rounded up
+func parseCPUMax(content string) (int, bool) {
+	fields := strings.Fields(content)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+
+	cpus := int(math.Ceil(quota / period))
+	if cpus < 1 {
+		cpus = 1
+	}
+	return cpus, true
+}
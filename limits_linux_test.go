@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinCgroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-pulse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log-pulse")
+	assert.Nil(t, joinCgroup(path, 0.5, 64<<20, 1234))
+
+	for name, expected := range map[string]string{
+		"cpu.max":      "50000 100000",
+		"memory.max":   "67108864",
+		"cgroup.procs": "1234",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(path, name))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+}
+
+func TestParseCPUMax(t *testing.T) {
+	cpus, ok := parseCPUMax("50000 100000\n")
+	assert.True(t, ok)
+	assert.Equal(t, 1, cpus)
+
+	cpus, ok = parseCPUMax("250000 100000")
+	assert.True(t, ok)
+	assert.Equal(t, 3, cpus)
+
+	_, ok = parseCPUMax("max 100000")
+	assert.False(t, ok)
+}
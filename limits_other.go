@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// ApplySelfLimits is only supported on Linux, anywhere else asking for limits is an error
+func ApplySelfLimits(limits SelfLimits) error {
+	if limits != (SelfLimits{}) {
+		return errors.New("Resource limits are only supported on Linux")
+	}
+	return nil
+}
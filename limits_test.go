@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"512":  512,
+		"64K":  64 << 10,
+		"128m": 128 << 20,
+		"1G":   1 << 30,
+	} {
+		bytes, err := parseByteSize(size)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, bytes, size)
+	}
+
+	for _, size := range []string{"", "M", "-1M", "lots"} {
+		_, err := parseByteSize(size)
+		assert.NotNil(t, err, size)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// logRepeatInterval is how often a single kind of message may be logged by a logLimiter
+const logRepeatInterval = 10 * time.Second
+
+// logLimiter keeps chatty log messages, like the per line debug output of a busy collector
+// or the same warning over and over again, from flooding our log. Messages are told apart
+// once they've been formatted: the first of each in every interval is logged and the rest
+// are only counted. The next one to get through reports how many were left out, and if
+// none does run reports them once the interval is up, or when it stops.
+//
+// A nil logLimiter just logs everything.
+type logLimiter struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]*logLimiterEntry
+}
+
+type logLimiterEntry struct {
+	lastLogged time.Time
+	suppressed int
+	// Where the message was logged, for reporting what was suppressed
+	log func(string, ...interface{})
+}
+
+func newLogLimiter(interval time.Duration) *logLimiter {
+	return &logLimiter{
+		interval: interval,
+		now:      time.Now,
+		entries:  make(map[string]*logLimiterEntry),
+	}
+}
+
+// Debug is a rate limited logp.Debug
+func (limiter *logLimiter) Debug(selector string, format string, v ...interface{}) {
+	limiter.logf(func(format string, v ...interface{}) {
+		logp.Debug(selector, format, v...)
+	}, format, v...)
+}
+
+// Warn is a rate limited logp.Warn
+func (limiter *logLimiter) Warn(format string, v ...interface{}) {
+	limiter.logf(logp.Warn, format, v...)
+}
+
+// logf logs the message through log if it hasn't been logged in the current interval
+func (limiter *logLimiter) logf(log func(string, ...interface{}), format string, v ...interface{}) {
+	if limiter == nil {
+		log(format, v...)
+		return
+	}
+
+	message := fmt.Sprintf(format, v...)
+	suppressed, ok := limiter.allow(message, log)
+	if !ok {
+		return
+	}
+
+	if suppressed > 0 {
+		log("%s (last message repeated %d times)", message, suppressed)
+	} else {
+		log("%s", message)
+	}
+}
+
+// allow reports whether a message should be logged now and, if it should, how many were
+// suppressed since the last one
+func (limiter *logLimiter) allow(message string, log func(string, ...interface{})) (int, bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	entry, ok := limiter.entries[message]
+	if !ok {
+		limiter.entries[message] = &logLimiterEntry{lastLogged: now, log: log}
+		return 0, true
+	}
+
+	if now.Sub(entry.lastLogged) < limiter.interval {
+		entry.suppressed++
+		return 0, false
+	}
+
+	suppressed := entry.suppressed
+	entry.lastLogged = now
+	entry.suppressed = 0
+	return suppressed, true
+}
+
+// run reports the messages suppressed in every interval that's up until done is closed,
+// and then whatever's left
+func (limiter *logLimiter) run(done <-chan struct{}) {
+	if limiter == nil {
+		return
+	}
+	ticker := time.NewTicker(limiter.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			limiter.flush(false)
+		case <-done:
+			limiter.flush(true)
+			return
+		}
+	}
+}
+
+// flush reports how many times the messages whose interval is up, or every message with
+// all, were suppressed and forgets them, so that the next one is logged straight away
+func (limiter *logLimiter) flush(all bool) {
+	type pending struct {
+		message string
+		entry   *logLimiterEntry
+	}
+	var flushed []pending
+
+	limiter.mutex.Lock()
+	now := limiter.now()
+	for message, entry := range limiter.entries {
+		if all || now.Sub(entry.lastLogged) >= limiter.interval {
+			delete(limiter.entries, message)
+			if entry.suppressed > 0 {
+				flushed = append(flushed, pending{message, entry})
+			}
+		}
+	}
+	limiter.mutex.Unlock()
+
+	// Logging could take a while, so not while holding the mutex
+	for _, p := range flushed {
+		p.entry.log("%s (message repeated %d more times)", p.message, p.entry.suppressed)
+	}
+}
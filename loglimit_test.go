@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newLogLimiter(10 * time.Second)
+	limiter.now = func() time.Time { return now }
+
+	var logged []string
+	log := func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+
+	// Only the first of a burst gets through
+	for i := 0; i < 5; i++ {
+		limiter.logf(log, "Received %d", 0)
+	}
+	assert.Equal(t, []string{"Received 0"}, logged)
+
+	// Other messages aren't affected, even ones with the same format
+	limiter.logf(log, "Received %d", 1)
+	limiter.logf(log, "Something else")
+	assert.Equal(t, []string{"Received 0", "Received 1", "Something else"}, logged)
+
+	// Once the interval is up the next one reports what was skipped
+	now = now.Add(10 * time.Second)
+	limiter.logf(log, "Received %d", 0)
+	assert.Equal(t, "Received 0 (last message repeated 4 times)", logged[3])
+
+	now = now.Add(10 * time.Second)
+	limiter.logf(log, "Received %d", 0)
+	assert.Equal(t, "Received 0", logged[4])
+}
+
+func TestLogLimiterFlush(t *testing.T) {
+	now := time.Now()
+	limiter := newLogLimiter(10 * time.Second)
+	limiter.now = func() time.Time { return now }
+
+	var logged []string
+	log := func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+
+	for i := 0; i < 3; i++ {
+		limiter.logf(log, "Unable to write")
+	}
+	limiter.logf(log, "Just once")
+	now = now.Add(5 * time.Second)
+	for i := 0; i < 4; i++ {
+		limiter.logf(log, "Unable to read")
+	}
+	logged = nil
+
+	// Counts are reported once their interval is up even if the message never comes back
+	limiter.flush(false)
+	assert.Empty(t, logged)
+	now = now.Add(5 * time.Second)
+	limiter.flush(false)
+	assert.Equal(t, []string{"Unable to write (message repeated 2 more times)"}, logged)
+	assert.Equal(t, 1, len(limiter.entries))
+
+	// And whatever's left when we stop
+	limiter.flush(true)
+	assert.Equal(t, "Unable to read (message repeated 3 more times)", logged[1])
+	assert.Empty(t, limiter.entries)
+
+	// The run loop flushes on the way out
+	logged = nil
+	limiter.logf(log, "Unable to read")
+	limiter.logf(log, "Unable to read")
+	done := make(chan struct{})
+	close(done)
+	limiter.run(done)
+	assert.Equal(t, []string{"Unable to read", "Unable to read (message repeated 1 more times)"}, logged)
+}
+
+func TestNilLogLimiter(t *testing.T) {
+	var limiter *logLimiter
+
+	count := 0
+	for i := 0; i < 3; i++ {
+		limiter.logf(func(string, ...interface{}) { count++ }, "Hello")
+	}
+	assert.Equal(t, 3, count)
+}
@@ -1,24 +1,87 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/ogier/pflag"
+	"gopkg.in/yaml.v2"
 )
 
 func main() {
 	configFile := pflag.StringP("config", "c", "log-pulse.yml", "The yaml file to load configuration from")
 	logLevel := pflag.String("loglevel", "INFO", "The lowest log level you want outputted")
+	noExec := pflag.Bool("no-exec", false, "Never run any of the configured commands, only log them")
+	dryRun := pflag.Bool("dry-run", false, "Tail and match as usual but only log the commands and file outputs that would have run, as if every collector were a canary")
+	statsFile := pflag.String("stats-file", "", "Where to keep the counts of when each collector matches")
+	influxURL := pflag.String("influx-url", "", "An InfluxDB write endpoint to push match counts to, ie: http://influx:8086/write?db=logpulse")
+	influxInterval := pflag.Duration("influx-interval", DefaultInfluxInterval, "How often to push match counts to InfluxDB")
+	influxTLS := TLSConfig{}
+	pflag.StringVar(&influxTLS.CA, "influx-ca", "", "The certificates to trust for an https --influx-url instead of the system's")
+	pflag.StringVar(&influxTLS.Cert, "influx-cert", "", "A client certificate to present to InfluxDB")
+	pflag.StringVar(&influxTLS.Key, "influx-key", "", "The key of --influx-cert")
+	resumeGrace := pflag.Duration("resume-grace", 0, "How long to hold off timeouts after the host resumes from suspend")
+	maxRunningCommands := pflag.Int("max-running-commands", 0, "The most commands all collectors together may be running at once, 0 for no limit")
+	auditLog := pflag.String("audit-log", "", "A file to append a JSON line to for every command run")
+	controlSocket := pflag.String("control-socket", "", "A Unix socket to take requests to reset or fire a collector's timeout on")
+	exitOnMatch := pflag.Bool("exit-on-match", false, "Exit as soon as any collector matches or times out, as if they all had exit_on_match")
+
+	// Keep the watchdog out of the way of what it's watching (Linux only)
+	limits := SelfLimits{}
+	pflag.IntVar(&limits.Nice, "nice", 0, "Lower our CPU priority by this much")
+	pflag.BoolVar(&limits.IOIdle, "ionice-idle", false, "Only use the disk when nothing else wants it")
+	pflag.StringVar(&limits.Cgroup, "cgroup", "", "A cgroup v2 directory to create and move ourselves into")
+	pflag.Float64Var(&limits.CPU, "cpu-limit", 0, "How many CPUs our cgroup may use, ie: 0.5")
+	pflag.StringVar(&limits.Memory, "memory-limit", "", "The memory limit for our cgroup, ie: 128M")
 
 	pflag.Parse()
 
+	// Subcommands print something out and exit
+	switch pflag.Arg(0) {
+	case "stats":
+		// "log-pulse stats" prints the counts saved to the stats file
+		os.Exit(printStatsFile(*statsFile))
+	case "config":
+		// "log-pulse config show [collector]" prints the effective configuration
+		if pflag.Arg(1) != "show" {
+			fmt.Fprintln(os.Stderr, "Usage: log-pulse config show [collector]")
+			os.Exit(2)
+		}
+		os.Exit(showConfig(*configFile, pflag.Arg(2)))
+	case "docs":
+		// "log-pulse docs" prints a runbook describing every collector
+		os.Exit(printDocs(*configFile))
+	case "test-pattern":
+		// "log-pulse test-pattern [log file]" shows what each collector would match
+		os.Exit(testPattern(*configFile, pflag.Arg(1)))
+	case "control":
+		// "log-pulse control reset|fire <collector>" asks a running Log Pulse to reset or
+		// fire a collector's timeout
+		os.Exit(sendControl(*controlSocket, pflag.Arg(1), pflag.Arg(2)))
+	}
+
 	// Initialize our logging
 	logp.Init("log-pulse", &logp.Logging{
 		Level: *logLevel,
 	})
 
+	if err := ApplySelfLimits(limits); err != nil {
+		logp.Critical("Unable to limit our own resources: %s", err)
+		os.Exit(1)
+	}
+
+	// A dry run disables execution as well, in case anything gets past the canaries
+	DryRun = *dryRun
+	ExecDisabled = *noExec || DryRun
+	if DryRun {
+		logp.Info("Dry run, commands and file outputs will only be logged")
+	} else if ExecDisabled {
+		logp.Info("Command execution is disabled")
+	}
+
 	// Load our configuration
 	configs, rawConfigs, err := ParseConfigFile(*configFile)
 	if err != nil {
@@ -26,12 +89,47 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *exitOnMatch {
+		setExitOnMatch(*configs)
+	}
+
 	// Create our Collection
 	collection, err := CreateCollection(*configs, rawConfigs)
 	if err != nil {
 		logp.Critical("Unable to create a collection: %s", err)
 		os.Exit(1)
 	}
+	collection.ResumeGrace = *resumeGrace
+	collection.InfluxURL = *influxURL
+	collection.InfluxInterval = *influxInterval
+	if err := influxTLS.validate(); err != nil {
+		logp.Critical("Invalid InfluxDB TLS settings: %s", err)
+		os.Exit(1)
+	}
+	collection.InfluxTLS = influxTLS
+	collection.MaxRunningCommands = *maxRunningCommands
+
+	if *auditLog != "" {
+		if collection.AuditLog, err = OpenAuditLog(*auditLog); err != nil {
+			logp.Critical("Unable to open the audit log: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if *controlSocket != "" {
+		if collection.ControlListener, err = ListenControl(*controlSocket); err != nil {
+			logp.Critical("Unable to open the control socket: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if *statsFile != "" {
+		if err := collection.LoadStats(*statsFile); err != nil {
+			logp.Critical("Unable to load stats: %s", err)
+			os.Exit(1)
+		}
+		collection.StatsFile = *statsFile
+	}
 
 	// Register with exit signals
 	sigs := make(chan os.Signal, 1)
@@ -43,7 +141,132 @@ func main() {
 	}()
 	signal.Notify(sigs, os.Interrupt, os.Kill)
 
+	// Reload the config file on SIGHUP. We listen for it straight away, as it would kill us
+	// otherwise, but only act on it once the collection has started.
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+
 	// Start our process
 	collection.Start()
+	go func() {
+		for range hups {
+			logp.Info("Received SIGHUP, reloading %s", *configFile)
+			configs, rawConfigs, err := ParseConfigFile(*configFile)
+			if err != nil {
+				logp.Critical("Unable to parse the config file, keeping the current one: %s", err)
+				continue
+			}
+			if *exitOnMatch {
+				setExitOnMatch(*configs)
+			}
+			// Reload logs why it rejected a config itself
+			collection.Reload(*configs, rawConfigs)
+		}
+	}()
 	collection.LetRun()
+	os.Exit(collection.ExitCode)
+}
+
+// setExitOnMatch gives every collector exit_on_match, for --exit-on-match
+func setExitOnMatch(configs LogPulseConfig) {
+	for i := range configs {
+		configs[i].ExitOnMatch = true
+	}
+}
+
+// printStatsFile prints the stats saved in a stats file, returning our exit code
+func printStatsFile(path string) int {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "The stats subcommand needs --stats-file")
+		return 2
+	}
+
+	stats, err := ReadStatsFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := PrintStats(os.Stdout, stats); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// showConfig prints the effective configuration of every collector, or just the named one,
+// returning our exit code
+func showConfig(path string, name string) int {
+	configs, rawConfigs, err := ParseConfigFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to parse the config file: %s\n", err)
+		return 1
+	}
+
+	var effective []map[string]interface{}
+	for i, config := range *configs {
+		if name != "" && config.Name != name {
+			continue
+		}
+		collector, err := EffectiveConfig(config, rawConfigs[i])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to resolve collector %s: %s\n", config.Name, err)
+			return 1
+		}
+		effective = append(effective, collector)
+	}
+
+	if name != "" && len(effective) == 0 {
+		fmt.Fprintf(os.Stderr, "There's no collector named %s\n", name)
+		return 1
+	}
+
+	data, err := yaml.Marshal(effective)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
+
+// printDocs prints our configuration as a Markdown runbook, returning our exit code
+func printDocs(path string) int {
+	configs, _, err := ParseConfigFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to parse the config file: %s\n", err)
+		return 1
+	}
+
+	if err := WriteDocs(os.Stdout, *configs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// testPattern runs a sample log file, or stdin when there isn't one, through our collectors'
+// patterns, returning our exit code
+func testPattern(configPath string, logPath string) int {
+	configs, _, err := ParseConfigFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to parse the config file: %s\n", err)
+		return 1
+	}
+
+	input := os.Stdin
+	if logPath != "" && logPath != "-" {
+		input, err = os.Open(logPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer input.Close()
+	}
+
+	if err := RunPatternTest(*configs, input, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
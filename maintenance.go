@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Planned maintenance stops heartbeats on purpose, and paging someone about it helps nobody.
+// A timeout's "maintenance" lists windows during which it, and its tiers, are ignored:
+//
+//   maintenance:
+//     windows:
+//       - 2017-12-25                            the whole day
+//       - 2017-12-24 to 2017-12-26              whole days, the last one included
+//       - 2017-11-04 22:00 to 2017-11-05 02:00  from one time to another
+//     ical: https://calendar.example.com/maintenance.ics
+//     refresh: 1h
+//
+// The windows are in the timeout's timezone. "ical" is an iCalendar file, a URL or a path,
+// whose events are maintenance windows too. It's fetched when the collector starts and again
+// every refresh (an hour by default); if fetching it fails the events we already have are
+// kept. Only the first occurrence of recurring events counts.
+
+// DefaultMaintenanceRefresh is how often a maintenance calendar is fetched again by default
+const DefaultMaintenanceRefresh = time.Hour
+
+// maintenanceTimeout is how long we give a maintenance calendar to download
+const maintenanceTimeout = 30 * time.Second
+
+// maintenanceWindow is a stretch of time from start up to end
+type maintenanceWindow struct {
+	start, end time.Time
+}
+
+// maintenanceCalendar holds the maintenance windows of a timeout. The ones from an iCalendar
+// are replaced in the background so they're guarded by a mutex. A nil maintenanceCalendar
+// never has maintenance going on.
+type maintenanceCalendar struct {
+	config   MaintenanceConfig
+	location *time.Location
+	windows  []maintenanceWindow
+
+	mutex    sync.Mutex
+	calendar []maintenanceWindow
+}
+
+// newMaintenanceCalendar parses a timeout's maintenance, returning nil if it has none
+func newMaintenanceCalendar(config MaintenanceConfig, timezone string) (*maintenanceCalendar, error) {
+	if len(config.Windows) == 0 && config.ICal == "" {
+		return nil, nil
+	}
+	if config.Refresh < 0 {
+		return nil, fmt.Errorf("The maintenance refresh can't be negative, got %s", config.Refresh)
+	}
+	if err := config.TLS.validate(); err != nil {
+		return nil, err
+	}
+
+	calendar := &maintenanceCalendar{config: config, location: time.Local}
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown timeout timezone %s: %s", timezone, err)
+		}
+		calendar.location = location
+	}
+	for _, window := range config.Windows {
+		parsed, err := parseMaintenanceWindow(window, calendar.location)
+		if err != nil {
+			return nil, err
+		}
+		calendar.windows = append(calendar.windows, parsed)
+	}
+	return calendar, nil
+}
+
+// parseMaintenanceWindow parses a window like "2017-12-24 to 2017-12-26"
+func parseMaintenanceWindow(window string, location *time.Location) (maintenanceWindow, error) {
+	bounds := strings.SplitN(window, " to ", 2)
+	start, startIsDay, err := parseMaintenanceTime(bounds[0], location)
+	if err != nil {
+		return maintenanceWindow{}, fmt.Errorf("Invalid maintenance window %q: %s", window, err)
+	}
+	end, endIsDay := start, startIsDay
+	if len(bounds) == 2 {
+		if end, endIsDay, err = parseMaintenanceTime(bounds[1], location); err != nil {
+			return maintenanceWindow{}, fmt.Errorf("Invalid maintenance window %q: %s", window, err)
+		}
+	}
+	// A day on its own lasts until the end of it
+	if endIsDay {
+		end = end.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return maintenanceWindow{}, fmt.Errorf("The maintenance window %q ends before it starts", window)
+	}
+	return maintenanceWindow{start: start, end: end}, nil
+}
+
+// parseMaintenanceTime parses a day like 2017-12-25 or a time like 2017-12-25 22:00,
+// reporting which it was
+func parseMaintenanceTime(value string, location *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, true, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+	if err != nil {
+		return t, false, fmt.Errorf("%q isn't a day like 2017-12-25 or a time like 2017-12-25 22:00", value)
+	}
+	return t, false, nil
+}
+
+// active reports whether now is within a maintenance window
+func (calendar *maintenanceCalendar) active(now time.Time) bool {
+	if calendar == nil {
+		return false
+	}
+	for _, window := range calendar.windows {
+		if !now.Before(window.start) && now.Before(window.end) {
+			return true
+		}
+	}
+
+	calendar.mutex.Lock()
+	defer calendar.mutex.Unlock()
+	for _, window := range calendar.calendar {
+		if !now.Before(window.start) && now.Before(window.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshPeriodically fetches the iCalendar now and every refresh after that until done is
+// closed
+func (calendar *maintenanceCalendar) refreshPeriodically(done <-chan struct{}) {
+	if calendar == nil || calendar.config.ICal == "" {
+		return
+	}
+	refresh := calendar.config.Refresh
+	if refresh == 0 {
+		refresh = DefaultMaintenanceRefresh
+	}
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		calendar.refresh()
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// refresh fetches the iCalendar, keeping the events we have if that fails
+func (calendar *maintenanceCalendar) refresh() {
+	windows, err := fetchICal(calendar.config.ICal, calendar.config.TLS, calendar.location)
+	if err != nil {
+		logp.Warn("Unable to fetch the maintenance calendar %s: %s", calendar.config.ICal, err)
+		return
+	}
+	logp.Debug("log-pulse", "Maintenance calendar %s has %d events", calendar.config.ICal, len(windows))
+
+	calendar.mutex.Lock()
+	calendar.calendar = windows
+	calendar.mutex.Unlock()
+}
+
+// fetchICal reads the events of an iCalendar from a URL, using tlsConfig for https, or a file
+func fetchICal(source string, tlsConfig TLSConfig, location *time.Location) ([]maintenanceWindow, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseICal(file, location)
+	}
+
+	client, err := tlsConfig.httpClient(maintenanceTimeout)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("The server answered with %s", resp.Status)
+	}
+	return parseICal(resp.Body, location)
+}
+
+// parseICal reads the start and end of every event in an iCalendar. Times without a zone
+// of their own are in location.
+func parseICal(r io.Reader, location *time.Location) ([]maintenanceWindow, error) {
+	// Long lines are folded, continuing on the next line after a space or tab
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var windows []maintenanceWindow
+	var start, end time.Time
+	var startIsDay, inEvent bool
+	for _, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		params := strings.Split(line[:colon], ";")
+		name, value := strings.ToUpper(params[0]), line[colon+1:]
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			start, end, startIsDay = time.Time{}, time.Time{}, false
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			// An all day event without an end is that one day
+			if end.IsZero() && startIsDay {
+				end = start.AddDate(0, 0, 1)
+			}
+			if !start.IsZero() && end.After(start) {
+				windows = append(windows, maintenanceWindow{start: start, end: end})
+			}
+		case inEvent && (name == "DTSTART" || name == "DTEND"):
+			t, isDay, err := parseICalTime(value, params[1:], location)
+			if err != nil {
+				return nil, err
+			}
+			if name == "DTSTART" {
+				start, startIsDay = t, isDay
+			} else {
+				end = t
+			}
+		}
+	}
+	return windows, nil
+}
+
+// parseICalTime parses an iCalendar date (20171225) or time (20171225T220000, with a Z for
+// UTC or a TZID parameter for its zone), reporting whether it was a date
+func parseICalTime(value string, params []string, location *time.Location) (time.Time, bool, error) {
+	for _, param := range params {
+		if strings.HasPrefix(strings.ToUpper(param), "TZID=") {
+			zone, err := time.LoadLocation(strings.Trim(param[len("TZID="):], `"`))
+			if err != nil {
+				return time.Time{}, false, fmt.Errorf("Unknown calendar time zone in %s", param)
+			}
+			location = zone
+		}
+	}
+
+	if len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, location)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
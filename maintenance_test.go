@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testICal = "BEGIN:VCALENDAR\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Database upgrade\r\n" +
+	"DTSTART:20171104T220000Z\r\n" +
+	"DTEND:20171105T020000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Christmas\r\n" +
+	"DTSTART;VALUE=DATE:20171225\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;TZID=America/New_York:20171201T0\r\n" +
+	" 90000\r\n" +
+	"DTEND;TZID=America/New_York:20171201T100000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestNewMaintenanceCalendar(t *testing.T) {
+	calendar, err := newMaintenanceCalendar(MaintenanceConfig{}, "")
+	assert.Nil(t, err)
+	assert.False(t, calendar.active(time.Now()))
+
+	calendar, err = newMaintenanceCalendar(MaintenanceConfig{Windows: []string{
+		"2017-12-25",
+		"2017-12-30 to 2017-12-31",
+		"2017-11-04 22:00 to 2017-11-05 02:00",
+	}}, "UTC")
+	assert.Nil(t, err)
+
+	at := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(2017, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	assert.True(t, calendar.active(at(12, 25, 0)))
+	assert.True(t, calendar.active(at(12, 25, 23)))
+	assert.False(t, calendar.active(at(12, 26, 0)))
+	assert.True(t, calendar.active(at(12, 31, 23)))
+	assert.True(t, calendar.active(at(11, 4, 23)))
+	assert.False(t, calendar.active(at(11, 5, 2)))
+
+	invalid := []MaintenanceConfig{
+		{Windows: []string{"Christmas"}},
+		{Windows: []string{"2017-12-26 to 2017-12-25"}},
+		{Windows: []string{"2017-11-04 22:00 to 2017-11-04 21:00"}},
+		{ICal: "calendar.ics", Refresh: -time.Hour},
+	}
+	for _, config := range invalid {
+		_, err := newMaintenanceCalendar(config, "")
+		assert.NotNil(t, err)
+	}
+	_, err = newMaintenanceCalendar(MaintenanceConfig{Windows: []string{"2017-12-25"}}, "Mars/Olympus_Mons")
+	assert.NotNil(t, err)
+}
+
+func TestParseICal(t *testing.T) {
+	windows, err := parseICal(strings.NewReader(testICal), time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(windows))
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	assert.Equal(t, time.Date(2017, 11, 4, 22, 0, 0, 0, time.UTC), windows[0].start)
+	assert.Equal(t, time.Date(2017, 12, 26, 0, 0, 0, 0, time.UTC), windows[1].end)
+	assert.True(t, windows[2].start.Equal(time.Date(2017, 12, 1, 9, 0, 0, 0, newYork)))
+
+	_, err = parseICal(strings.NewReader("BEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\n"), time.UTC)
+	assert.NotNil(t, err)
+}
+
+func TestMaintenanceRefresh(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, testICal)
+	}))
+	defer server.Close()
+
+	christmas := time.Date(2017, 12, 25, 12, 0, 0, 0, time.UTC)
+	calendar, err := newMaintenanceCalendar(MaintenanceConfig{ICal: server.URL}, "UTC")
+	assert.Nil(t, err)
+	assert.False(t, calendar.active(christmas))
+
+	calendar.refresh()
+	assert.True(t, calendar.active(christmas))
+
+	// Failing to fetch it keeps what we had
+	fail = true
+	calendar.refresh()
+	assert.True(t, calendar.active(christmas))
+
+	// Files work too
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "maintenance.ics")
+	ioutil.WriteFile(path, []byte(testICal), 0644)
+	windows, err := fetchICal(path, TLSConfig{}, time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(windows))
+}
+
+func TestCollectorMaintenance(t *testing.T) {
+	collector, err := newCollector(CollectorConfig{
+		Pattern: "x",
+		Timeout: TimeoutConfig{
+			Interval:    time.Minute,
+			Timezone:    "UTC",
+			Maintenance: MaintenanceConfig{Windows: []string{"2017-12-25"}},
+		},
+	})
+	assert.Nil(t, err)
+	assert.True(t, collector.timeoutsSuppressed(time.Date(2017, 12, 25, 12, 0, 0, 0, time.UTC)))
+	assert.False(t, collector.timeoutsSuppressed(time.Date(2017, 12, 26, 12, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The ways a collector's pattern and exclude_pattern can be matched against lines
+const (
+	MatchRegex     = "regex"
+	MatchSubstring = "substring"
+	MatchPrefix    = "prefix"
+	MatchGlob      = "glob"
+)
+
+// Matcher decides whether a line matches one of a collector's patterns. *regexp.Regexp is
+// one, the others skip the regular expression engine entirely for plain strings, which goes
+// a long way on busy heartbeat logs.
+type Matcher interface {
+	MatchString(line string) bool
+}
+
+// substringMatcher matches lines containing it anywhere
+type substringMatcher string
+
+func (matcher substringMatcher) MatchString(line string) bool {
+	return strings.Contains(line, string(matcher))
+}
+
+// prefixMatcher matches lines starting with it
+type prefixMatcher string
+
+func (matcher prefixMatcher) MatchString(line string) bool {
+	return strings.HasPrefix(line, string(matcher))
+}
+
+// newMatcher creates the Matcher for a pattern according to the collector's match_type, which
+// defaults to regex
+func newMatcher(matchType string, pattern string, flags string) (Matcher, error) {
+	switch matchType {
+	case "", MatchRegex:
+		return compilePattern(pattern, flags)
+	case MatchSubstring, MatchPrefix:
+		if flags != "" {
+			return nil, fmt.Errorf("pattern_flags can't be used with match_type %s", matchType)
+		}
+		if matchType == MatchSubstring {
+			return substringMatcher(pattern), nil
+		}
+		return prefixMatcher(pattern), nil
+	case MatchGlob:
+		// Globs that are only literal text and stars don't need a regular expression
+		if flags == "" && !strings.ContainsAny(pattern, "?[") {
+			return globMatcher(strings.Split(pattern, "*")), nil
+		}
+		return compilePattern(globToRegexp(pattern), flags)
+	}
+	return nil, fmt.Errorf("Unknown match_type %q, expected regex, substring, prefix or glob", matchType)
+}
+
+// globMatcher matches lines against a shell style glob made up of literal text and "*"
+// wildcards, held as the text between the stars. Like in the shell the glob has to cover the
+// whole line, so "*ERROR*disk*" is any line with "ERROR" somewhere before "disk".
+type globMatcher []string
+
+func (matcher globMatcher) MatchString(line string) bool {
+	if len(matcher) == 1 {
+		return line == matcher[0]
+	}
+
+	// The text before the first star and after the last one are anchored to the ends of
+	// the line, everything in between just has to show up in order
+	first, last := matcher[0], matcher[len(matcher)-1]
+	if len(line) < len(first)+len(last) || !strings.HasPrefix(line, first) || !strings.HasSuffix(line, last) {
+		return false
+	}
+	line = line[len(first) : len(line)-len(last)]
+
+	for _, part := range matcher[1 : len(matcher)-1] {
+		i := strings.Index(line, part)
+		if i < 0 {
+			return false
+		}
+		line = line[i+len(part):]
+	}
+	return true
+}
+
+// globToRegexp translates a shell style glob into an equivalent regular expression: "*" is
+// any run of characters, "?" is any one character and "[...]" is a character class, which
+// can be negated with a leading "!"
+func globToRegexp(glob string) string {
+	var expression bytes.Buffer
+	expression.WriteString("(?s)^")
+
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		case '[':
+			end := strings.IndexRune(string(runes[i+1:]), ']')
+			if end < 0 {
+				// Unclosed, so it's just a bracket
+				expression.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := []rune(string(runes[i+1:])[:end])
+			i += len(class) + 1
+
+			expression.WriteString("[")
+			if len(class) > 0 && class[0] == '!' {
+				expression.WriteString("^")
+				class = class[1:]
+			}
+			// Only ranges keep their meaning inside a class
+			for _, r := range class {
+				if r == '-' {
+					expression.WriteRune(r)
+				} else {
+					expression.WriteString(regexp.QuoteMeta(string(r)))
+				}
+			}
+			expression.WriteString("]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+
+	expression.WriteString("$")
+	return expression.String()
+}
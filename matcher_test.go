@@ -0,0 +1,83 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMatcher(t *testing.T) {
+	matcher, err := newMatcher("", "^heart.*beat", "")
+	assert.Nil(t, err)
+	_, ok := matcher.(*regexp.Regexp)
+	assert.True(t, ok)
+
+	matcher, err = newMatcher(MatchSubstring, "heartbeat", "")
+	assert.Nil(t, err)
+	assert.True(t, matcher.MatchString("INFO heartbeat ok"))
+	assert.False(t, matcher.MatchString("INFO heart beat"))
+
+	matcher, err = newMatcher(MatchPrefix, "INFO", "")
+	assert.Nil(t, err)
+	assert.True(t, matcher.MatchString("INFO heartbeat"))
+	assert.False(t, matcher.MatchString("WARN INFO"))
+
+	// Literal patterns aren't regular expressions
+	matcher, err = newMatcher(MatchSubstring, "a.b", "")
+	assert.Nil(t, err)
+	assert.False(t, matcher.MatchString("axb"))
+
+	_, err = newMatcher(MatchPrefix, "INFO", "i")
+	assert.NotNil(t, err)
+	_, err = newMatcher("fuzzy", "INFO", "")
+	assert.NotNil(t, err)
+}
+
+func TestGlobMatcher(t *testing.T) {
+	for glob, lines := range map[string]map[string]bool{
+		"*ERROR*disk*": {
+			"2017-09-01 ERROR: disk full": true,
+			"ERROR disk":                  true,
+			"disk ERROR":                  false,
+			"ERROR: memory":               false,
+		},
+		"ERROR*": {
+			"ERROR: disk full": true,
+			"WARN ERROR":       false,
+		},
+		"ab*ba": {
+			"aba":   false,
+			"abba":  true,
+			"abxba": true,
+		},
+		"heartbeat": {
+			"heartbeat":    true,
+			"heartbeat ok": false,
+		},
+		// These need a regular expression
+		"ERROR [0-9]?? *": {
+			"ERROR 503 timeout": true,
+			"ERROR 5 timeout":   false,
+		},
+		"[!#]*": {
+			"value": true,
+			"# one": false,
+		},
+		"a.b*": {
+			"a.b": true,
+			"axb": false,
+		},
+	} {
+		matcher, err := newMatcher(MatchGlob, glob, "")
+		assert.Nil(t, err)
+		for line, expected := range lines {
+			assert.Equal(t, expected, matcher.MatchString(line), glob+" against "+line)
+		}
+	}
+
+	// Flags turn the glob into a regular expression
+	matcher, err := newMatcher(MatchGlob, "*error*", "i")
+	assert.Nil(t, err)
+	assert.True(t, matcher.MatchString("ERROR"))
+}
@@ -0,0 +1,71 @@
+package main
+
+import "errors"
+
+// A collector's "match" combines several patterns into one with and, or and not, for
+// triggers like "timeout" but not "retried successfully" that a single pattern can't say
+// cleanly. It's a tree of MatchConfigs: the leaves are patterns, matched according to the
+// collector's match_type and pattern_flags, and every other node combines its children.
+
+// newMatchTree creates a Matcher for a match tree
+func newMatchTree(config MatchConfig, matchType string, flags string) (Matcher, error) {
+	set := 0
+	for _, isSet := range []bool{config.Pattern != "", len(config.All) > 0, len(config.Any) > 0, config.Not != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("Every part of a match needs exactly one of pattern, all, any or not")
+	}
+
+	switch {
+	case config.Pattern != "":
+		return newMatcher(matchType, config.Pattern, flags)
+	case config.Not != nil:
+		matcher, err := newMatchTree(*config.Not, matchType, flags)
+		if err != nil {
+			return nil, err
+		}
+		return notMatcher{matcher}, nil
+	}
+
+	children := config.All
+	if len(config.Any) > 0 {
+		children = config.Any
+	}
+	matchers := make([]Matcher, len(children))
+	for i, child := range children {
+		matcher, err := newMatchTree(child, matchType, flags)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = matcher
+	}
+
+	if len(config.Any) > 0 {
+		return anyMatcher(matchers), nil
+	}
+	return allMatcher(matchers), nil
+}
+
+// allMatcher matches lines matching every one of its Matchers
+type allMatcher []Matcher
+
+func (matchers allMatcher) MatchString(line string) bool {
+	for _, matcher := range matchers {
+		if !matcher.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// notMatcher matches lines its Matcher doesn't
+type notMatcher struct {
+	matcher Matcher
+}
+
+func (matcher notMatcher) MatchString(line string) bool {
+	return !matcher.matcher.MatchString(line)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTree(t *testing.T) {
+	// timeout and not retried successfully, or a panic
+	config := MatchConfig{
+		Any: []MatchConfig{
+			{All: []MatchConfig{
+				{Pattern: "timeout"},
+				{Not: &MatchConfig{Pattern: "retried successfully"}},
+			}},
+			{Pattern: "^panic:"},
+		},
+	}
+
+	matcher, err := newMatchTree(config, MatchRegex, "")
+	assert.Nil(t, err)
+
+	assert.True(t, matcher.MatchString("upstream timeout"))
+	assert.False(t, matcher.MatchString("upstream timeout, retried successfully"))
+	assert.True(t, matcher.MatchString("panic: nil map"))
+	assert.False(t, matcher.MatchString("all good"))
+}
+
+func TestMatchTreeMatchType(t *testing.T) {
+	config := MatchConfig{
+		All: []MatchConfig{{Pattern: "ERROR"}, {Pattern: "disk"}},
+	}
+
+	matcher, err := newMatchTree(config, MatchSubstring, "")
+	assert.Nil(t, err)
+	assert.True(t, matcher.MatchString("ERROR: disk full"))
+	assert.False(t, matcher.MatchString("ERROR: (.*) full"))
+
+	_, err = newMatchTree(config, MatchSubstring, "i")
+	assert.NotNil(t, err)
+}
+
+func TestMatchTreeInvalid(t *testing.T) {
+	invalid := []MatchConfig{
+		{},
+		{Pattern: "a", Any: []MatchConfig{{Pattern: "b"}}},
+		{All: []MatchConfig{{Pattern: "a"}}, Not: &MatchConfig{Pattern: "b"}},
+		{Not: &MatchConfig{}},
+		{Any: []MatchConfig{{Pattern: "("}}},
+	}
+
+	for _, config := range invalid {
+		_, err := newMatchTree(config, MatchRegex, "")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestCollectorMatchTree(t *testing.T) {
+	collector, err := newCollector(CollectorConfig{
+		Name: "timeouts",
+		Match: &MatchConfig{All: []MatchConfig{
+			{Pattern: "timeout"},
+			{Not: &MatchConfig{Pattern: "retried"}},
+		}},
+		ExcludePattern: "healthcheck",
+	})
+	assert.Nil(t, err)
+
+	_, ok := collector.match("upstream timeout")
+	assert.True(t, ok)
+	_, ok = collector.match("upstream timeout, retried")
+	assert.False(t, ok)
+	_, ok = collector.match("healthcheck timeout")
+	assert.False(t, ok)
+
+	// A match replaces pattern, they can't both be set
+	_, err = newCollector(CollectorConfig{
+		Pattern: "timeout",
+		Match:   &MatchConfig{Pattern: "timeout"},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestParseMatchConfig(t *testing.T) {
+	var data = `
+- paths: ["/var/tests/*.log"]
+  match:
+    all:
+      - pattern: timeout
+      - not:
+          pattern: retried successfully
+`
+	config, _, err := ParseConfig([]byte(data))
+	assert.Nil(t, err)
+
+	match := (*config)[0].Match
+	assert.NotNil(t, match)
+	assert.Equal(t, 2, len(match.All))
+	assert.Equal(t, "timeout", match.All[0].Pattern)
+	assert.Equal(t, "retried successfully", match.All[1].Not.Pattern)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Sometimes all that should happen when a line matches or a timeout fires is a datapoint.
+// Instead of a program any command can have a "metric", which increments a counter or sets
+// a gauge in statsd (over UDP) or a Prometheus Pushgateway. Either way the metric is
+// labelled with the collector's name and labels; statsd gets them as DogStatsD style tags,
+// which Telegraf and the Datadog agent understand and plain statsd ignores.
+//
+// The value is 1 unless it's set, and can be a template like a command's args, so a gauge
+// can be set to something captured from the line:
+//
+//   metric:
+//     pushgateway: http://pushgateway:9091
+//     name: app_request_latency_ms
+//     type: gauge
+//     value: "{{.Groups.latency_ms}}"
+//
+// The Pushgateway replaces a metric whenever it's pushed rather than adding to it, so for
+// counters there we keep the running total ourselves and push that. It starts from zero
+// whenever Log Pulse does, which Prometheus' rate() and increase() take in their stride.
+
+const (
+	// MetricCounter adds the value to a counter, the default
+	MetricCounter = "counter"
+	// MetricGauge sets a gauge to the value
+	MetricGauge = "gauge"
+)
+
+// metricTimeout is how long we give a Pushgateway to accept a push
+const metricTimeout = 10 * time.Second
+
+var (
+	// Prometheus' rules for metric and label names, statsd is a lot less picky
+	metricNamePattern  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	metricLabelInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	// The running totals of the counters pushed to a Pushgateway, by URL, name and labels
+	pushedCounters      = make(map[string]float64)
+	pushedCountersMutex sync.Mutex
+)
+
+// validateMetric checks a command's metric
+func validateMetric(command CommandConfig) error {
+	metric := command.Metric
+	if metric.Name == "" {
+		if metric.Statsd != "" || metric.Pushgateway != "" || metric.Type != "" || metric.Value != "" {
+			return errors.New("A metric needs a name")
+		}
+		return nil
+	}
+	if command.Program != "" || command.Systemd.Unit != "" {
+		return fmt.Errorf("A command can only have one of a program, a systemd unit or a metric, %s has more", command)
+	}
+	if (metric.Statsd == "") == (metric.Pushgateway == "") {
+		return fmt.Errorf("The metric %s needs either a statsd address or a pushgateway URL", metric.Name)
+	}
+	if metric.Pushgateway != "" && !metricNamePattern.MatchString(metric.Name) {
+		return fmt.Errorf("%q isn't a valid metric name", metric.Name)
+	}
+	if metric.TLS.isSet() && metric.Pushgateway == "" {
+		return fmt.Errorf("The metric %s has TLS settings but statsd doesn't use TLS", metric.Name)
+	}
+	if err := metric.TLS.validate(); err != nil {
+		return err
+	}
+	switch metric.Type {
+	case "", MetricCounter, MetricGauge:
+	default:
+		return fmt.Errorf("Unknown metric type %q, expected counter or gauge", metric.Type)
+	}
+	return validateTemplates(CommandConfig{Program: metric.Value})
+}
+
+// metricType is the kind of metric
+func (config MetricConfig) metricType() string {
+	if config.Type == "" {
+		return MetricCounter
+	}
+	return config.Type
+}
+
+// String describes the metric for log messages and docs
+func (config MetricConfig) String() string {
+	destination := config.Statsd
+	if config.Pushgateway != "" {
+		destination = config.Pushgateway
+	}
+	return fmt.Sprintf("%s %s to %s", config.metricType(), config.Name, destination)
+}
+
+// Start sends the metric off, labelled with labels, returning a function that waits for it
+// to have been
+func (config MetricConfig) Start(labels map[string]string) (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not sending the %s", config)
+		return nil, ErrExecDisabled
+	}
+
+	value := 1.0
+	if config.Value != "" {
+		var err error
+		if value, err = strconv.ParseFloat(strings.TrimSpace(config.Value), 64); err != nil {
+			return nil, fmt.Errorf("The value of the %s isn't a number: %q", config, config.Value)
+		}
+	}
+
+	logp.Info("Sending the %s", config)
+	if config.Statsd != "" {
+		return func() error { return sendStatsd(config, value, labels) }, nil
+	}
+	return func() error { return pushMetric(config, value, labels) }, nil
+}
+
+// sendStatsd sends the metric to statsd as a single packet
+func sendStatsd(config MetricConfig, value float64, labels map[string]string) error {
+	kind := "c"
+	if config.metricType() == MetricGauge {
+		kind = "g"
+	}
+	packet := config.Name + ":" + strconv.FormatFloat(value, 'g', -1, 64) + "|" + kind
+
+	var tags []string
+	for _, key := range sortedKeys(labels) {
+		tags = append(tags, key+":"+labels[key])
+	}
+	if len(tags) > 0 {
+		packet += "|#" + strings.Join(tags, ",")
+	}
+
+	conn, err := net.Dial("udp", config.Statsd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(packet))
+	return err
+}
+
+// pushMetric pushes the metric to a Pushgateway, under the log-pulse job
+func pushMetric(config MetricConfig, value float64, labels map[string]string) error {
+	var pairs []string
+	for _, key := range sortedKeys(labels) {
+		name := metricLabelInvalid.ReplaceAllString(key, "_")
+		pairs = append(pairs, name+"="+strconv.Quote(labels[key]))
+	}
+	series := config.Name
+	if len(pairs) > 0 {
+		series += "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	if config.metricType() == MetricCounter {
+		pushedCountersMutex.Lock()
+		key := config.Pushgateway + " " + series
+		pushedCounters[key] += value
+		value = pushedCounters[key]
+		pushedCountersMutex.Unlock()
+	}
+
+	body := fmt.Sprintf("# TYPE %s %s\n%s %s\n", config.Name, config.metricType(), series, strconv.FormatFloat(value, 'g', -1, 64))
+	endpoint := strings.TrimRight(config.Pushgateway, "/") + "/metrics/job/log-pulse"
+	if collector, ok := labels["collector"]; ok {
+		endpoint += "/collector/" + url.PathEscape(collector)
+	}
+
+	client, err := config.TLS.httpClient(metricTimeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(endpoint, "text/plain; version=0.0.4", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("The Pushgateway answered with %s", resp.Status)
+	}
+	return nil
+}
+
+// metricLabels are the labels a collector's metrics get: its name and labels
+func (collector *Collector) metricLabels() map[string]string {
+	labels := map[string]string{"collector": collector.config.Name}
+	for key, value := range collector.config.Labels {
+		labels[key] = value
+	}
+	return labels
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMetric(t *testing.T) {
+	assert.Nil(t, validateMetric(CommandConfig{Program: "touch"}))
+	assert.Nil(t, validateMetric(CommandConfig{Metric: MetricConfig{Statsd: "localhost:8125", Name: "app.errors"}}))
+	assert.Nil(t, validateMetric(CommandConfig{Metric: MetricConfig{
+		Pushgateway: "http://localhost:9091",
+		Name:        "app_latency",
+		Type:        MetricGauge,
+		Value:       "{{.Groups.latency}}",
+	}}))
+
+	invalid := []CommandConfig{
+		{Metric: MetricConfig{Statsd: "localhost:8125"}},
+		{Metric: MetricConfig{Name: "errors"}},
+		{Metric: MetricConfig{Name: "errors", Statsd: "localhost:8125", Pushgateway: "http://localhost:9091"}},
+		{Metric: MetricConfig{Name: "app-errors", Pushgateway: "http://localhost:9091"}},
+		{Metric: MetricConfig{Name: "errors", Statsd: "localhost:8125", Type: "histogram"}},
+		{Metric: MetricConfig{Name: "errors", Statsd: "localhost:8125", Value: "{{.Line"}},
+		{Program: "touch", Metric: MetricConfig{Name: "errors", Statsd: "localhost:8125"}},
+	}
+	for _, command := range invalid {
+		assert.NotNil(t, validateMetric(command))
+	}
+}
+
+func TestMetricExpand(t *testing.T) {
+	command := CommandConfig{Metric: MetricConfig{Statsd: "localhost:8125", Name: "latency", Value: "{{.Groups.ms}}"}}
+	expanded, err := command.expand(commandData{Groups: map[string]string{"ms": "250"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "250", expanded.Metric.Value)
+	assert.Equal(t, "metric counter latency to localhost:8125", command.String())
+	assert.True(t, command.configured())
+
+	// Values that aren't numbers aren't sent
+	_, err = MetricConfig{Statsd: "localhost:8125", Name: "latency", Value: "slow"}.Start(nil)
+	assert.NotNil(t, err)
+}
+
+func TestSendStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	metric := MetricConfig{Statsd: conn.LocalAddr().String(), Name: "app.latency", Type: MetricGauge, Value: "12.5"}
+	wait, err := metric.Start(map[string]string{"collector": "app", "team": "web"})
+	assert.Nil(t, err)
+	assert.Nil(t, wait())
+
+	buffer := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "app.latency:12.5|g|#collector:app,team:web", string(buffer[:n]))
+}
+
+func TestPushMetric(t *testing.T) {
+	var paths, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	// Counters keep adding up
+	metric := MetricConfig{Pushgateway: server.URL + "/", Name: "app_timeouts"}
+	labels := map[string]string{"collector": "my app", "log-level": "error"}
+	for i := 0; i < 2; i++ {
+		wait, err := metric.Start(labels)
+		assert.Nil(t, err)
+		assert.Nil(t, wait())
+	}
+
+	assert.Equal(t, []string{"/metrics/job/log-pulse/collector/my app", "/metrics/job/log-pulse/collector/my app"}, paths)
+	assert.Equal(t, "# TYPE app_timeouts counter\n"+`app_timeouts{collector="my app",log_level="error"} 2`+"\n", bodies[1])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	wait, err := MetricConfig{Pushgateway: failing.URL, Name: "app_timeouts", Type: MetricGauge}.Start(labels)
+	assert.Nil(t, err)
+	assert.NotNil(t, wait())
+}
@@ -0,0 +1,28 @@
+package main
+
+import "github.com/elastic/beats/libbeat/logp"
+
+// A single match resets the timeout, so a service limping along at 1% of its usual
+// heartbeat rate looks just as healthy as one at 100%. With "timeout.min_matches" the
+// timeout only resets once that many lines have matched since it last did, and fires if
+// fewer than that come in within the interval. Every match still counts for everything
+// else (the match command, rates, stats), only the timeout needs the whole lot.
+//
+// The count starts again whenever the timeout resets or fires. It goes by the wall clock, so
+// it can't be combined with a timestamp.
+
+// pulse counts a match towards min_matches, reporting whether it's enough to reset the
+// timeout
+func (collector *Collector) pulse() bool {
+	needed := collector.config.Timeout.MinMatches
+	if needed <= 1 {
+		return true
+	}
+	collector.intervalMatches++
+	if collector.intervalMatches < needed {
+		logp.Debug("log-pulse", "Seen %d of %d matches needed this interval", collector.intervalMatches, needed)
+		return false
+	}
+	collector.intervalMatches = 0
+	return true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPulse(t *testing.T) {
+	// Without min_matches every match is a pulse
+	collector := Collector{}
+	assert.True(t, collector.pulse())
+
+	collector.config.Timeout.MinMatches = 3
+	assert.False(t, collector.pulse())
+	assert.False(t, collector.pulse())
+	assert.True(t, collector.pulse())
+
+	// and the count starts again afterwards
+	assert.False(t, collector.pulse())
+}
+
+func TestCollectorMinMatches(t *testing.T) {
+	collector, err := newCollector(CollectorConfig{
+		Pattern: "^Match",
+		Timeout: TimeoutConfig{Interval: time.Hour, MinMatches: 2},
+	})
+	assert.Nil(t, err)
+	collector.timedOutOnce = true
+
+	// One match isn't enough to count as having recovered
+	collector.handleMatch("Match", "", nil)
+	assert.True(t, collector.timedOutOnce)
+
+	// A timeout throws away the matches seen so far
+	collector.handleTimeout()
+	collector.handleMatch("Match", "", nil)
+	assert.True(t, collector.timedOutOnce)
+
+	collector.handleMatch("Match", "", nil)
+	assert.False(t, collector.timedOutOnce)
+
+	_, err = newCollector(CollectorConfig{
+		Pattern:   "^Match",
+		Timeout:   TimeoutConfig{Interval: time.Hour, MinMatches: 2},
+		Timestamp: TimestampConfig{Pattern: `^(\S+)`, Layout: time.RFC3339},
+	})
+	assert.NotNil(t, err)
+}
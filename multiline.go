@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Defaults for multiline settings, the same as FileBeat's
+const (
+	DefaultMultilineMaxLines = 500
+	DefaultMultilineTimeout  = 5 * time.Second
+)
+
+// FileBeat already assembles multiline events for its own prospectors using the multiline
+// settings in the raw config we hand it. Our own inputs (unix sockets and ssh) don't go
+// through FileBeat so this gives them the same behavior with the same settings:
+//
+//   pattern - lines matching it (or not matching it, with negate) are continuation lines
+//   match   - "after" appends continuation lines to the line before them, "before" prepends
+//             them to the line after them
+//   max_lines - lines beyond this in a single event are dropped
+//   timeout - a partial event is sent anyway after this long without a new line
+
+// multilineAssembler groups lines into events
+type multilineAssembler struct {
+	pattern  *regexp.Regexp
+	negate   bool
+	before   bool
+	maxLines int
+
+	buffer []string
+}
+
+func newMultilineAssembler(config MultilineConfig) (*multilineAssembler, error) {
+	pattern, err := regexp.Compile(config.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Match != "after" && config.Match != "before" {
+		return nil, fmt.Errorf("multiline.match must be after or before, not %q", config.Match)
+	}
+
+	maxLines := config.MaxLines
+	if maxLines <= 0 {
+		maxLines = DefaultMultilineMaxLines
+	}
+
+	return &multilineAssembler{
+		pattern:  pattern,
+		negate:   config.Negate,
+		before:   config.Match == "before",
+		maxLines: maxLines,
+	}, nil
+}
+
+// add takes the next line and returns an event if that line completed one
+func (assembler *multilineAssembler) add(line string) (string, bool) {
+	continuation := assembler.pattern.MatchString(line) != assembler.negate
+
+	if assembler.before {
+		// Continuation lines wait for the line after them
+		assembler.append(line)
+		if continuation {
+			return "", false
+		}
+		return assembler.flush()
+	}
+
+	// Continuation lines belong to whatever came before them
+	if continuation && len(assembler.buffer) > 0 {
+		assembler.append(line)
+		return "", false
+	}
+
+	event, ok := assembler.flush()
+	assembler.append(line)
+	return event, ok
+}
+
+func (assembler *multilineAssembler) append(line string) {
+	if len(assembler.buffer) < assembler.maxLines {
+		assembler.buffer = append(assembler.buffer, line)
+	}
+}
+
+// flush returns whatever has been gathered so far as an event
+func (assembler *multilineAssembler) flush() (string, bool) {
+	if len(assembler.buffer) == 0 {
+		return "", false
+	}
+	event := strings.Join(assembler.buffer, "\n")
+	assembler.buffer = nil
+	return event, true
+}
+
+// pending reports whether there's a partial event waiting to be flushed
+func (assembler *multilineAssembler) pending() bool {
+	return len(assembler.buffer) > 0
+}
+
+// multilineInput wraps one of our own inputs, assembling the lines it reads into events
+// before passing them on to the Collector
+type multilineInput struct {
+	input     Input
+	assembler *multilineAssembler
+	timeout   time.Duration
+
+	// The wrapped input sends its lines to raw and we send our events on to lines
+	raw   chan string
+	lines chan string
+
+	// Closed once we've sent our last event
+	finished chan struct{}
+}
+
+// newMultilineInput creates the wrapped input with newInput, handing it a channel of its own
+// to send its lines to
+func newMultilineInput(config MultilineConfig, lines chan string, newInput func(chan string) (Input, error)) (Input, error) {
+	assembler, err := newMultilineAssembler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultMultilineTimeout
+	}
+
+	raw := make(chan string)
+	input, err := newInput(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &multilineInput{
+		input:     input,
+		assembler: assembler,
+		timeout:   timeout,
+		raw:       raw,
+		lines:     lines,
+		finished:  make(chan struct{}),
+	}, nil
+}
+
+// Start begins assembling and then starts the wrapped input
+func (input *multilineInput) Start() {
+	go input.run()
+	input.input.Start()
+}
+
+// Stop stops the wrapped input and then waits for the last event to be passed on
+func (input *multilineInput) Stop() {
+	input.input.Stop()
+	close(input.raw)
+	<-input.finished
+}
+
+// Release frees the wrapped input's resources, for a multilineInput that will never be started
+func (input *multilineInput) Release() {
+	if inner, ok := input.input.(releaser); ok {
+		inner.Release()
+	}
+}
+
+func (input *multilineInput) run() {
+	defer close(input.finished)
+
+	// Only set while there's a partial event waiting
+	var flushTimeout <-chan time.Time
+	for {
+		select {
+		case line, ok := <-input.raw:
+			if !ok {
+				// The wrapped input has stopped, send whatever we have left
+				if event, ok := input.assembler.flush(); ok {
+					input.lines <- event
+				}
+				return
+			}
+
+			if event, ok := input.assembler.add(line); ok {
+				input.lines <- event
+			}
+		case <-flushTimeout:
+			logp.Debug("log-pulse", "Multiline timeout, sending partial event")
+			if event, ok := input.assembler.flush(); ok {
+				input.lines <- event
+			}
+		}
+
+		flushTimeout = nil
+		if input.assembler.pending() {
+			flushTimeout = time.After(input.timeout)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assemble runs lines through an assembler and returns every event, including the last
+// partial one
+func assemble(t *testing.T, config MultilineConfig, lines ...string) []string {
+	assembler, err := newMultilineAssembler(config)
+	assert.Nil(t, err)
+
+	var events []string
+	for _, line := range lines {
+		if event, ok := assembler.add(line); ok {
+			events = append(events, event)
+		}
+	}
+	if event, ok := assembler.flush(); ok {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestMultilineAfter(t *testing.T) {
+	// Java stack traces: indented lines belong to the line before them
+	events := assemble(t, MultilineConfig{Pattern: `^\s`, Match: "after"},
+		"Exception in thread main",
+		"  at com.example.Main",
+		"  at com.example.Other",
+		"All good",
+	)
+	assert.Equal(t, []string{
+		"Exception in thread main\n  at com.example.Main\n  at com.example.Other",
+		"All good",
+	}, events)
+
+	// Negated: everything that doesn't start with a date belongs to the line before it
+	events = assemble(t, MultilineConfig{Pattern: `^\d{4}-`, Negate: true, Match: "after"},
+		"2017-08-20 Something broke",
+		"because of this",
+		"2017-08-20 All good",
+	)
+	assert.Equal(t, []string{
+		"2017-08-20 Something broke\nbecause of this",
+		"2017-08-20 All good",
+	}, events)
+}
+
+func TestMultilineBefore(t *testing.T) {
+	// Lines ending in a backslash continue on the next line
+	events := assemble(t, MultilineConfig{Pattern: `\\$`, Match: "before"},
+		`one \`,
+		`two \`,
+		"three",
+		"four",
+	)
+	assert.Equal(t, []string{"one \\\ntwo \\\nthree", "four"}, events)
+}
+
+func TestMultilineMaxLines(t *testing.T) {
+	events := assemble(t, MultilineConfig{Pattern: `^\s`, Match: "after", MaxLines: 2},
+		"first",
+		" second",
+		" dropped",
+		"next",
+	)
+	assert.Equal(t, []string{"first\n second", "next"}, events)
+}
+
+func TestMultilineConfigErrors(t *testing.T) {
+	_, err := newMultilineAssembler(MultilineConfig{Pattern: `^\s`})
+	assert.NotNil(t, err)
+
+	_, err = newMultilineAssembler(MultilineConfig{Pattern: `(`, Match: "after"})
+	assert.NotNil(t, err)
+}
+
+// fakeInput is an Input that does nothing, its lines are sent by the test
+type fakeInput struct{}
+
+func (fakeInput) Start() {}
+func (fakeInput) Stop()  {}
+
+func TestMultilineInput(t *testing.T) {
+	lines := make(chan string, 2)
+	var raw chan string
+
+	input, err := newMultilineInput(
+		MultilineConfig{Pattern: `^\s`, Match: "after", Timeout: 20 * time.Millisecond},
+		lines,
+		func(c chan string) (Input, error) {
+			raw = c
+			return fakeInput{}, nil
+		},
+	)
+	assert.Nil(t, err)
+	input.Start()
+
+	raw <- "Exception"
+	raw <- "  at Main"
+	raw <- "Next"
+	time.Sleep(5 * time.Millisecond)
+	assertChanMsg(t, lines, "Exception\n  at Main")
+	assertChanEmpty(t, lines)
+
+	// A partial event is sent after the timeout
+	time.Sleep(40 * time.Millisecond)
+	assertChanMsg(t, lines, "Next")
+
+	// And anything left over is sent on stop
+	raw <- "Last"
+	input.Stop()
+	assertChanMsg(t, lines, "Last")
+}
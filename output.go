@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// By default a command's output is thrown away, which leaves a failing remediation script
+// invisible. A command's "output" can send what it writes to stdout and stderr to Log
+// Pulse's own log ("log") or append it to a file (anything else is taken as its path).
+// Whatever the output, a command exiting with anything other than success is logged as a
+// warning and counted in the collector's stats.
+
+// OutputLog sends a command's output to Log Pulse's log
+const OutputLog = "log"
+
+// attachOutput points a command's stdout and stderr wherever its output setting says. When
+// that's a file or a pipe it's returned so it can be closed once the command has started, the
+// command having its own copy of it by then.
+func (commandConfig CommandConfig) attachOutput(cmd *exec.Cmd) (*os.File, error) {
+	switch commandConfig.Output {
+	case "":
+		if commandConfig.capture == nil {
+			return nil, nil
+		}
+		// Output that used to go nowhere now goes through a pipe, which a daemon the command
+		// started could hold open long after it exited. Handing the command the pipe itself
+		// rather than a writer keeps Wait from waiting on it, the capture reading from it in
+		// the background instead.
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = writer
+		cmd.Stderr = writer
+		commandConfig.capture.readFrom(reader)
+		return writer, nil
+	case OutputLog:
+		writer := &outputLogger{command: commandConfig.String(), capture: commandConfig.capture}
+		cmd.Stdout = writer
+		cmd.Stderr = writer
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(commandConfig.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = file
+	cmd.Stderr = file
+	return file, nil
+}
+
+// maxOutputLine is the most of a line without a line break we hold on to before logging it
+// anyway, so a command writing a lot without any can't have us buffer all of it
+const maxOutputLine = 64 * 1024
+
+// outputLogger logs each line a command writes. Since stdout and stderr share it exec only
+// ever has one goroutine writing to it at a time. Lines can arrive split across writes, so
+// whatever comes after the last line break is held on to until the rest of the line arrives
+// or Flush is called once the command has exited.
+type outputLogger struct {
+	command string
+	// What's been written since the last line break
+	partial []byte
+	// Where lines go, Log Pulse's log if nil
+	emit func(line string)
+	// Where the output is also kept for the audit log, nil for nowhere
+	capture *outputCapture
+}
+
+func (logger *outputLogger) Write(output []byte) (int, error) {
+	if logger.capture != nil {
+		logger.capture.Write(output)
+	}
+	logger.partial = append(logger.partial, output...)
+	for {
+		end := bytes.IndexByte(logger.partial, '\n')
+		if end < 0 {
+			break
+		}
+		logger.log(logger.partial[:end])
+		logger.partial = logger.partial[end+1:]
+	}
+	if len(logger.partial) >= maxOutputLine {
+		logger.Flush()
+	}
+	return len(output), nil
+}
+
+// Flush logs whatever's left after the last line break
+func (logger *outputLogger) Flush() {
+	if len(logger.partial) > 0 {
+		logger.log(logger.partial)
+	}
+	logger.partial = nil
+}
+
+func (logger *outputLogger) log(line []byte) {
+	text := strings.TrimSuffix(string(line), "\r")
+	if logger.emit != nil {
+		logger.emit(text)
+		return
+	}
+	logp.Info("Output of %s: %s", logger.command, text)
+}
+
+// waitForOutput waits for a started command to exit and then logs what's left of its
+// output, if it's going to our log
+func waitForOutput(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if logger, ok := cmd.Stdout.(*outputLogger); ok {
+		logger.Flush()
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandOutputFile(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output.log")
+	command := CommandConfig{
+		Program: "sh",
+		Args:    []string{"-c", "echo out; echo err >&2"},
+		Output:  outputFile,
+	}
+
+	// Output is appended run after run
+	for i := 0; i < 2; i++ {
+		cmd, err := command.Start(nil)
+		assert.Nil(t, err)
+		assert.Nil(t, cmd.Wait())
+	}
+
+	contents, err := ioutil.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "out\nerr\nout\nerr\n", string(contents))
+}
+
+func TestCommandOutputLog(t *testing.T) {
+	command := CommandConfig{Program: "echo", Args: []string{"hello"}, Output: OutputLog}
+	cmd, err := command.Start(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Wait())
+	_, ok := cmd.Stdout.(*outputLogger)
+	assert.True(t, ok)
+}
+
+func TestOutputLoggerPartialLines(t *testing.T) {
+	var lines []string
+	logger := &outputLogger{emit: func(line string) {
+		lines = append(lines, line)
+	}}
+
+	// Lines are only logged once they're complete, however they're split up
+	logger.Write([]byte("first li"))
+	assert.Empty(t, lines)
+	logger.Write([]byte("ne\r\nsecond\n\nthi"))
+	assert.Equal(t, []string{"first line", "second", ""}, lines)
+	logger.Write([]byte("rd without a line break"))
+	logger.Flush()
+	assert.Equal(t, []string{"first line", "second", "", "third without a line break"}, lines)
+	logger.Flush()
+	assert.Equal(t, 4, len(lines))
+
+	// A line too long to hold on to is logged in pieces
+	lines = nil
+	logger.Write(make([]byte, maxOutputLine+1))
+	assert.Equal(t, 1, len(lines))
+}
+
+func TestCommandOutputLogFlushed(t *testing.T) {
+	var lines []string
+	logger := &outputLogger{emit: func(line string) {
+		lines = append(lines, line)
+	}}
+	cmd := CommandConfig{Program: "printf", Args: []string{"done\nno newline"}}.Cmd(nil)
+	cmd.Stdout = logger
+	cmd.Stderr = logger
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, waitWithTimeout(cmd, 0)())
+	assert.Equal(t, []string{"done", "no newline"}, lines)
+}
+
+func TestCommandOutputFileUnwritable(t *testing.T) {
+	command := CommandConfig{Program: "true", Output: "/nonexistent/output.log"}
+	cmd, err := command.Start(nil)
+	assert.Nil(t, cmd)
+	assert.NotNil(t, err)
+}
+
+func TestCollectorCommandFailures(t *testing.T) {
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   make(chan time.Time),
+		statsRequests:    make(chan chan CollectorStats),
+		finishedCommands: make(chan commandDuration),
+
+		config: CollectorConfig{
+			Command: CommandConfig{Program: "false"},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	time.Sleep(50 * time.Millisecond)
+
+	histogram := collector.Stats().Commands[MatchAction]
+	assert.Equal(t, 1, histogram.Count)
+	assert.Equal(t, 1, histogram.Failures)
+	assert.Contains(t, histogram.String(), "1 failed")
+
+	close(collector.Done)
+	<-collector.Stopped
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// patternFileCheckInterval is how often we look for changes to a collector's pattern_file
+const patternFileCheckInterval = 5 * time.Second
+
+// The ways a collector with several patterns can match them, see compilePatterns
+const (
+	EngineCombined = "combined"
+	EngineEach     = "each"
+)
+
+// A pattern_file holds one pattern per line, for collectors with too many patterns (a list
+// of known bad signatures for instance) to comfortably keep inline. A line matching any of
+// them, or the collector's own pattern if it has one, counts as a match. Blank lines and
+// lines starting with "#" are skipped. The file is checked for changes every few seconds and
+// reloaded, keeping the old patterns if the new ones don't compile.
+
+// readPatternFile reads the patterns in a pattern_file along with the file's modification time
+func readPatternFile(path string) ([]string, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if len(patterns) == 0 {
+		return nil, time.Time{}, fmt.Errorf("No patterns in %s", path)
+	}
+	return patterns, info.ModTime(), nil
+}
+
+// collectorPatterns gathers up a collector's pattern and the contents of its pattern_file
+func collectorPatterns(config CollectorConfig) ([]string, time.Time, error) {
+	if config.PatternFile == "" {
+		return []string{config.Pattern}, time.Time{}, nil
+	}
+
+	patterns, modTime, err := readPatternFile(config.PatternFile)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if config.Pattern != "" {
+		patterns = append([]string{config.Pattern}, patterns...)
+	}
+	return patterns, modTime, nil
+}
+
+// compilePatterns creates a single Matcher matching lines that match any of patterns. By
+// default (the "combined" engine) they're compiled into a single automaton: regular
+// expressions are joined into one, which keeps their named groups, and substrings and
+// prefixes go into an Aho-Corasick automaton. The "each" engine checks them one at a time
+// instead, which can be kinder to memory for very large or complicated lists.
+func compilePatterns(matchType string, patterns []string, flags string, engine string) (Matcher, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("No patterns to match")
+	}
+	if engine != "" && engine != EngineCombined && engine != EngineEach {
+		return nil, fmt.Errorf("Unknown pattern_engine %q, expected combined or each", engine)
+	}
+	if len(patterns) == 1 {
+		return newMatcher(matchType, patterns[0], flags)
+	}
+
+	if engine != EngineEach {
+		switch matchType {
+		case "", MatchRegex:
+			// Check them one at a time first, "a)|(b" makes a fine regular expression once
+			// it's wrapped up but it isn't one on its own
+			alternatives := make([]string, len(patterns))
+			for i, pattern := range patterns {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return nil, err
+				}
+				alternatives[i] = "(?:" + pattern + ")"
+			}
+			return compilePattern(strings.Join(alternatives, "|"), flags)
+		case MatchSubstring, MatchPrefix:
+			if flags != "" {
+				return nil, fmt.Errorf("pattern_flags can't be used with match_type %s", matchType)
+			}
+			return newAhoCorasick(patterns, matchType == MatchPrefix), nil
+		}
+	}
+
+	matchers := make(anyMatcher, len(patterns))
+	for i, pattern := range patterns {
+		matcher, err := newMatcher(matchType, pattern, flags)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = matcher
+	}
+	return matchers, nil
+}
+
+// anyMatcher matches lines matching any of its Matchers
+type anyMatcher []Matcher
+
+func (matchers anyMatcher) MatchString(line string) bool {
+	for _, matcher := range matchers {
+		if matcher.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadPatternFile swaps in the patterns from our pattern_file if it's changed since we
+// last read it
+func (collector *Collector) reloadPatternFile() {
+	info, err := os.Stat(collector.config.PatternFile)
+	if err != nil {
+		collector.logLimiter.Warn("Unable to check pattern file %s: %s", collector.config.PatternFile, err)
+		return
+	}
+	if info.ModTime().Equal(collector.patternFileModTime) {
+		return
+	}
+
+	patterns, modTime, err := collectorPatterns(collector.config)
+	if err == nil {
+		var pattern Matcher
+		if pattern, err = compilePatterns(collector.config.MatchType, patterns, collector.config.PatternFlags, collector.config.PatternEngine); err == nil {
+			collector.Pattern = pattern
+		}
+	}
+	if err != nil {
+		// Don't keep complaining about the same broken file
+		collector.patternFileModTime = info.ModTime()
+		logp.Warn("Collector %s is keeping its old patterns, unable to reload %s: %s", collector.config.Name, collector.config.PatternFile, err)
+		return
+	}
+
+	collector.patternFileModTime = modTime
+	logp.Info("Collector %s reloaded %d patterns from %s", collector.config.Name, len(patterns), collector.config.PatternFile)
+}
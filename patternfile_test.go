@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePatternFile(t *testing.T, path string, content string, modTime time.Time) {
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReadPatternFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-pulse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "patterns.txt")
+
+	writePatternFile(t, path, "# Known bad\ndisk full\n\n  out of memory  \n", time.Now())
+	patterns, _, err := readPatternFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"disk full", "out of memory"}, patterns)
+
+	writePatternFile(t, path, "# Nothing here\n", time.Now())
+	_, _, err = readPatternFile(path)
+	assert.NotNil(t, err)
+}
+
+func TestCompilePatterns(t *testing.T) {
+	matcher, err := compilePatterns("", []string{`disk (?P<disk>\w+) full`, "out of memory"}, "i", "")
+	assert.Nil(t, err)
+	regex, ok := matcher.(*regexp.Regexp)
+	assert.True(t, ok)
+	assert.True(t, regex.MatchString("DISK sda FULL"))
+	assert.True(t, regex.MatchString("Out of memory"))
+	assert.False(t, regex.MatchString("all good"))
+	assert.True(t, hasNamedGroups(regex))
+
+	// Each pattern has to make sense on its own
+	_, err = compilePatterns("", []string{"a)|(b", "c"}, "", "")
+	assert.NotNil(t, err)
+
+	for _, engine := range []string{"", EngineCombined, EngineEach} {
+		matcher, err = compilePatterns(MatchSubstring, []string{"disk full", "out of memory"}, "", engine)
+		assert.Nil(t, err)
+		assert.True(t, matcher.MatchString("ERROR out of memory"))
+		assert.False(t, matcher.MatchString("all good"))
+	}
+
+	_, err = compilePatterns(MatchSubstring, []string{"disk full", "out of memory"}, "", "hyperscan")
+	assert.NotNil(t, err)
+}
+
+func TestCollectorReloadPatternFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-pulse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "patterns.txt")
+
+	start := time.Now().Add(-time.Hour)
+	writePatternFile(t, path, "disk full\n", start)
+
+	collector := Collector{
+		config:             CollectorConfig{PatternFile: path, MatchType: MatchSubstring},
+		Pattern:            substringMatcher("disk full"),
+		patternFileModTime: start,
+	}
+
+	// Nothing changed
+	collector.reloadPatternFile()
+	assert.Equal(t, substringMatcher("disk full"), collector.Pattern)
+
+	writePatternFile(t, path, "disk full\nout of memory\n", start.Add(time.Minute))
+	collector.reloadPatternFile()
+	assert.True(t, matched(&collector, "ERROR out of memory"))
+
+	// A broken file leaves the old patterns in place
+	collector.config.MatchType = MatchRegex
+	writePatternFile(t, path, "disk (full\n", start.Add(2*time.Minute))
+	collector.reloadPatternFile()
+	assert.True(t, matched(&collector, "ERROR out of memory"))
+}
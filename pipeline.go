@@ -0,0 +1,77 @@
+package main
+
+import "github.com/elastic/beats/libbeat/logp"
+
+// A match or a timeout can run more than one command: "commands" lists commands to run after
+// "command" when a line matches and "timeout.commands" after "timeout.command" on a timeout.
+// They run one after another, each waiting for the one before it to exit whether or not it
+// succeeded, or all at once with "commands_parallel: true". A severity's command replaces
+// the whole list.
+
+// preparedCommand is a command that's ready to run, see prepareCommand
+type preparedCommand struct {
+	command CommandConfig
+	env     []string
+	// Runs the command's fallback, nil if it has none
+	fallback func()
+	// What a grpc, sns or lambda command sends
+	event pulseEvent
+}
+
+// commandList puts a trigger's command and its extra commands together, leaving out the
+// ones that aren't set
+func commandList(command CommandConfig, more []CommandConfig) []CommandConfig {
+	var commands []CommandConfig
+	for _, c := range append([]CommandConfig{command}, more...) {
+		if c.configured() {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+// runCommands runs a list of commands for an action, in order or all at once. Each of them
+// gets the groups in data in its environment, after its own sanitize.
+func (collector *Collector) runCommands(action string, commands []CommandConfig, data commandData) {
+	var inOrder []preparedCommand
+	for _, command := range commands {
+		env := collector.environment(sanitizeGroups(command.Sanitize, data.Groups))
+		if collector.config.CommandsParallel || len(commands) == 1 {
+			collector.runCommand(action, command, data, env)
+			continue
+		}
+		if prepared, ok := collector.prepareCommand(action, command, data, env); ok {
+			inOrder = append(inOrder, prepared)
+		}
+	}
+
+	if len(inOrder) > 0 {
+		go collector.runInOrder(action, inOrder)
+	}
+}
+
+// runInOrder runs commands one after another, each still having to fit under our caps on
+// running commands
+func (collector *Collector) runInOrder(action string, commands []preparedCommand) {
+	for _, prepared := range commands {
+		select {
+		case <-collector.Done:
+			return
+		default:
+		}
+
+		slots := collector.slots()
+		if collector.config.CommandOverflow == OverflowQueue {
+			if !acquireSlots(collector.Done, slots...) {
+				return
+			}
+		} else if !tryAcquireSlots(slots...) {
+			logp.Warn("Too many commands running, dropping %s command %s of collector %s", action, prepared.command, collector.config.Name)
+			continue
+		}
+
+		if wait, start, ok := collector.startCommand(action, prepared, slots); ok {
+			collector.waitForCommand(action, prepared, wait, start, slots)
+		}
+	}
+}
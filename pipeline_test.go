@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandList(t *testing.T) {
+	assert.Nil(t, commandList(CommandConfig{}, nil))
+	assert.Equal(t, []CommandConfig{{Program: "a"}, {Program: "b"}},
+		commandList(CommandConfig{Program: "a"}, []CommandConfig{{}, {Program: "b"}}))
+	assert.Equal(t, []CommandConfig{{Program: "b"}}, commandList(CommandConfig{}, []CommandConfig{{Program: "b"}}))
+}
+
+func TestMatchCommands(t *testing.T) {
+	collector := Collector{config: CollectorConfig{
+		Command:  CommandConfig{Program: "first"},
+		Commands: []CommandConfig{{Program: "second"}},
+		Severity: SeverityConfig{
+			Field:    "level",
+			Commands: map[string]CommandConfig{"FATAL": {Program: "page"}},
+		},
+	}}
+
+	commands, _ := collector.matchCommands(`{"level": "info"}`, nil)
+	assert.Equal(t, []CommandConfig{{Program: "first"}, {Program: "second"}}, commands)
+
+	// A severity's command replaces the whole list
+	commands, severity := collector.matchCommands(`{"level": "fatal"}`, nil)
+	assert.Equal(t, []CommandConfig{{Program: "page"}}, commands)
+	assert.Equal(t, "FATAL", severity)
+}
+
+func testCommandsOrder(t *testing.T, parallel bool) string {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "output")
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   timeoutChannel,
+		finishedCommands: make(chan commandDuration),
+
+		config: CollectorConfig{
+			CommandsParallel: parallel,
+			Timeout: TimeoutConfig{
+				Command: CommandConfig{Program: "sh", Args: []string{"-c", "sleep 0.1; echo first >> " + outputFile}},
+				Commands: []CommandConfig{
+					{Program: "sh", Args: []string{"-c", "echo second >> " + outputFile}},
+				},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	timeoutChannel <- time.Now()
+	time.Sleep(300 * time.Millisecond)
+	close(collector.Done)
+	<-collector.Stopped
+
+	output, _ := ioutil.ReadFile(outputFile)
+	return string(output)
+}
+
+func TestCollectorCommandsInOrder(t *testing.T) {
+	assert.Equal(t, "first\nsecond\n", testCommandsOrder(t, false))
+}
+
+func TestCollectorCommandsParallel(t *testing.T) {
+	assert.Equal(t, "second\nfirst\n", testCommandsOrder(t, true))
+}
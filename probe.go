@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// ProbeType is the collector type for checking that a network endpoint is up
+const ProbeType = "probe"
+
+// The protocols a probe can check with
+const (
+	ProbeTCP  = "tcp"
+	ProbeHTTP = "http"
+	ProbeICMP = "icmp"
+)
+
+// The address families a probe can be limited to
+const (
+	ProbeIPv4 = "ipv4"
+	ProbeIPv6 = "ipv6"
+)
+
+// Probe defaults, when they aren't configured
+const (
+	DefaultProbeInterval = 10 * time.Second
+	DefaultProbeTimeout  = 5 * time.Second
+)
+
+// ProbeInput checks a network endpoint every interval and turns the result into a line for
+// the collector, so network checks can share patterns, timeouts and commands with log files:
+//
+//	probe tcp db:5432 up latency=3ms
+//	probe http http://localhost/health up status=200 latency=12ms
+//	probe icmp gateway down error=...
+//
+// TCP probes are up when a connection can be opened and HTTP probes when the status is the
+// expected one (any 2xx by default). ICMP needs raw sockets, which need root, so ICMP probes
+// run the system's ping instead.
+type ProbeInput struct {
+	config ProbeConfig
+
+	// Where we send our lines, shared with the Collector
+	lines chan string
+
+	// Closed when Stop is called to tell our goroutine to finish up
+	done chan struct{}
+	// Closed when our goroutine has finished
+	finished chan struct{}
+}
+
+// NewProbeInput creates an input probing the endpoint described by config
+func NewProbeInput(config ProbeConfig, lines chan string) (*ProbeInput, error) {
+	if config.Address == "" {
+		return nil, errors.New("An address is required for probe collectors")
+	}
+	switch config.Protocol {
+	case ProbeTCP, ProbeHTTP, ProbeICMP:
+	default:
+		return nil, fmt.Errorf("Unknown probe protocol %q, expected tcp, http or icmp", config.Protocol)
+	}
+
+	switch config.Family {
+	case "", ProbeIPv4, ProbeIPv6:
+	default:
+		return nil, fmt.Errorf("Unknown probe family %q, expected ipv4 or ipv6", config.Family)
+	}
+	if config.TLS.isSet() && config.Protocol != ProbeHTTP {
+		return nil, fmt.Errorf("Only http probes use TLS, not %s ones", config.Protocol)
+	}
+	if err := config.TLS.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = DefaultProbeInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultProbeTimeout
+	}
+
+	return &ProbeInput{
+		config:   config,
+		lines:    lines,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}, nil
+}
+
+// Start begins probing in the background
+func (input *ProbeInput) Start() {
+	logp.Info("Probing %s %s every %s", input.config.Protocol, input.config.Address, input.config.Interval)
+	go input.run()
+}
+
+// Stop stops probing and waits for the probe in progress, if any, to finish
+func (input *ProbeInput) Stop() {
+	close(input.done)
+	<-input.finished
+}
+
+func (input *ProbeInput) run() {
+	defer close(input.finished)
+
+	ticker := time.NewTicker(input.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case input.lines <- input.probe():
+		case <-input.done:
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-input.done:
+			return
+		}
+	}
+}
+
+// probe checks the endpoint once and describes how it went
+func (input *ProbeInput) probe() string {
+	prefix := fmt.Sprintf("probe %s %s", input.config.Protocol, input.config.Address)
+	start := time.Now()
+
+	var details string
+	var err error
+	switch input.config.Protocol {
+	case ProbeTCP:
+		err = input.probeTCP()
+	case ProbeHTTP:
+		details, err = input.probeHTTP()
+	case ProbeICMP:
+		err = input.probeICMP()
+	}
+
+	if err != nil {
+		return fmt.Sprintf("%s down %serror=%s", prefix, details, err)
+	}
+	latency := time.Since(start) / time.Millisecond * time.Millisecond
+	return fmt.Sprintf("%s up %slatency=%s", prefix, details, latency)
+}
+
+// network is what to dial for the probe's family, leaving it to happy eyeballs without one
+func (input *ProbeInput) network() string {
+	switch input.config.Family {
+	case ProbeIPv4:
+		return "tcp4"
+	case ProbeIPv6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// dial connects to an address the way the probe's family says
+func (input *ProbeInput) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: input.config.Timeout, DualStack: true}
+	return dialer.DialContext(ctx, input.network(), address)
+}
+
+func (input *ProbeInput) probeTCP() error {
+	conn, err := input.dial(context.Background(), "tcp", input.config.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (input *ProbeInput) probeHTTP() (string, error) {
+	// A new client every time, so rotated certificates are picked up
+	client, err := input.config.TLS.httpClient(input.config.Timeout)
+	if err != nil {
+		return "", err
+	}
+	client.Transport.(*http.Transport).DialContext = input.dial
+	response, err := client.Get(input.config.Address)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	status := "status=" + strconv.Itoa(response.StatusCode) + " "
+	if input.config.ExpectStatus != 0 {
+		if response.StatusCode != input.config.ExpectStatus {
+			return status, fmt.Errorf("expected status %d", input.config.ExpectStatus)
+		}
+	} else if response.StatusCode < 200 || response.StatusCode > 299 {
+		return status, errors.New("expected a 2xx status")
+	}
+	return status, nil
+}
+
+func (input *ProbeInput) probeICMP() error {
+	seconds := int(input.config.Timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	args := []string{"-c", "1", "-W", strconv.Itoa(seconds)}
+	switch input.config.Family {
+	case ProbeIPv4:
+		args = append(args, "-4")
+	case ProbeIPv6:
+		args = append(args, "-6")
+	}
+	return exec.Command("ping", append(args, input.config.Address)...).Run()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProbeInput(t *testing.T) {
+	_, err := NewProbeInput(ProbeConfig{Protocol: ProbeTCP}, nil)
+	assert.NotNil(t, err)
+	_, err = NewProbeInput(ProbeConfig{Protocol: "udp", Address: "localhost:53"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+
+	input, err := NewProbeInput(ProbeConfig{Protocol: ProbeTCP, Address: address}, nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(input.probe(), "probe tcp "+address+" up latency="))
+
+	listener.Close()
+	assert.True(t, strings.HasPrefix(input.probe(), "probe tcp "+address+" down error="))
+}
+
+func TestProbeFamily(t *testing.T) {
+	_, err := NewProbeInput(ProbeConfig{Protocol: ProbeTCP, Address: "db:5432", Family: "ipx"}, nil)
+	assert.NotNil(t, err)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	input, err := NewProbeInput(ProbeConfig{Protocol: ProbeTCP, Address: address, Family: ProbeIPv4}, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, input.probe(), " up ")
+	input.config.Family = ProbeIPv6
+	assert.Contains(t, input.probe(), " down ")
+
+	// Not every host has IPv6, even on loopback
+	listener6, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 isn't available")
+	}
+	defer listener6.Close()
+	address = listener6.Addr().String()
+
+	input, err = NewProbeInput(ProbeConfig{Protocol: ProbeTCP, Address: address}, nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(input.probe(), "probe tcp "+address+" up latency="))
+	input.config.Family = ProbeIPv4
+	assert.Contains(t, input.probe(), " down ")
+}
+
+func TestProbeHTTP(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	input, err := NewProbeInput(ProbeConfig{Protocol: ProbeHTTP, Address: server.URL}, nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(input.probe(), "probe http "+server.URL+" up status=200 latency="))
+
+	status = http.StatusServiceUnavailable
+	assert.Equal(t, "probe http "+server.URL+" down status=503 error=expected a 2xx status", input.probe())
+
+	// Unless that's what we're expecting
+	input.config.ExpectStatus = http.StatusServiceUnavailable
+	assert.True(t, strings.HasPrefix(input.probe(), "probe http "+server.URL+" up status=503"))
+}
+
+func TestProbeInput(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	lines := make(chan string)
+	input, err := NewProbeInput(ProbeConfig{
+		Protocol: ProbeTCP,
+		Address:  listener.Addr().String(),
+		Interval: 10 * time.Millisecond,
+	}, lines)
+	assert.Nil(t, err)
+
+	input.Start()
+	assert.Contains(t, <-lines, " up ")
+	assert.Contains(t, <-lines, " up ")
+	input.Stop()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// ProcessType is the collector type for watching a process come and go
+const ProcessType = "process"
+
+// DefaultProcessInterval is how often /proc is checked if no interval is configured
+const DefaultProcessInterval = 5 * time.Second
+
+// procRoot is where the proc filesystem lives, tests point it elsewhere
+var procRoot = "/proc"
+
+// ProcessInput watches for processes with a given name by polling /proc, which means it only
+// works on Linux. A process that dies without logging anything leaves nothing in its logs
+// to notice, so instead this turns what it sees into lines of its own for the collector to
+// match just like any other:
+//
+//	process nginx started pid=1234
+//	process nginx exited pid=1234
+//
+// along with one of these every interval, which makes a good pulse for a timeout:
+//
+//	process nginx running count=2
+//	process nginx not running
+type ProcessInput struct {
+	config ProcessConfig
+
+	// Where we send our lines, shared with the Collector
+	lines chan string
+
+	// Closed when Stop is called to tell our goroutine to finish up
+	done chan struct{}
+	// Closed when our goroutine has finished
+	finished chan struct{}
+}
+
+// NewProcessInput creates an input watching for the process named in config
+func NewProcessInput(config ProcessConfig, lines chan string) (*ProcessInput, error) {
+	if config.Name == "" {
+		return nil, errors.New("A process name is required for process collectors")
+	}
+	if _, err := os.Stat(procRoot); err != nil {
+		return nil, fmt.Errorf("Process collectors need %s: %s", procRoot, err)
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = DefaultProcessInterval
+	}
+
+	return &ProcessInput{
+		config:   config,
+		lines:    lines,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}, nil
+}
+
+// Start begins polling in the background
+func (input *ProcessInput) Start() {
+	logp.Info("Watching for process %s", input.config.Name)
+	go input.run()
+}
+
+// Stop stops polling and waits for us to finish
+func (input *ProcessInput) Stop() {
+	close(input.done)
+	<-input.finished
+}
+
+func (input *ProcessInput) run() {
+	defer close(input.finished)
+
+	ticker := time.NewTicker(input.config.Interval)
+	defer ticker.Stop()
+
+	// Processes that are already running when we start count as started
+	running := make(map[int]bool)
+	for {
+		current := findProcesses(input.config.Name)
+		for _, line := range processEvents(input.config.Name, running, current) {
+			select {
+			case input.lines <- line:
+			case <-input.done:
+				return
+			}
+		}
+		running = current
+
+		select {
+		case <-ticker.C:
+		case <-input.done:
+			return
+		}
+	}
+}
+
+// processEvents works out the lines to send after a poll, given the pids seen last time and
+// this time
+func processEvents(name string, previous, current map[int]bool) []string {
+	var lines []string
+	for _, pid := range sortedPids(previous) {
+		if !current[pid] {
+			lines = append(lines, fmt.Sprintf("process %s exited pid=%d", name, pid))
+		}
+	}
+	for _, pid := range sortedPids(current) {
+		if !previous[pid] {
+			lines = append(lines, fmt.Sprintf("process %s started pid=%d", name, pid))
+		}
+	}
+
+	if len(current) > 0 {
+		lines = append(lines, fmt.Sprintf("process %s running count=%d", name, len(current)))
+	} else {
+		lines = append(lines, fmt.Sprintf("process %s not running", name))
+	}
+	return lines
+}
+
+func sortedPids(pids map[int]bool) []int {
+	var sorted []int
+	for pid := range pids {
+		sorted = append(sorted, pid)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
+
+// findProcesses returns the pids of every process called name, either by its command name
+// or by the file name of the program it was started as. The command name is cut short at
+// 15 characters by the kernel, the second catches the longer names.
+func findProcesses(name string) map[int]bool {
+	pids := make(map[int]bool)
+
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		logp.Err("Unable to read %s: %s", procRoot, err)
+		return pids
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// Processes can be gone by the time we get to them, which is fine
+		dir := filepath.Join(procRoot, entry.Name())
+		if comm, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil && strings.TrimSpace(string(comm)) == name {
+			pids[pid] = true
+			continue
+		}
+		if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+			program := string(bytes.SplitN(cmdline, []byte{0}, 2)[0])
+			if filepath.Base(program) == name {
+				pids[pid] = true
+			}
+		}
+	}
+	return pids
+}
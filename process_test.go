@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeProcess(t *testing.T, root string, pid string, comm string, cmdline string) {
+	dir := filepath.Join(root, pid)
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0644))
+}
+
+func TestFindProcesses(t *testing.T) {
+	root, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(root)
+	defer func(previous string) { procRoot = previous }(procRoot)
+	procRoot = root
+
+	fakeProcess(t, root, "10", "nginx", "nginx: master process\x00")
+	fakeProcess(t, root, "11", "bash", "/bin/bash\x00-c\x00nginx\x00")
+	// Command names are cut short at 15 characters
+	fakeProcess(t, root, "12", "payments-worke", "/usr/local/bin/payments-worker\x00--queue\x00")
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "self"), 0755))
+
+	assert.Equal(t, map[int]bool{10: true}, findProcesses("nginx"))
+	assert.Equal(t, map[int]bool{12: true}, findProcesses("payments-worker"))
+	assert.Equal(t, map[int]bool{}, findProcesses("postgres"))
+}
+
+func TestProcessEvents(t *testing.T) {
+	assert.Equal(t, []string{
+		"process nginx started pid=10",
+		"process nginx started pid=11",
+		"process nginx running count=2",
+	}, processEvents("nginx", map[int]bool{}, map[int]bool{10: true, 11: true}))
+
+	assert.Equal(t, []string{
+		"process nginx exited pid=11",
+		"process nginx running count=1",
+	}, processEvents("nginx", map[int]bool{10: true, 11: true}, map[int]bool{10: true}))
+
+	assert.Equal(t, []string{
+		"process nginx exited pid=10",
+		"process nginx not running",
+	}, processEvents("nginx", map[int]bool{10: true}, map[int]bool{}))
+}
+
+func TestProcessInput(t *testing.T) {
+	root, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(root)
+	defer func(previous string) { procRoot = previous }(procRoot)
+	procRoot = root
+
+	_, err := NewProcessInput(ProcessConfig{}, nil)
+	assert.NotNil(t, err)
+
+	lines := make(chan string)
+	input, err := NewProcessInput(ProcessConfig{Name: "nginx", Interval: 10 * time.Millisecond}, lines)
+	assert.Nil(t, err)
+
+	input.Start()
+	assert.Equal(t, "process nginx not running", <-lines)
+
+	fakeProcess(t, root, "10", "nginx", "nginx\x00")
+	for line := range lines {
+		if line != "process nginx not running" {
+			assert.Equal(t, "process nginx started pid=10", line)
+			break
+		}
+	}
+
+	// Stop doesn't wait for anyone to read our lines
+	input.Stop()
+}
@@ -0,0 +1,32 @@
+package main
+
+// The states a collector's match rate can be in, with respect to its rate config.
+// The empty string means the rate is within bounds.
+const (
+	RateAbove = "above"
+	RateBelow = "below"
+)
+
+// nextRateState works out which state a collector's match rate is in given its previous
+// state. A rate has to cross "above" or "below" to enter a state but has to come back past
+// the hysteresis margin to leave it again, so a rate hovering around a limit doesn't flap.
+func nextRateState(config RateConfig, current string, rate float64) string {
+	switch {
+	case config.Above > 0 && rate > config.Above:
+		return RateAbove
+	case config.Below > 0 && rate < config.Below:
+		return RateBelow
+	}
+
+	switch current {
+	case RateAbove:
+		if rate > config.Above*(1-config.Hysteresis) {
+			return RateAbove
+		}
+	case RateBelow:
+		if rate < config.Below*(1+config.Hysteresis) {
+			return RateBelow
+		}
+	}
+	return ""
+}
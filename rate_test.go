@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextRateState(t *testing.T) {
+	config := RateConfig{
+		Above:      100,
+		Below:      10,
+		Hysteresis: 0.2,
+	}
+
+	// Crossing the limits
+	assert.Equal(t, "", nextRateState(config, "", 50))
+	assert.Equal(t, RateAbove, nextRateState(config, "", 101))
+	assert.Equal(t, RateBelow, nextRateState(config, "", 9))
+
+	// Dropping back under "above" isn't enough, it has to get under 80
+	assert.Equal(t, RateAbove, nextRateState(config, RateAbove, 90))
+	assert.Equal(t, "", nextRateState(config, RateAbove, 79))
+
+	// Same for getting back over "below", it has to get over 12
+	assert.Equal(t, RateBelow, nextRateState(config, RateBelow, 11))
+	assert.Equal(t, "", nextRateState(config, RateBelow, 13))
+
+	// Unset limits are ignored
+	assert.Equal(t, "", nextRateState(RateConfig{Above: 100}, "", 0))
+	assert.Equal(t, "", nextRateState(RateConfig{Below: 10}, "", 1000))
+}
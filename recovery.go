@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Whatever a timeout command opened, an alert or an incident, someone has to close once the
+// pattern comes back. A timeout's "recovery_command" runs for the first matching line after
+// the timeout, or one of its tiers, has fired: it gets the line like a match command does,
+// along with how long the pattern was quiet for in LOGPULSE_SILENCE (in seconds). Timeouts
+// ignored for a grace period or outside active_hours don't count as having fired.
+
+// recover runs the recovery command for the line that ended the silence, before it's
+// recorded as our last match
+func (collector *Collector) recover(msg string, source string, groups map[string]string) {
+	collector.recoveryPending = false
+
+	var silence time.Duration
+	if !collector.stats.LastMatch.IsZero() {
+		silence = time.Since(collector.stats.LastMatch)
+	}
+	logp.Info("Collector %s matched again after a timeout, %s since its last match", collector.config.Name, silence)
+
+	command := collector.config.Timeout.RecoveryCommand
+	if !command.configured() {
+		return
+	}
+	data := commandData{
+		Line:      msg,
+		File:      source,
+		Collector: collector.config.Name,
+		Groups:    groups,
+		Severity:  extractSeverity(collector.config.Severity, msg, groups),
+	}
+	env := collector.environment(sanitizeGroups(command.Sanitize, groups))
+	if silence > 0 {
+		env = append(env, fmt.Sprintf("LOGPULSE_SILENCE=%d", int64(silence.Seconds())))
+	}
+	logp.Info("Running recovery command...")
+	collector.runCommand(RecoveryAction, command, data, env)
+}
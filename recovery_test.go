@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorRecoveryCommand(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	recoveries := filepath.Join(tmpDir, "recoveries")
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   timeoutChannel,
+		statsRequests:    make(chan chan CollectorStats),
+		finishedCommands: make(chan commandDuration),
+
+		config: CollectorConfig{
+			Timeout: TimeoutConfig{
+				Interval: time.Hour,
+				RecoveryCommand: CommandConfig{
+					Program: "sh",
+					Args:    []string{"-c", `echo "$1 $LOGPULSE_EVENT $LOGPULSE_SILENCE" >> ` + recoveries, "sh", "{{.Line}}"},
+				},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+
+	// Nothing to recover from without a timeout
+	collector.lines <- "Match 1"
+	time.Sleep(20 * time.Millisecond)
+	assertFileDoesNotExist(t, recoveries)
+
+	// Only the first match after a timeout runs the command
+	timeoutChannel <- time.Now()
+	collector.lines <- "Match 2"
+	collector.lines <- "Match 3"
+	time.Sleep(50 * time.Millisecond)
+
+	close(collector.Done)
+	<-collector.Stopped
+
+	contents, err := ioutil.ReadFile(recoveries)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(contents), "\n"))
+	assert.True(t, strings.HasPrefix(string(contents), "Match 2 recovery 0"), string(contents))
+	assert.False(t, collector.recoveryPending)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Sending Log Pulse a SIGHUP makes it read its config file again and bring the running
+// collectors in line with it without a restart. Collectors are told apart by name:
+//
+//   - collectors that are no longer in the file are stopped
+//   - new ones are started, after their dependencies like on startup
+//   - ones whose config changed are stopped and started again with the new one, keeping
+//     their stats and, for files, where they were in each of them
+//   - the rest carry on as if nothing happened, mid-timeout and all
+//
+// The names of the collectors added, removed and changed are logged, and the config they
+// were running before is kept for LastReload.
+//
+// A config file that doesn't parse, one without any collectors, or a collector in it that
+// can't be created, leaves everything as it was. Global flags like --max-running-commands
+// stay as they were.
+
+// fileStates keeps the latest FileBeat state of every file a collector reads, so that a
+// collector replaced by a reload can carry on from the same offsets. A nil fileStates
+// keeps nothing.
+type fileStates struct {
+	mutex    sync.Mutex
+	bySource map[string]file.State
+}
+
+func newFileStates() *fileStates {
+	return &fileStates{bySource: make(map[string]file.State)}
+}
+
+// record keeps a file's state, called from FileBeat's harvesters
+func (states *fileStates) record(state file.State) {
+	if states == nil || state.Source == "" {
+		return
+	}
+	states.mutex.Lock()
+	states.bySource[state.Source] = state
+	states.mutex.Unlock()
+}
+
+// finished returns the states for a new prospector to start from. FileBeat only takes over
+// states whose harvesters have finished, which ours will have by the time it starts.
+func (states *fileStates) finished() []file.State {
+	finished := []file.State{}
+	if states == nil {
+		return finished
+	}
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	for _, state := range states.bySource {
+		state.Finished = true
+		finished = append(finished, state)
+	}
+	return finished
+}
+
+// sameConfig reports whether two collectors' raw configs say the same thing
+func sameConfig(a *common.Config, b *common.Config) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	unpackedA := make(map[string]interface{})
+	unpackedB := make(map[string]interface{})
+	if a.Unpack(&unpackedA) != nil || b.Unpack(&unpackedB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(unpackedA, unpackedB)
+}
+
+// Reload brings the running collectors in line with a newly parsed config. A config that's
+// rejected leaves the current collectors running and is logged as critical, as a bad config
+// push would otherwise go unnoticed until something isn't being watched.
+func (collection *Collection) Reload(configs LogPulseConfig, rawConfigs []*common.Config) error {
+	err := collection.reload(configs, rawConfigs)
+	if err != nil {
+		logp.Critical("Rejected the reloaded config, keeping the current one: %s", err)
+	}
+	return err
+}
+
+func (collection *Collection) reload(configs LogPulseConfig, rawConfigs []*common.Config) error {
+	if len(configs) != len(rawConfigs) {
+		return errors.New("LogPulseConfig and rawConfigs must contain the same number of elements")
+	}
+	if len(configs) == 0 {
+		return errors.New("The new config has no collectors")
+	}
+
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+	if collection.stopping {
+		return errors.New("Log Pulse is stopping")
+	}
+	if !collection.running {
+		return errors.New("Log Pulse hasn't started yet")
+	}
+
+	// Create every new and changed collector before touching any of the running ones, so
+	// that a bad config leaves everything as it was
+	current := make(map[string]*Collector)
+	for _, c := range collection.collectors {
+		current[c.config.Name] = c
+	}
+	kept := make(map[*Collector]bool)
+	var collectors, added []*Collector
+	for i, config := range configs {
+		old := current[config.Name]
+		if old != nil && sameConfig(old.rawConfig, rawConfigs[i]) {
+			kept[old] = true
+			collectors = append(collectors, old)
+			continue
+		}
+		// A replacement carries on reading its files from where the one it replaces has
+		// got to. That one keeps reading until it's retired below, so the odd line might
+		// be seen by both.
+		states := []file.State{}
+		if old != nil {
+			states = old.fileStates.finished()
+		}
+		c, err := buildCollector(config, rawConfigs[i], states)
+		if err != nil {
+			discardCollectors(added)
+			return fmt.Errorf("Collector %s: %s", config.Name, err)
+		}
+		collectors = append(collectors, c)
+		added = append(added, c)
+	}
+	if err := checkDependencies(collectors); err != nil {
+		discardCollectors(added)
+		return err
+	}
+
+	diff := diffCollectors(collection.collectors, collectors, kept)
+	previous := collectorConfigs(collection.collectors)
+
+	// Stop the collectors that are going away, lowest priority first like on shutdown
+	retired := make(map[string]*Collector)
+	for _, c := range shutdownOrder(collection.collectors) {
+		if !kept[c] {
+			collection.retire(c)
+			retired[c.config.Name] = c
+		}
+	}
+
+	for _, c := range added {
+		c.statsChanged = collection.statsChanged
+		if c.config.ExitOnMatch {
+			c.exits = collection.exits
+		}
+		c.sharedCommandSlots = collection.sharedCommandSlots
+		c.auditLog = collection.AuditLog
+		if old := retired[c.config.Name]; old != nil {
+			// Carry on where the collector we're replacing left off
+			c.stats = old.stats.copy()
+		}
+	}
+	collection.collectors = collectors
+	collection.previousConfig = previous
+	collection.lastReload = diff
+
+	logp.Info("Reloaded the config: added %s, removed %s, changed %s, %d unchanged",
+		listNames(diff.Added), listNames(diff.Removed), listNames(diff.Changed), len(kept))
+	for _, c := range added {
+		// Like launch, but we're already holding the mutex startCollector takes
+		if len(c.config.DependsOn) == 0 {
+			c.Start()
+			collection.started[c] = true
+		} else {
+			go collection.startAfterDependencies(c)
+		}
+	}
+	return nil
+}
+
+// ConfigDiff is what a reload changed, by collector name
+type ConfigDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// LastReload returns the config the collectors were running before the last reload and what
+// it changed. Both are empty if there hasn't been one.
+func (collection *Collection) LastReload() (LogPulseConfig, ConfigDiff) {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+	return collection.previousConfig, collection.lastReload
+}
+
+// diffCollectors works out which collectors going from before to after adds, removes and
+// changes, kept being the ones that carry on as they are
+func diffCollectors(before []*Collector, after []*Collector, kept map[*Collector]bool) ConfigDiff {
+	var diff ConfigDiff
+	names := make(map[string]bool)
+	for _, c := range before {
+		names[c.config.Name] = true
+	}
+	for _, c := range after {
+		switch {
+		case kept[c]:
+		case names[c.config.Name]:
+			diff.Changed = append(diff.Changed, c.config.Name)
+		default:
+			diff.Added = append(diff.Added, c.config.Name)
+		}
+		delete(names, c.config.Name)
+	}
+	for _, c := range before {
+		if names[c.config.Name] {
+			diff.Removed = append(diff.Removed, c.config.Name)
+		}
+	}
+	return diff
+}
+
+// collectorConfigs returns the configs the collectors are running
+func collectorConfigs(collectors []*Collector) LogPulseConfig {
+	var configs LogPulseConfig
+	for _, c := range collectors {
+		configs = append(configs, c.config)
+	}
+	return configs
+}
+
+// listNames lists collector names for the log
+func listNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// discardCollectors frees the collectors a failed reload created
+func discardCollectors(collectors []*Collector) {
+	for _, c := range collectors {
+		c.discard()
+	}
+}
+
+// retire stops a collector that a reload removed or replaced. One that never started, as
+// it's still waiting on its dependencies, has to stop waiting and give up what it was
+// created with, like the socket its replacement is about to create.
+func (collection *Collection) retire(c *Collector) {
+	logp.Info("Stopping collector %s for the reload", c.config.Name)
+	if collection.started[c] {
+		c.Stop()
+	} else {
+		c.discard()
+		close(c.Done)
+	}
+	delete(collection.started, c)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStates(t *testing.T) {
+	var none *fileStates
+	none.record(file.State{Source: "/var/log/app.log"})
+	assert.Empty(t, none.finished())
+
+	states := newFileStates()
+	states.record(file.State{})
+	states.record(file.State{Source: "/var/log/app.log", Offset: 10})
+	states.record(file.State{Source: "/var/log/app.log", Offset: 20})
+
+	finished := states.finished()
+	assert.Equal(t, 1, len(finished))
+	assert.Equal(t, int64(20), finished[0].Offset)
+	assert.True(t, finished[0].Finished)
+}
+
+// reloadable builds the config of a set of collectors, each with its own pattern
+func reloadable(patterns map[string]string) (LogPulseConfig, []*common.Config) {
+	var configs LogPulseConfig
+	var rawConfigs []*common.Config
+	for _, name := range sortedKeys(patterns) {
+		configs = append(configs, CollectorConfig{Name: name, Pattern: patterns[name]})
+		raw, _ := common.NewConfigFrom(map[string]interface{}{"name": name, "pattern": patterns[name]})
+		rawConfigs = append(rawConfigs, raw)
+	}
+	return configs, rawConfigs
+}
+
+func TestCollectionReload(t *testing.T) {
+	configs, rawConfigs := reloadable(map[string]string{"a": "^A", "b": "^B", "c": "^C"})
+	collection, err := CreateCollection(configs, rawConfigs)
+	assert.Nil(t, err)
+
+	// Nothing can be reloaded before the collection has started
+	assert.NotNil(t, collection.Reload(configs, rawConfigs))
+	collection.Start()
+	defer collection.Stop()
+
+	a, b, c := collection.collectors[0], collection.collectors[1], collection.collectors[2]
+	b.lines <- "B"
+	time.Sleep(50 * time.Millisecond)
+
+	// a stays as it is, b changes, c goes and d comes
+	configs, rawConfigs = reloadable(map[string]string{"a": "^A", "b": "^Bee", "d": "^D"})
+	assert.Nil(t, collection.Reload(configs, rawConfigs))
+
+	assert.Equal(t, 3, len(collection.collectors))
+	assert.True(t, a == collection.collectors[0])
+	newB, d := collection.collectors[1], collection.collectors[2]
+	assert.False(t, b == newB)
+	assert.Equal(t, "^Bee", newB.config.Pattern)
+	assert.Equal(t, "d", d.config.Name)
+
+	<-b.Stopped
+	<-c.Stopped
+	select {
+	case <-a.Stopped:
+		t.Error("The unchanged collector was stopped")
+	default:
+	}
+
+	previous, diff := collection.LastReload()
+	assert.Equal(t, ConfigDiff{Added: []string{"d"}, Removed: []string{"c"}, Changed: []string{"b"}}, diff)
+	assert.Equal(t, 3, len(previous))
+	assert.Equal(t, "^B", previous[1].Pattern)
+
+	// The replacement kept the stats of the collector it replaced
+	assert.False(t, newB.Stats().LastMatch.IsZero())
+	assert.Nil(t, collection.Control("d", ControlReset))
+
+	// A bad config leaves everything as it was
+	configs, rawConfigs = reloadable(map[string]string{"a": "^A", "b": "(", "d": "^D"})
+	assert.NotNil(t, collection.Reload(configs, rawConfigs))
+	assert.True(t, newB == collection.collectors[1])
+
+	configs, rawConfigs = reloadable(map[string]string{"a": "^A"})
+	configs[0].DependsOn = []string{"missing"}
+	rawConfigs[0], _ = common.NewConfigFrom(map[string]interface{}{"name": "a", "pattern": "^A", "depends_on": "missing"})
+	assert.NotNil(t, collection.Reload(configs, rawConfigs))
+	assert.Equal(t, 3, len(collection.collectors))
+
+	// So does an input that can't be created, without leaving the ones that could behind
+	dir, err := ioutil.TempDir("", "log-pulse-reload")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	taken := filepath.Join(dir, "taken.sock")
+	listener, err := net.Listen("unix", taken)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	configs, rawConfigs = reloadable(map[string]string{"a": "^A", "b": "^B", "d": "^Dee", "e": "^E"})
+	configs[2].Type = UnixSocketType
+	configs[2].Socket.Path = filepath.Join(dir, "d.sock")
+	configs[3].Type = UnixSocketType
+	configs[3].Socket.Path = taken
+	assert.NotNil(t, collection.Reload(configs, rawConfigs))
+	assert.Equal(t, 3, len(collection.collectors))
+	assert.True(t, newB == collection.collectors[1])
+	assert.Nil(t, collection.Control("d", ControlReset))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files))
+
+	// And so does a config without any collectors
+	assert.NotNil(t, collection.Reload(LogPulseConfig{}, []*common.Config{}))
+	assert.Equal(t, 3, len(collection.collectors))
+	_, unchanged := collection.LastReload()
+	assert.Equal(t, diff, unchanged)
+	assert.Nil(t, collection.Control("a", ControlReset))
+}
+
+func TestCollectionReloadSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-pulse-reload")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pulse.sock")
+
+	configs, rawConfigs := reloadable(map[string]string{"a": "^A"})
+	configs[0].Type = UnixSocketType
+	configs[0].Socket.Path = path
+	collection, err := CreateCollection(configs, rawConfigs)
+	assert.Nil(t, err)
+	collection.Start()
+	defer collection.Stop()
+
+	// The replacement takes the socket over from the collector it replaces
+	configs, rawConfigs = reloadable(map[string]string{"a": "^Ay"})
+	configs[0].Type = UnixSocketType
+	configs[0].Socket.Path = path
+	assert.Nil(t, collection.Reload(configs, rawConfigs))
+
+	conn, err := net.Dial("unix", path)
+	assert.Nil(t, err)
+	conn.Write([]byte("Ay\n"))
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, collection.collectors[0].Stats().LastMatch.IsZero())
+}
+
+func TestCollectionReloadDependency(t *testing.T) {
+	configs, rawConfigs := reloadable(map[string]string{"a": "^A", "b": "^B"})
+	configs[1].DependsOn = []string{"a"}
+	collection, err := CreateCollection(configs, rawConfigs)
+	assert.Nil(t, err)
+	collection.Start()
+	defer collection.Stop()
+
+	// b waits on a, and then on what replaces it
+	configs, rawConfigs = reloadable(map[string]string{"a": "^Ay", "b": "^B"})
+	configs[1].DependsOn = []string{"a"}
+	assert.Nil(t, collection.Reload(configs, rawConfigs))
+	assert.NotNil(t, collection.Control("b", ControlReset))
+
+	collection.collectors[0].lines <- "Ay"
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, collection.Control("b", ControlReset))
+}
+
+func TestCollectionReloadWaitingSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-pulse-reload")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pulse.sock")
+
+	// b never gets to start, as a never matches
+	configs, rawConfigs := reloadable(map[string]string{"a": "^A", "b": "^B"})
+	configs[1].Type = UnixSocketType
+	configs[1].Socket.Path = path
+	configs[1].DependsOn = []string{"a"}
+	collection, err := CreateCollection(configs, rawConfigs)
+	assert.Nil(t, err)
+	collection.Start()
+	defer collection.Stop()
+
+	// Replacing it frees the socket it was created with for its replacement
+	configs, rawConfigs = reloadable(map[string]string{"a": "^A", "b": "^Bee"})
+	configs[1].Type = UnixSocketType
+	configs[1].Socket.Path = path
+	configs[1].DependsOn = []string{"a"}
+	assert.Nil(t, collection.Reload(configs, rawConfigs))
+	assert.Equal(t, "^Bee", collection.collectors[1].config.Pattern)
+}
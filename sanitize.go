@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Text taken from a log line can be awkward to hand to a command: colored output carries
+// ANSI escape codes, lines can be huge and they can hold secrets. Every command can have a
+// "sanitize" which cleans up what it's given from the line (the named groups of the pattern)
+// in a fixed order:
+//
+//   strip_ansi          - removes ANSI escape codes
+//   mask                - replaces whatever each pattern matches, "***" by default
+//   collapse_whitespace - turns every run of whitespace into a single space and trims the ends
+//   truncate            - keeps only the first N characters
+
+// defaultMaskReplacement is what masked text is replaced with unless told otherwise
+const defaultMaskReplacement = "***"
+
+// ansiEscapes matches ANSI escape codes: CSI sequences like colors and cursor movement, OSC
+// sequences like window titles and links, and the remaining two character escapes
+var ansiEscapes = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// validateSanitize makes sure a command's sanitize can be applied
+func validateSanitize(config SanitizeConfig) error {
+	if config.Truncate < 0 {
+		return errors.New("sanitize.truncate can't be negative")
+	}
+	for _, mask := range config.Mask {
+		if mask.Pattern == "" {
+			return errors.New("A sanitize mask needs a pattern")
+		}
+		if _, err := regexp.Compile(mask.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sanitize applies a command's sanitize to a value taken from a line. It's expected to have
+// been through validateSanitize.
+func sanitize(config SanitizeConfig, value string) string {
+	if config.StripANSI {
+		value = ansiEscapes.ReplaceAllString(value, "")
+	}
+
+	for _, mask := range config.Mask {
+		replacement := mask.Replacement
+		if replacement == "" {
+			replacement = defaultMaskReplacement
+		}
+		value = regexp.MustCompile(mask.Pattern).ReplaceAllLiteralString(value, replacement)
+	}
+
+	if config.CollapseWhitespace {
+		value = strings.TrimSpace(whitespace.ReplaceAllString(value, " "))
+	}
+
+	// Count characters rather than bytes so we never cut one in half
+	if config.Truncate > 0 && utf8.RuneCountInString(value) > config.Truncate {
+		value = string([]rune(value)[:config.Truncate])
+	}
+	return value
+}
+
+// sanitizeGroups applies a command's sanitize to every named group
+func sanitizeGroups(config SanitizeConfig, groups map[string]string) map[string]string {
+	if groups == nil {
+		return nil
+	}
+	sanitized := make(map[string]string, len(groups))
+	for name, value := range groups {
+		sanitized[name] = sanitize(config, value)
+	}
+	return sanitized
+}
+
+// sanitizeLines sanitizes every one of a list of lines
+func sanitizeLines(config SanitizeConfig, lines []string) []string {
+	if lines == nil {
+		return nil
+	}
+	sanitized := make([]string, len(lines))
+	for i, line := range lines {
+		sanitized[i] = sanitize(config, line)
+	}
+	return sanitized
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	// Nothing is touched by default
+	assert.Equal(t, "  \x1b[31mred\x1b[0m  ", sanitize(SanitizeConfig{}, "  \x1b[31mred\x1b[0m  "))
+
+	assert.Equal(t, "red bold link", sanitize(SanitizeConfig{StripANSI: true},
+		"\x1b[31mred\x1b[0m \x1b[1;4mbold\x1b[m \x1b]8;;http://example.com\x07link\x1b]8;;\x07"))
+
+	assert.Equal(t, "a b c", sanitize(SanitizeConfig{CollapseWhitespace: true}, " a \t b\n\nc  "))
+
+	// Characters are counted, not bytes
+	assert.Equal(t, "héllo", sanitize(SanitizeConfig{Truncate: 5}, "héllo world"))
+	assert.Equal(t, "hi", sanitize(SanitizeConfig{Truncate: 5}, "hi"))
+
+	masked := sanitize(SanitizeConfig{Mask: []MaskConfig{
+		{Pattern: `password=\S+`},
+		{Pattern: `\d{4}-\d{4}-\d{4}-\d{4}`, Replacement: "<card>"},
+	}}, "login password=hunter2 card 1234-5678-9012-3456")
+	assert.Equal(t, "login *** card <card>", masked)
+
+	// Everything together, in order
+	all := SanitizeConfig{
+		StripANSI:          true,
+		Mask:               []MaskConfig{{Pattern: "secret"}},
+		CollapseWhitespace: true,
+		Truncate:           10,
+	}
+	assert.Equal(t, "user *** l", sanitize(all, "\x1b[33muser   secret\x1b[0m   logged in"))
+}
+
+func TestValidateSanitize(t *testing.T) {
+	assert.Nil(t, validateSanitize(SanitizeConfig{Truncate: 10, Mask: []MaskConfig{{Pattern: "a+"}}}))
+	assert.NotNil(t, validateSanitize(SanitizeConfig{Truncate: -1}))
+	assert.NotNil(t, validateSanitize(SanitizeConfig{Mask: []MaskConfig{{Pattern: "("}}}))
+	assert.NotNil(t, validateSanitize(SanitizeConfig{Mask: []MaskConfig{{Replacement: "x"}}}))
+}
+
+func TestSanitizeGroups(t *testing.T) {
+	assert.Nil(t, sanitizeGroups(SanitizeConfig{Truncate: 3}, nil))
+	assert.Equal(t, map[string]string{"user": "bob", "message": "dis"},
+		sanitizeGroups(SanitizeConfig{Truncate: 3}, map[string]string{"user": "bob", "message": "disk full"}))
+}
+
+func TestCollectorInvalidSanitize(t *testing.T) {
+	_, err := newCollector(CollectorConfig{
+		Pattern: "ERROR",
+		Timeout: TimeoutConfig{Command: CommandConfig{
+			Program:  "alert",
+			Sanitize: SanitizeConfig{Mask: []MaskConfig{{Pattern: "("}}},
+		}},
+	})
+	assert.NotNil(t, err)
+}
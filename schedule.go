@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// How long is too long to go without a match often depends on the time of day: a minute
+// during business hours can be fifteen at night. A timeout's "schedule" lists windows, in the
+// same format as active_hours, each with its own interval:
+//
+//   schedule:
+//     - hours: Mon-Fri 08:00-20:00
+//       interval: 1m
+//
+// The first window covering the current time picks the interval, and outside all of them
+// it's the timeout's own interval. The interval is picked whenever the timeout starts
+// counting again, after a match or a timeout, so a change of window takes effect from then
+// on. The event clock of a timestamp always goes by the timeout's own interval.
+
+// scheduledInterval is one of the windows of a timeout's schedule
+type scheduledInterval struct {
+	hours    *activeHours
+	interval time.Duration
+}
+
+// newTimeoutSchedule parses a timeout's schedule, its hours being in timezone
+func newTimeoutSchedule(schedule []TimeoutScheduleConfig, timezone string) ([]scheduledInterval, error) {
+	var parsed []scheduledInterval
+	for _, entry := range schedule {
+		if entry.Interval <= 0 {
+			return nil, fmt.Errorf("The timeout schedule for %q needs an interval", entry.Hours)
+		}
+		if entry.Hours == "" {
+			return nil, fmt.Errorf("The timeout schedule for an interval of %s needs hours", entry.Interval)
+		}
+		hours, err := newActiveHours([]string{entry.Hours}, timezone)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, scheduledInterval{hours: hours, interval: entry.Interval})
+	}
+	return parsed, nil
+}
+
+// interval is how long the timeout waits for a match, counting from now
+func (collector *Collector) interval(now time.Time) time.Duration {
+	for _, entry := range collector.timeoutSchedule {
+		if entry.hours.active(now) {
+			return entry.interval
+		}
+	}
+	return collector.config.Timeout.Interval
+}
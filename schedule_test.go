@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTimeoutSchedule(t *testing.T) {
+	schedule, err := newTimeoutSchedule(nil, "")
+	assert.Nil(t, err)
+	assert.Empty(t, schedule)
+
+	invalid := [][]TimeoutScheduleConfig{
+		{{Hours: "Mon-Fri 08:00-20:00"}},
+		{{Interval: time.Minute}},
+		{{Hours: "Someday", Interval: time.Minute}},
+	}
+	for _, config := range invalid {
+		_, err := newTimeoutSchedule(config, "")
+		assert.NotNil(t, err)
+	}
+
+	_, err = newTimeoutSchedule([]TimeoutScheduleConfig{{Hours: "08:00-20:00", Interval: time.Minute}}, "Mars/Olympus_Mons")
+	assert.NotNil(t, err)
+}
+
+func TestCollectorInterval(t *testing.T) {
+	collector, err := newCollector(CollectorConfig{
+		Pattern: "x",
+		Timeout: TimeoutConfig{
+			Interval: 15 * time.Minute,
+			Timezone: "UTC",
+			Schedule: []TimeoutScheduleConfig{
+				{Hours: "Mon-Fri 08:00-20:00", Interval: time.Minute},
+				{Hours: "Sat", Interval: time.Hour},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	// Wednesday
+	assert.Equal(t, time.Minute, collector.interval(time.Date(2017, 11, 1, 9, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 15*time.Minute, collector.interval(time.Date(2017, 11, 1, 21, 0, 0, 0, time.UTC)))
+	// Saturday and Sunday
+	assert.Equal(t, time.Hour, collector.interval(time.Date(2017, 11, 4, 9, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 15*time.Minute, collector.interval(time.Date(2017, 11, 5, 9, 0, 0, 0, time.UTC)))
+
+	// Outside of the schedule there has to be an interval to fall back on
+	_, err = newCollector(CollectorConfig{
+		Pattern: "x",
+		Timeout: TimeoutConfig{Schedule: []TimeoutScheduleConfig{{Hours: "Sat", Interval: time.Hour}}},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// sequence tracks a collector's expectation that a line matching start is followed by a line
+// matching end within some time, like "backup started" having to be followed by "backup
+// finished". It's a small state machine that's either idle or waiting on an end line and is
+// only ever touched by the collector's process goroutine.
+type sequence struct {
+	start  *regexp.Regexp
+	end    *regexp.Regexp
+	within time.Duration
+
+	// Only running while we're waiting on an end line
+	timer *time.Timer
+	// The named groups captured by the start line we're waiting on
+	startGroups map[string]string
+}
+
+func newSequence(config SequenceConfig, flags string) (*sequence, error) {
+	if config.End == "" || config.Within <= 0 {
+		return nil, errors.New("A sequence needs an end and a within duration")
+	}
+
+	start, err := compilePattern(config.Start, flags)
+	if err != nil {
+		return nil, err
+	}
+	end, err := compilePattern(config.End, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sequence{
+		start:  start,
+		end:    end,
+		within: config.Within,
+	}, nil
+}
+
+// observe moves the sequence along with the next line. While we're waiting on an end line
+// further start lines don't restart the clock, the first one still needs its end.
+func (seq *sequence) observe(line string) {
+	if seq.timer != nil {
+		if seq.end.MatchString(line) {
+			logp.Debug("log-pulse", "Sequence completed")
+			seq.stop()
+		}
+		return
+	}
+
+	if submatches := seq.start.FindStringSubmatch(line); submatches != nil {
+		logp.Debug("log-pulse", "Sequence started, expecting its end within %s", seq.within)
+		seq.startGroups = namedGroups(seq.start, submatches)
+		seq.timer = time.NewTimer(seq.within)
+	}
+}
+
+// expired fires if the end line doesn't come in time. It's nil when we aren't waiting,
+// or don't have a sequence at all.
+func (seq *sequence) expired() <-chan time.Time {
+	if seq == nil || seq.timer == nil {
+		return nil
+	}
+	return seq.timer.C
+}
+
+// expire goes back to idle after the end line didn't come, returning the groups captured by
+// the start line
+func (seq *sequence) expire() map[string]string {
+	groups := seq.startGroups
+	seq.timer = nil
+	seq.startGroups = nil
+	return groups
+}
+
+func (seq *sequence) stop() {
+	if seq.timer != nil {
+		seq.timer.Stop()
+	}
+	seq.timer = nil
+	seq.startGroups = nil
+}
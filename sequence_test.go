@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSequence(t *testing.T) {
+	_, err := newSequence(SequenceConfig{Start: "started", Within: time.Minute}, "")
+	assert.NotNil(t, err)
+	_, err = newSequence(SequenceConfig{Start: "started", End: "finished"}, "")
+	assert.NotNil(t, err)
+	_, err = newSequence(SequenceConfig{Start: "(", End: "finished", Within: time.Minute}, "")
+	assert.NotNil(t, err)
+}
+
+func TestSequence(t *testing.T) {
+	seq, err := newSequence(SequenceConfig{
+		Start:  `backup (?P<job>\w+) started`,
+		End:    "backup .* finished",
+		Within: 20 * time.Millisecond,
+	}, "")
+	assert.Nil(t, err)
+
+	// Idle until a start line comes in
+	seq.observe("backup nightly finished")
+	assert.Nil(t, seq.expired())
+
+	seq.observe("backup nightly started")
+	assert.NotNil(t, seq.expired())
+	seq.observe("backup nightly finished")
+	assert.Nil(t, seq.expired())
+
+	seq.observe("backup weekly started")
+	select {
+	case <-seq.expired():
+	case <-time.After(time.Second):
+		t.Fatal("Sequence never expired")
+	}
+	assert.Equal(t, map[string]string{"job": "weekly"}, seq.expire())
+	assert.Nil(t, seq.expired())
+
+	// A nil sequence never expires
+	var none *sequence
+	assert.Nil(t, none.expired())
+}
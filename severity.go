@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A collector can pick its match command by the severity of the matching line rather than
+// always running the same one, so a single collector can log warnings, report errors and
+// page someone for fatals. The level comes from either a named group in the pattern or a
+// field of lines that are JSON objects, and is compared case insensitively.
+
+// validateSeverity checks a collector's severity settings against its pattern and returns
+// them with the command levels upper cased
+func validateSeverity(config SeverityConfig, pattern Matcher) (SeverityConfig, error) {
+	if config.Group != "" && config.Field != "" {
+		return config, fmt.Errorf("A severity can come from a group or a field, not both")
+	}
+
+	if config.Group != "" {
+		regex, ok := pattern.(*regexp.Regexp)
+		if !ok || !hasGroup(regex, config.Group) {
+			return config, fmt.Errorf("The severity group %s isn't a named group in the pattern", config.Group)
+		}
+	}
+
+	commands := make(map[string]CommandConfig)
+	for level, command := range config.Commands {
+		commands[strings.ToUpper(level)] = command
+	}
+	config.Commands = commands
+	return config, nil
+}
+
+func hasGroup(pattern *regexp.Regexp, group string) bool {
+	for _, name := range pattern.SubexpNames() {
+		if name == group {
+			return true
+		}
+	}
+	return false
+}
+
+// extractSeverity pulls the upper cased level out of a line, or returns an empty string if
+// it doesn't have one
+func extractSeverity(config SeverityConfig, line string, groups map[string]string) string {
+	if config.Group != "" {
+		return strings.ToUpper(groups[config.Group])
+	}
+	if config.Field == "" {
+		return ""
+	}
+
+	value, ok := jsonField(line, config.Field)
+	if !ok {
+		return ""
+	}
+	return strings.ToUpper(fmt.Sprint(value))
+}
+
+// jsonField pulls a field out of a line that's a JSON object. Fields can be nested,
+// "log.level" is the level in {"log": {"level": ..}}. Objects and nulls don't count as values.
+func jsonField(line string, field string) (interface{}, bool) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(line), &value); err != nil {
+		return nil, false
+	}
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	if _, ok := value.(map[string]interface{}); ok || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// matchCommand picks the command to run for a matching line, the one for its severity if
+// there is one and our plain match command otherwise. It also returns the severity.
+func (collector *Collector) matchCommand(line string, groups map[string]string) (CommandConfig, string) {
+	severity := extractSeverity(collector.config.Severity, line, groups)
+	if command, ok := collector.config.Severity.Commands[severity]; ok && severity != "" {
+		return command, severity
+	}
+	return collector.config.Command, severity
+}
+
+// matchCommands lists the commands to run for a matching line: the one for its severity if
+// it has one, otherwise command followed by commands
+func (collector *Collector) matchCommands(line string, groups map[string]string) ([]CommandConfig, string) {
+	command, severity := collector.matchCommand(line, groups)
+	if _, ok := collector.config.Severity.Commands[severity]; ok && severity != "" {
+		return commandList(command, nil), severity
+	}
+	return commandList(command, collector.config.Commands), severity
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSeverity(t *testing.T) {
+	pattern := regexp.MustCompile(`^(?P<level>\w+): `)
+
+	config, err := validateSeverity(SeverityConfig{
+		Group:    "level",
+		Commands: map[string]CommandConfig{"error": {Program: "report"}},
+	}, pattern)
+	assert.Nil(t, err)
+	assert.Equal(t, "report", config.Commands["ERROR"].Program)
+
+	_, err = validateSeverity(SeverityConfig{Group: "severity"}, pattern)
+	assert.NotNil(t, err)
+	_, err = validateSeverity(SeverityConfig{Group: "level"}, substringMatcher("ERROR"))
+	assert.NotNil(t, err)
+	_, err = validateSeverity(SeverityConfig{Group: "level", Field: "level"}, pattern)
+	assert.NotNil(t, err)
+}
+
+func TestExtractSeverity(t *testing.T) {
+	byGroup := SeverityConfig{Group: "level"}
+	assert.Equal(t, "WARN", extractSeverity(byGroup, "", map[string]string{"level": "warn"}))
+
+	byField := SeverityConfig{Field: "log.level"}
+	assert.Equal(t, "ERROR", extractSeverity(byField, `{"log": {"level": "error"}}`, nil))
+	assert.Equal(t, "", extractSeverity(byField, `{"log": "error"}`, nil))
+	assert.Equal(t, "", extractSeverity(byField, `{"log": {}}`, nil))
+	assert.Equal(t, "", extractSeverity(byField, "ERROR: not json", nil))
+
+	assert.Equal(t, "", extractSeverity(SeverityConfig{}, `{"level": "error"}`, nil))
+}
+
+func TestCollectorMatchCommand(t *testing.T) {
+	collector := Collector{
+		config: CollectorConfig{
+			Command: CommandConfig{Program: "log"},
+			Severity: SeverityConfig{
+				Field:    "level",
+				Commands: map[string]CommandConfig{"FATAL": {Program: "page"}},
+			},
+		},
+	}
+
+	command, severity := collector.matchCommand(`{"level": "fatal"}`, nil)
+	assert.Equal(t, "page", command.Program)
+	assert.Equal(t, "FATAL", severity)
+
+	command, severity = collector.matchCommand(`{"level": "warn"}`, nil)
+	assert.Equal(t, "log", command.Program)
+	assert.Equal(t, "WARN", severity)
+
+	command, severity = collector.matchCommand("plain text", nil)
+	assert.Equal(t, "log", command.Program)
+	assert.Equal(t, "", severity)
+}
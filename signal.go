@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Reloading or nudging a daemon usually means sending it a signal, which shouldn't take a
+// shell script reading its pidfile. Instead of a program any command can send a "signal"
+// (HUP by default) to the process whose pid is in a pidfile, or to every process with a
+// given name, found the way process collectors find them (so Linux only). The command fails
+// if there's no process to signal or any of them couldn't be signalled.
+
+// DefaultSignal is the signal sent when none is configured
+const DefaultSignal = "HUP"
+
+// validateSignal checks a command's signal
+func validateSignal(command CommandConfig) error {
+	config := command.Signal
+	if !config.configured() {
+		if config.Name != "" {
+			return errors.New("A signal needs a pidfile or a process to send it to")
+		}
+		return nil
+	}
+	if config.Pidfile != "" && config.Process != "" {
+		return fmt.Errorf("A signal goes to a pidfile or a process but not both, %s has both", command)
+	}
+	if len(command.kinds()) > 1 {
+		return fmt.Errorf("A command sending a signal can't do anything else, %s does", command)
+	}
+	if _, err := config.signal(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// configured reports whether there's a process to send the signal to
+func (config SignalConfig) configured() bool {
+	return config.Pidfile != "" || config.Process != ""
+}
+
+// signalName is the signal's name without any SIG prefix
+func (config SignalConfig) signalName() string {
+	if config.Name == "" {
+		return DefaultSignal
+	}
+	return strings.TrimPrefix(strings.ToUpper(config.Name), "SIG")
+}
+
+// signal looks the signal up by name
+func (config SignalConfig) signal() (os.Signal, error) {
+	signal, ok := signals[config.signalName()]
+	if !ok {
+		return nil, fmt.Errorf("Unknown signal %q", config.Name)
+	}
+	return signal, nil
+}
+
+// String describes the signal for log messages and docs
+func (config SignalConfig) String() string {
+	if config.Pidfile != "" {
+		return fmt.Sprintf("%s to the pid in %s", config.signalName(), config.Pidfile)
+	}
+	return fmt.Sprintf("%s to %s", config.signalName(), config.Process)
+}
+
+// Start sends the signal, returning a function that reports whether it could be
+func (config SignalConfig) Start() (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not sending signal %s", config)
+		return nil, ErrExecDisabled
+	}
+	signal, err := config.signal()
+	if err != nil {
+		return nil, err
+	}
+
+	logp.Info("Sending signal %s", config)
+	return func() error {
+		pids, err := config.pids()
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			return fmt.Errorf("There's no %s process to signal", config.Process)
+		}
+		var failed []string
+		for _, pid := range pids {
+			if err := signalPid(pid, signal); err != nil {
+				failed = append(failed, fmt.Sprintf("%d: %s", pid, err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("Unable to signal %s", strings.Join(failed, ", "))
+		}
+		return nil
+	}, nil
+}
+
+// pids are the processes the signal goes to
+func (config SignalConfig) pids() ([]int, error) {
+	if config.Pidfile != "" {
+		contents, err := ioutil.ReadFile(config.Pidfile)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("%s doesn't hold a pid", config.Pidfile)
+		}
+		return []int{pid}, nil
+	}
+	return sortedPids(findProcesses(config.Process)), nil
+}
+
+// signalPid sends a signal to a process
+func signalPid(pid int, signal os.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(signal)
+}
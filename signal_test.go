@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSignal(t *testing.T) {
+	assert.Nil(t, validateSignal(CommandConfig{Program: "touch"}))
+	assert.Nil(t, validateSignal(CommandConfig{Signal: SignalConfig{Pidfile: "/run/nginx.pid"}}))
+	assert.Nil(t, validateSignal(CommandConfig{Signal: SignalConfig{Name: "sigusr1", Process: "nginx"}}))
+
+	assert.NotNil(t, validateSignal(CommandConfig{Signal: SignalConfig{Name: "HUP"}}))
+	assert.NotNil(t, validateSignal(CommandConfig{Signal: SignalConfig{Pidfile: "/run/nginx.pid", Process: "nginx"}}))
+	assert.NotNil(t, validateSignal(CommandConfig{Signal: SignalConfig{Name: "PWR", Process: "nginx"}}))
+	assert.NotNil(t, validateSignal(CommandConfig{Program: "touch", Signal: SignalConfig{Process: "nginx"}}))
+}
+
+func TestSignalCommand(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command("sleep", "5")
+	assert.Nil(t, cmd.Start())
+	pidfile := filepath.Join(tmpDir, "sleep.pid")
+	assert.Nil(t, ioutil.WriteFile(pidfile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644))
+
+	command := CommandConfig{Signal: SignalConfig{Name: "TERM", Pidfile: pidfile}}
+	assert.True(t, command.configured())
+	assert.Equal(t, "signal TERM to the pid in "+pidfile, command.String())
+
+	wait, err := command.Signal.Start()
+	assert.Nil(t, err)
+	assert.Nil(t, wait())
+	assert.NotNil(t, cmd.Wait())
+
+	// Nothing to signal is a failure
+	wait, err = CommandConfig{Signal: SignalConfig{Pidfile: filepath.Join(tmpDir, "missing.pid")}}.Signal.Start()
+	assert.Nil(t, err)
+	assert.NotNil(t, wait())
+}
@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// signals are the signals a command can send, by name. Windows can only kill a process.
+var signals = map[string]os.Signal{
+	"KILL": os.Kill,
+}
+
+// setProcessGroup does nothing on Windows, which has no process groups to kill
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killCommand kills a started command, but not what it started, on Windows
+func killCommand(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
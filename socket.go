@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// UnixSocketType is the collector type for reading lines from a Unix domain socket
+const UnixSocketType = "unix"
+
+// SocketInput listens on a Unix domain socket and forwards every newline delimited
+// line written by its clients to a Collector. It lets local daemons report pulses
+// directly without going through a log file.
+type SocketInput struct {
+	config   SocketConfig
+	listener net.Listener
+	// Where the socket is until Start moves it onto its path, empty once it has
+	pending string
+
+	// Where we send the lines we read, shared with the Collector
+	lines chan string
+
+	// Closed when Stop is called to tell our goroutines to finish up
+	done chan struct{}
+	// Tracks the accept loop and every open connection
+	wg sync.WaitGroup
+
+	// Open connections, so that we can close them on Stop
+	connsMutex sync.Mutex
+	conns      map[net.Conn]struct{}
+}
+
+// NewSocketInput creates the socket described by config. The socket is created straight
+// away, rather than on Start, so that problems like a bad path show up on startup.
+//
+// It's created next to the path and only moved onto it on Start. That way a collector
+// replacing one of ours in a reload can be created while the old one is still listening,
+// and if creating it fails the old one carries on undisturbed. Anything else already at the
+// path, a socket someone is listening on or a file that isn't a socket, is left alone and
+// the path refused.
+func NewSocketInput(config SocketConfig, lines chan string) (*SocketInput, error) {
+	if config.Path == "" {
+		return nil, errors.New("A socket path is required for unix collectors")
+	}
+	if !ownSocket(config.Path) {
+		if _, err := checkSocketPath(config.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	pending := reservePending(config.Path)
+	if stale, err := checkSocketPath(pending); err != nil {
+		releasePending(pending)
+		return nil, err
+	} else if stale {
+		os.Remove(pending)
+	}
+	listener, err := net.Listen("unix", pending)
+	if err != nil {
+		releasePending(pending)
+		return nil, err
+	}
+	// Which of us removes the socket depends on who owns the path by then, see Stop
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if config.Mode != 0 {
+		if err := os.Chmod(pending, config.Mode); err != nil {
+			listener.Close()
+			os.Remove(pending)
+			releasePending(pending)
+			return nil, err
+		}
+	}
+
+	return &SocketInput{
+		config:   config,
+		listener: listener,
+		pending:  pending,
+		lines:    lines,
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// checkSocketPath makes sure nobody else is using path for a socket, reporting whether
+// there's a stale socket there left behind by a run that didn't shut down cleanly
+func checkSocketPath(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return false, fmt.Errorf("%s already exists and isn't a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return false, fmt.Errorf("The socket %s is already in use", path)
+	}
+	return true, nil
+}
+
+// The sockets our SocketInputs are listening on by path, so that a reload's replacement
+// can take over from the old one, and the paths next to them that SocketInputs not yet
+// started are listening on
+var (
+	socketOwners      = make(map[string]*SocketInput)
+	pendingSockets    = make(map[string]bool)
+	socketOwnersMutex sync.Mutex
+)
+
+// reservePending picks where a SocketInput for path listens until it's started. That's
+// path.new unless another of ours not yet started is already there, like one still waiting
+// on its dependencies that a reload is replacing.
+func reservePending(path string) string {
+	socketOwnersMutex.Lock()
+	defer socketOwnersMutex.Unlock()
+	pending := path + ".new"
+	for i := 1; pendingSockets[pending]; i++ {
+		pending = fmt.Sprintf("%s.new.%d", path, i)
+	}
+	pendingSockets[pending] = true
+	return pending
+}
+
+// releasePending gives up a path reserved by reservePending
+func releasePending(pending string) {
+	socketOwnersMutex.Lock()
+	defer socketOwnersMutex.Unlock()
+	delete(pendingSockets, pending)
+}
+
+// ownSocket reports whether one of our own SocketInputs is listening on path
+func ownSocket(path string) bool {
+	socketOwnersMutex.Lock()
+	defer socketOwnersMutex.Unlock()
+	return socketOwners[filepath.Clean(path)] != nil
+}
+
+// Start moves the socket onto its path, taking over from whichever of our SocketInputs had
+// it, and begins accepting connections in the background
+func (input *SocketInput) Start() {
+	socketOwnersMutex.Lock()
+	if err := os.Rename(input.pending, input.config.Path); err != nil {
+		logp.Err("Unable to move the socket %s into place, listening on %s instead: %s", input.config.Path, input.pending, err)
+	} else {
+		socketOwners[filepath.Clean(input.config.Path)] = input
+		delete(pendingSockets, input.pending)
+		input.pending = ""
+	}
+	socketOwnersMutex.Unlock()
+
+	logp.Info("Listening on unix socket %s", input.config.Path)
+
+	input.wg.Add(1)
+	go input.accept()
+}
+
+// Stop closes the socket and every open connection and waits for them to finish. The socket
+// file is removed unless another SocketInput has taken the path over in the meantime.
+func (input *SocketInput) Stop() {
+	close(input.done)
+	input.Release()
+
+	input.connsMutex.Lock()
+	for conn := range input.conns {
+		conn.Close()
+	}
+	input.connsMutex.Unlock()
+
+	input.wg.Wait()
+}
+
+// Release closes the socket, for a SocketInput that may never have been started
+func (input *SocketInput) Release() {
+	input.listener.Close()
+
+	socketOwnersMutex.Lock()
+	defer socketOwnersMutex.Unlock()
+	if input.pending != "" {
+		os.Remove(input.pending)
+		delete(pendingSockets, input.pending)
+	}
+	path := filepath.Clean(input.config.Path)
+	if socketOwners[path] == input {
+		delete(socketOwners, path)
+		os.Remove(path)
+	}
+}
+
+// accept hands every new connection off to its own goroutine until the listener is closed
+func (input *SocketInput) accept() {
+	defer input.wg.Done()
+
+	for {
+		conn, err := input.listener.Accept()
+		if err != nil {
+			select {
+			case <-input.done:
+				// We're shutting down, so this is expected
+			default:
+				logp.Err("Unable to accept connection on %s: %s", input.config.Path, err)
+			}
+			return
+		}
+
+		// Stop closes the connections it finds under the mutex, so one accepted after it
+		// started stopping has to be closed here or it would be read from forever
+		input.connsMutex.Lock()
+		select {
+		case <-input.done:
+			input.connsMutex.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		input.conns[conn] = struct{}{}
+		input.wg.Add(1)
+		input.connsMutex.Unlock()
+
+		go input.read(conn)
+	}
+}
+
+// read forwards each line from the connection until the client hangs up or we're stopped
+func (input *SocketInput) read(conn net.Conn) {
+	defer input.wg.Done()
+	defer func() {
+		input.connsMutex.Lock()
+		delete(input.conns, conn)
+		input.connsMutex.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		select {
+		case input.lines <- scanner.Text():
+		case <-input.done:
+			return
+		}
+	}
+}
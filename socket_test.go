@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketInput(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	socketPath := filepath.Join(tmpDir, "pulse.sock")
+	lines := make(chan string, 2)
+
+	input, err := NewSocketInput(SocketConfig{Path: socketPath, Mode: 0600}, lines)
+	assert.Nil(t, err)
+	input.Start()
+
+	info := assertFileExists(t, socketPath)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Lines written by a client should come through one by one
+	conn, err := net.Dial("unix", socketPath)
+	assert.Nil(t, err)
+	conn.Write([]byte("Hello\nWorld\n"))
+	time.Sleep(10 * time.Millisecond)
+	assertChanMsg(t, lines, "Hello")
+	assertChanMsg(t, lines, "World")
+
+	// Stopping should hang up on the client and clean up the socket
+	input.Stop()
+	assertFileDoesNotExist(t, socketPath)
+	conn.Close()
+}
+
+func TestSocketInputRequiresPath(t *testing.T) {
+	_, err := NewSocketInput(SocketConfig{}, make(chan string))
+	assert.NotNil(t, err)
+}
+
+func TestSocketInputPathInUse(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+	lines := make(chan string)
+
+	// Something else listening on the path keeps it
+	socketPath := filepath.Join(tmpDir, "pulse.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	_, err = NewSocketInput(SocketConfig{Path: socketPath}, lines)
+	assert.NotNil(t, err)
+	conn, err := net.Dial("unix", socketPath)
+	assert.Nil(t, err)
+	conn.Close()
+
+	// Once it's gone its socket is fair game
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	input, err := NewSocketInput(SocketConfig{Path: socketPath}, lines)
+	assert.Nil(t, err)
+	input.Start()
+	conn, err = net.Dial("unix", socketPath)
+	assert.Nil(t, err)
+	conn.Close()
+
+	// As is one of our own, which is handed over on Start
+	replacement, err := NewSocketInput(SocketConfig{Path: socketPath}, lines)
+	assert.Nil(t, err)
+	replacement.Start()
+	input.Stop()
+	assertFileExists(t, socketPath)
+	replacement.Stop()
+	assertFileDoesNotExist(t, socketPath)
+
+	// One that's never started cleans up after itself
+	unstarted, err := NewSocketInput(SocketConfig{Path: socketPath}, lines)
+	assert.Nil(t, err)
+	unstarted.Release()
+	files, _ := ioutil.ReadDir(tmpDir)
+	assert.Empty(t, files)
+
+	// And anything that isn't a socket is left alone
+	filePath := filepath.Join(tmpDir, "pulse.log")
+	ioutil.WriteFile(filePath, []byte("keep me"), 0644)
+	_, err = NewSocketInput(SocketConfig{Path: filePath}, lines)
+	assert.NotNil(t, err)
+	assertFileExists(t, filePath)
+}
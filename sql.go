@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+
+	// The database drivers SQL collectors can use
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+// SQLType is the collector type for polling a database with a query
+const SQLType = "sql"
+
+// DefaultSQLInterval is how often the query is run if no interval is configured
+const DefaultSQLInterval = 30 * time.Second
+
+// SQLInput runs a query every interval and sends each row of the results to the collector
+// as a line of space separated column=value pairs, with values quoted if they need to be:
+//
+//	max=2017-09-01T12:00:00Z
+//	job="nightly backup" finished=true
+//
+// Only rows that weren't in the previous results are sent. That way a heartbeat table
+// ("SELECT max(updated_at) FROM jobs") is silent while nothing's updating it, just like a
+// log file, and a timeout catches it.
+type SQLInput struct {
+	config SQLConfig
+	db     *sql.DB
+
+	// Where we send our lines, shared with the Collector
+	lines chan string
+
+	// Closed when Stop is called to tell our goroutine to finish up
+	done chan struct{}
+	// Closed when our goroutine has finished
+	finished chan struct{}
+}
+
+// NewSQLInput sets up the database connection described by config. Connecting is left
+// until the query first runs so that a database that's down doesn't stop us from starting.
+func NewSQLInput(config SQLConfig, lines chan string) (*SQLInput, error) {
+	if config.Driver == "" || config.DSN == "" || config.Query == "" {
+		return nil, errors.New("A driver, dsn and query are required for sql collectors")
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = DefaultSQLInterval
+	}
+
+	db, err := sql.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLInput{
+		config:   config,
+		db:       db,
+		lines:    lines,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}, nil
+}
+
+// Start begins running the query in the background
+func (input *SQLInput) Start() {
+	logp.Info("Running query %q every %s", input.config.Query, input.config.Interval)
+	go input.run()
+}
+
+// Stop stops running the query and closes the database connection
+func (input *SQLInput) Stop() {
+	close(input.done)
+	<-input.finished
+	input.db.Close()
+}
+
+// Release closes the database handle, for a SQLInput that will never be started
+func (input *SQLInput) Release() {
+	input.db.Close()
+}
+
+func (input *SQLInput) run() {
+	defer close(input.finished)
+
+	ticker := time.NewTicker(input.config.Interval)
+	defer ticker.Stop()
+
+	previous := make(map[string]bool)
+	for {
+		rows, err := input.query()
+		if err != nil {
+			// Nothing gets sent, so a timeout will notice if this keeps up
+			logp.Err("Unable to run query %q: %s", input.config.Query, err)
+		} else {
+			current := make(map[string]bool)
+			for _, row := range rows {
+				current[row] = true
+				if previous[row] {
+					continue
+				}
+
+				select {
+				case input.lines <- row:
+				case <-input.done:
+					return
+				}
+			}
+			previous = current
+		}
+
+		select {
+		case <-ticker.C:
+		case <-input.done:
+			return
+		}
+	}
+}
+
+// query runs our query and formats every row of the results
+func (input *SQLInput) query() ([]string, error) {
+	rows, err := input.db.Query(input.config.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		lines = append(lines, formatRow(columns, values))
+	}
+	return lines, rows.Err()
+}
+
+// formatRow turns a row into column=value pairs. NULLs are left empty.
+func formatRow(columns []string, values []sql.NullString) string {
+	pairs := make([]string, len(columns))
+	for i, column := range columns {
+		value := values[i].String
+		if value == "" && values[i].Valid || strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		pairs[i] = column + "=" + value
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver answers every query with whatever fakeResults holds
+type fakeDriver struct{}
+
+var (
+	fakeResultsMutex sync.Mutex
+	fakeResults      [][]driver.Value
+)
+
+func setFakeResults(results ...[]driver.Value) {
+	fakeResultsMutex.Lock()
+	defer fakeResultsMutex.Unlock()
+	fakeResults = results
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("No transactions") }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                                    { return nil }
+func (fakeStmt) NumInput() int                                   { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, errors.New("No exec") }
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fakeResultsMutex.Lock()
+	defer fakeResultsMutex.Unlock()
+	return &fakeRows{results: fakeResults}, nil
+}
+
+type fakeRows struct {
+	results [][]driver.Value
+}
+
+func (rows *fakeRows) Columns() []string { return []string{"job", "finished"} }
+func (rows *fakeRows) Close() error      { return nil }
+func (rows *fakeRows) Next(dest []driver.Value) error {
+	if len(rows.results) == 0 {
+		return io.EOF
+	}
+	copy(dest, rows.results[0])
+	rows.results = rows.results[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func TestFormatRow(t *testing.T) {
+	assert.Equal(t, `job="nightly backup" finished= empty="" count=3`, formatRow(
+		[]string{"job", "finished", "empty", "count"},
+		[]sql.NullString{
+			{String: "nightly backup", Valid: true},
+			{},
+			{String: "", Valid: true},
+			{String: "3", Valid: true},
+		},
+	))
+}
+
+func TestSQLInput(t *testing.T) {
+	_, err := NewSQLInput(SQLConfig{Driver: "fake", DSN: "test"}, nil)
+	assert.NotNil(t, err)
+
+	setFakeResults([]driver.Value{"backup", "monday"})
+
+	lines := make(chan string)
+	input, err := NewSQLInput(SQLConfig{
+		Driver:   "fake",
+		DSN:      "test",
+		Query:    "SELECT job, max(finished) FROM jobs GROUP BY job",
+		Interval: 10 * time.Millisecond,
+	}, lines)
+	assert.Nil(t, err)
+
+	input.Start()
+	assert.Equal(t, "job=backup finished=monday", <-lines)
+
+	// Rows we've already seen aren't sent again
+	setFakeResults([]driver.Value{"backup", "monday"}, []driver.Value{"vacuum", "monday"})
+	assert.Equal(t, "job=vacuum finished=monday", <-lines)
+	setFakeResults([]driver.Value{"backup", "tuesday"}, []driver.Value{"vacuum", "monday"})
+	assert.Equal(t, "job=backup finished=tuesday", <-lines)
+
+	input.Stop()
+}
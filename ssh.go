@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// SSHType is the collector type for tailing files on a remote host over SSH
+const SSHType = "ssh"
+
+// SSHInput tails files on a remote host by running "tail -F" through the system's ssh client.
+// We lean on the ssh client rather than a Go SSH library so that the user's existing
+// known_hosts, agent and ssh_config all keep working. Whenever the connection drops it is
+// re-established with an exponential backoff.
+type SSHInput struct {
+	config SSHConfig
+	paths  []string
+
+	// Where we send the lines we read, shared with the Collector
+	lines chan string
+
+	// Closed when Stop is called to tell our goroutine to finish up
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// The ssh process that's currently running, so that Stop can kill it
+	cmdMutex sync.Mutex
+	cmd      *exec.Cmd
+}
+
+// NewSSHInput validates the configuration and fills in its defaults. Nothing is run until
+// Start is called.
+func NewSSHInput(config SSHConfig, paths []string, lines chan string) (*SSHInput, error) {
+	if config.Host == "" {
+		return nil, errors.New("A host is required for ssh collectors")
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("At least one path is required for ssh collectors")
+	}
+
+	if config.Program == "" {
+		config.Program = "ssh"
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 1 * time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 1 * time.Minute
+	}
+	if config.MaxBackoff < config.Backoff {
+		config.MaxBackoff = config.Backoff
+	}
+
+	return &SSHInput{
+		config: config,
+		paths:  paths,
+		lines:  lines,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Start connects to the remote host in the background
+func (input *SSHInput) Start() {
+	logp.Info("Tailing %s on %s over ssh", input.paths, input.config.Host)
+
+	input.wg.Add(1)
+	go input.run()
+}
+
+// Stop kills the ssh client and waits for it to exit
+func (input *SSHInput) Stop() {
+	input.cmdMutex.Lock()
+	close(input.done)
+	if input.cmd != nil {
+		input.cmd.Process.Kill()
+	}
+	input.cmdMutex.Unlock()
+
+	input.wg.Wait()
+}
+
+// run keeps the ssh client running until we're stopped, backing off between reconnects.
+// The backoff is reset whenever a connection actually delivered some lines.
+func (input *SSHInput) run() {
+	defer input.wg.Done()
+
+	backoff := input.config.Backoff
+	for {
+		if input.tail() {
+			backoff = input.config.Backoff
+		}
+
+		select {
+		case <-input.done:
+			return
+		default:
+		}
+
+		logp.Warn("Lost connection to %s, reconnecting in %s", input.config.Host, backoff)
+		select {
+		case <-input.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > input.config.MaxBackoff {
+			backoff = input.config.MaxBackoff
+		}
+	}
+}
+
+// tail runs the ssh client once and forwards its output until it exits. It returns whether
+// any lines were read, meaning the connection was actually working.
+func (input *SSHInput) tail() bool {
+	cmd := exec.Command(input.config.Program, input.args()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logp.Err("Unable to run %s: %s", input.config.Program, err)
+		return false
+	}
+	// ssh tells us why it couldn't connect on stderr, hold on to it for the log
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// Make sure we don't start a new process after Stop has already looked for one to kill
+	input.cmdMutex.Lock()
+	select {
+	case <-input.done:
+		input.cmdMutex.Unlock()
+		return false
+	default:
+	}
+	if err := cmd.Start(); err != nil {
+		input.cmdMutex.Unlock()
+		logp.Err("Unable to run %s: %s", input.config.Program, err)
+		return false
+	}
+	input.cmd = cmd
+	input.cmdMutex.Unlock()
+
+	gotLines := false
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		gotLines = true
+		select {
+		case input.lines <- scanner.Text():
+		case <-input.done:
+			// Stop has killed the process, so the scanner will run dry shortly
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		logp.Warn("ssh to %s exited: %s %s", input.config.Host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	input.cmdMutex.Lock()
+	input.cmd = nil
+	input.cmdMutex.Unlock()
+
+	return gotLines
+}
+
+// args builds the ssh client's command line. BatchMode makes sure ssh fails instead of
+// prompting for a password and the keep alives make sure a dead connection is noticed.
+func (input *SSHInput) args() []string {
+	args := []string{
+		"-T",
+		"-o", "BatchMode=yes",
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=3",
+	}
+	if input.config.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(input.config.Port))
+	}
+	if input.config.IdentityFile != "" {
+		args = append(args, "-i", input.config.IdentityFile)
+	}
+	for _, option := range input.config.Options {
+		args = append(args, "-o", option)
+	}
+
+	destination := input.config.Host
+	if input.config.User != "" {
+		destination = input.config.User + "@" + destination
+	}
+
+	// The remote command is run through the remote user's shell, so quote the paths.
+	// Only new lines are of interest, just like the tail_files default for local files.
+	remote := []string{"tail", "-q", "-F", "-n", "0"}
+	for _, path := range input.paths {
+		remote = append(remote, shellQuote(path))
+	}
+
+	return append(args, destination, strings.Join(remote, " "))
+}
+
+// shellQuote wraps a string in single quotes so a POSIX shell treats it literally
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSHInputArgs(t *testing.T) {
+	input, err := NewSSHInput(SSHConfig{
+		Host:         "appliance",
+		Port:         2222,
+		User:         "monitor",
+		IdentityFile: "/etc/log-pulse/id_ed25519",
+		Options:      []string{"StrictHostKeyChecking=yes"},
+	}, []string{"/var/log/app.log", "/var/log/it's.log"}, make(chan string))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"-T",
+		"-o", "BatchMode=yes",
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=3",
+		"-p", "2222",
+		"-i", "/etc/log-pulse/id_ed25519",
+		"-o", "StrictHostKeyChecking=yes",
+		"monitor@appliance",
+		`tail -q -F -n 0 '/var/log/app.log' '/var/log/it'\''s.log'`,
+	}, input.args())
+
+	// Defaults
+	assert.Equal(t, "ssh", input.config.Program)
+	assert.Equal(t, 1*time.Second, input.config.Backoff)
+	assert.Equal(t, 1*time.Minute, input.config.MaxBackoff)
+}
+
+func TestSSHInputRequiresHostAndPaths(t *testing.T) {
+	_, err := NewSSHInput(SSHConfig{}, []string{"/var/log/app.log"}, make(chan string))
+	assert.NotNil(t, err)
+
+	_, err = NewSSHInput(SSHConfig{Host: "appliance"}, nil, make(chan string))
+	assert.NotNil(t, err)
+}
+
+func TestSSHInputReconnects(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	// Stand in for ssh with a script that prints a line and then "disconnects"
+	fakeSSH := filepath.Join(tmpDir, "fake-ssh")
+	ioutil.WriteFile(fakeSSH, []byte("#!/bin/sh\necho Hello\n"), 0755)
+
+	lines := make(chan string)
+	input, err := NewSSHInput(SSHConfig{
+		Host:    "appliance",
+		Program: fakeSSH,
+		Backoff: 10 * time.Millisecond,
+	}, []string{"/var/log/app.log"}, lines)
+	assert.Nil(t, err)
+
+	input.Start()
+
+	// Every reconnect should deliver another line
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-lines:
+			assert.Equal(t, "Hello", msg)
+		case <-time.After(1 * time.Second):
+			t.Fatal("Expected the input to reconnect")
+		}
+	}
+
+	input.Stop()
+}
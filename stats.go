@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// statsSaveInterval is how often the Collection writes its StatsFile while running
+const statsSaveInterval = time.Minute
+
+// Heatmap counts a collector's matches by day of the week and hour of the day, in local
+// time. Looking at when a pattern is actually seen is the easiest way of picking a sensible
+// timeout, or spotting that a job which is "always" running is quiet every Sunday night.
+type Heatmap [7][24]int
+
+func (heatmap *Heatmap) record(t time.Time) {
+	heatmap[t.Weekday()][t.Hour()]++
+}
+
+// Total is the number of matches across the whole week
+func (heatmap *Heatmap) Total() int {
+	total := 0
+	for _, hours := range heatmap {
+		for _, count := range hours {
+			total += count
+		}
+	}
+	return total
+}
+
+// The actions a collector runs commands for, which their durations are recorded under
+const (
+	MatchAction    = "match"
+	TimeoutAction  = "timeout"
+	RateAction     = "rate"
+	SequenceAction = "sequence"
+	ReportAction   = "report"
+	AnomalyAction  = "anomaly"
+	BatchAction    = "batch"
+	RecoveryAction = "recovery"
+)
+
+// CollectorStats is everything we keep count of for a collector
+type CollectorStats struct {
+	Heatmap Heatmap `json:"heatmap"`
+	// How long the commands run for each action took, from starting them to them exiting
+	Commands map[string]DurationHistogram `json:"commands,omitempty"`
+	// When the match command last ran, kept here so that suppress_for holds across restarts
+	LastCommand time.Time `json:"last_command"`
+	// When each of our commands with a cooldown last ran by action and command, kept here so
+	// that cooldowns hold across restarts and reloads. See cooldown.go.
+	LastRuns map[string]time.Time `json:"last_runs,omitempty"`
+	// When the pattern last matched
+	LastMatch time.Time `json:"last_match"`
+	// The collector's labels, so that whatever reads the stats can tell collectors apart by
+	// team, service and so on. They're always the ones in its config, not what was saved.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Whether the collector has been started yet (CollectorStarted) or is still waiting
+	// (CollectorWaiting), and the dependencies it's waiting on to become healthy. Like the
+	// labels they're always worked out afresh.
+	State     string   `json:"state,omitempty"`
+	WaitingOn []string `json:"waiting_on,omitempty"`
+}
+
+// commandDuration is how long a command run for an action took
+type commandDuration struct {
+	action   string
+	duration time.Duration
+	failed   bool
+	// Runs the command's fallback, if it failed and has one
+	fallback func()
+}
+
+func (stats *CollectorStats) recordCommand(action string, duration time.Duration, failed bool) {
+	if stats.Commands == nil {
+		stats.Commands = make(map[string]DurationHistogram)
+	}
+	histogram := stats.Commands[action]
+	histogram.record(duration)
+	if failed {
+		histogram.Failures++
+	}
+	stats.Commands[action] = histogram
+}
+
+// copy returns stats that don't share anything with the original
+func (stats CollectorStats) copy() CollectorStats {
+	commands := make(map[string]DurationHistogram)
+	for action, histogram := range stats.Commands {
+		histogram.Buckets = append([]int(nil), histogram.Buckets...)
+		commands[action] = histogram
+	}
+	stats.Commands = commands
+	if stats.LastRuns != nil {
+		lastRuns := make(map[string]time.Time)
+		for key, last := range stats.LastRuns {
+			lastRuns[key] = last
+		}
+		stats.LastRuns = lastRuns
+	}
+	return stats
+}
+
+// statsCopy returns a copy of our stats along with our labels. It's only for our process
+// goroutine, or while it isn't running.
+func (collector *Collector) statsCopy() CollectorStats {
+	stats := collector.stats.copy()
+	stats.Labels = nil
+	if len(collector.config.Labels) > 0 {
+		stats.Labels = make(map[string]string)
+		for key, value := range collector.config.Labels {
+			stats.Labels[key] = value
+		}
+	}
+	return stats
+}
+
+// Stats returns a copy of the collector's stats. They belong to our process goroutine so
+// while it's running we have to ask it.
+func (collector *Collector) Stats() CollectorStats {
+	reply := make(chan CollectorStats, 1)
+	select {
+	case collector.statsRequests <- reply:
+		return <-reply
+	case <-collector.Stopped:
+		return collector.statsCopy()
+	}
+}
+
+// Stats returns the stats of all of our collectors by name
+func (collection *Collection) Stats() map[string]CollectorStats {
+	collection.mutex.Lock()
+	defer collection.mutex.Unlock()
+	return collection.stats()
+}
+
+// stats is Stats for when the mutex is already held
+func (collection *Collection) stats() map[string]CollectorStats {
+	stats := make(map[string]CollectorStats)
+	for _, c := range collection.collectors {
+		var collectorStats CollectorStats
+		if collection.started[c] {
+			collectorStats = c.Stats()
+		} else {
+			// Nothing's touching them yet
+			collectorStats = c.statsCopy()
+		}
+		collectorStats.State, collectorStats.WaitingOn = collection.dependencyState(c)
+		stats[c.config.Name] = collectorStats
+	}
+	return stats
+}
+
+// LoadStats picks up the counts saved to a StatsFile by an earlier run so that they keep
+// adding up across restarts. It has to be called before Start. A missing file is fine.
+func (collection *Collection) LoadStats(path string) error {
+	stats, err := ReadStatsFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, c := range collection.collectors {
+		c.stats = stats[c.config.Name]
+	}
+	return nil
+}
+
+// saveStatsPeriodically writes our StatsFile every statsSaveInterval, and whenever a
+// collector asks for it, until we're stopped
+func (collection *Collection) saveStatsPeriodically() {
+	ticker := time.NewTicker(statsSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-collection.statsChanged:
+		case <-collection.done:
+			return
+		}
+
+		collection.mutex.Lock()
+		// Stop saves them one last time itself
+		if !collection.stopping {
+			collection.saveStats()
+		}
+		collection.mutex.Unlock()
+	}
+}
+
+// saveStats writes our StatsFile, the mutex has to be held
+func (collection *Collection) saveStats() {
+	if err := WriteStatsFile(collection.StatsFile, collection.stats()); err != nil {
+		logp.Err("Unable to save stats to %s: %s", collection.StatsFile, err)
+	}
+}
+
+// ReadStatsFile reads stats saved with WriteStatsFile
+func ReadStatsFile(path string) (map[string]CollectorStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]CollectorStats)
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("Unable to read stats from %s: %s", path, err)
+	}
+	return stats, nil
+}
+
+// WriteStatsFile saves stats as JSON. The file is replaced in one go so that it's never
+// left half written.
+func WriteStatsFile(path string, stats map[string]CollectorStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// PrintStats writes every collector's heatmap out as a table with a row per day and a column
+// per hour, followed by how long its commands took
+func PrintStats(w io.Writer, stats map[string]CollectorStats) error {
+	var names []string
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight)
+	for i, name := range names {
+		heatmap := stats[name].Heatmap
+		if i > 0 {
+			fmt.Fprintln(table)
+		}
+		if waitingOn := stats[name].WaitingOn; len(waitingOn) > 0 {
+			fmt.Fprintf(table, "%s (%d matches, waiting on %s)\t\n", name, heatmap.Total(), strings.Join(waitingOn, ", "))
+		} else {
+			fmt.Fprintf(table, "%s (%d matches)\t\n", name, heatmap.Total())
+		}
+
+		fmt.Fprint(table, "\t")
+		for hour := 0; hour < 24; hour++ {
+			fmt.Fprintf(table, "%02d\t", hour)
+		}
+		fmt.Fprintln(table)
+
+		for day, hours := range heatmap {
+			fmt.Fprintf(table, "%s\t", time.Weekday(day).String()[:3])
+			for _, count := range hours {
+				fmt.Fprintf(table, "%d\t", count)
+			}
+			fmt.Fprintln(table)
+		}
+
+		// Flush so the durations, which aren't part of the table, don't throw the columns off
+		if err := table.Flush(); err != nil {
+			return err
+		}
+		for _, action := range sortedActions(stats[name].Commands) {
+			fmt.Fprintf(w, "%s commands: %s\n", action, stats[name].Commands[action])
+		}
+	}
+	return table.Flush()
+}
+
+func sortedActions(commands map[string]DurationHistogram) []string {
+	var actions []string
+	for action := range commands {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeatmap(t *testing.T) {
+	var heatmap Heatmap
+	// A Sunday afternoon
+	sunday := time.Date(2017, 9, 3, 15, 30, 0, 0, time.Local)
+	heatmap.record(sunday)
+	heatmap.record(sunday.Add(10 * time.Minute))
+	heatmap.record(sunday.Add(24 * time.Hour))
+
+	assert.Equal(t, 2, heatmap[time.Sunday][15])
+	assert.Equal(t, 1, heatmap[time.Monday][15])
+	assert.Equal(t, 3, heatmap.Total())
+}
+
+func TestStatsFile(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "stats.json")
+
+	var nginx CollectorStats
+	nginx.Heatmap[time.Tuesday][3] = 7
+	nginx.recordCommand(MatchAction, 20*time.Millisecond, false)
+	assert.Nil(t, WriteStatsFile(path, map[string]CollectorStats{"nginx": nginx}))
+
+	stats, err := ReadStatsFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, nginx, stats["nginx"])
+
+	var output bytes.Buffer
+	assert.Nil(t, PrintStats(&output, stats))
+	assert.Contains(t, output.String(), "nginx (7 matches)")
+	assert.Contains(t, output.String(), "Tue")
+	assert.Contains(t, output.String(), "match commands: 1 runs, mean 20ms, <=50ms: 1")
+	assert.Equal(t, 10, len(strings.Split(strings.TrimSpace(output.String()), "\n")))
+}
+
+func TestCollectorStats(t *testing.T) {
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+		statsRequests:  make(chan chan CollectorStats),
+
+		config: CollectorConfig{Labels: map[string]string{"team": "web"}},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	collector.lines <- "NotAMatch"
+	collector.lines <- "Match again"
+	stats := collector.Stats()
+	assert.Equal(t, 2, stats.Heatmap.Total())
+	assert.Equal(t, map[string]string{"team": "web"}, stats.Labels)
+
+	// Still answers once stopped
+	close(collector.Done)
+	<-collector.Stopped
+	stats = collector.Stats()
+	assert.Equal(t, 2, stats.Heatmap.Total())
+}
+
+func TestCollectionDependencyStats(t *testing.T) {
+	named := func(name string, dependsOn ...string) *Collector {
+		return &Collector{
+			Healthy: make(chan struct{}),
+			config:  CollectorConfig{Name: name, DependsOn: dependsOn},
+		}
+	}
+	a, b, c := named("a"), named("b"), named("c", "a", "b")
+	collection := &Collection{collectors: []*Collector{a, b, c}, started: make(map[*Collector]bool)}
+
+	stats := collection.stats()
+	assert.Equal(t, CollectorWaiting, stats["c"].State)
+	assert.Equal(t, []string{"a", "b"}, stats["c"].WaitingOn)
+	assert.Nil(t, stats["a"].WaitingOn)
+
+	// Only the dependencies that aren't healthy yet are still waited on
+	close(a.Healthy)
+	stats = collection.stats()
+	assert.Equal(t, []string{"b"}, stats["c"].WaitingOn)
+
+	var table bytes.Buffer
+	assert.Nil(t, PrintStats(&table, stats))
+	assert.Contains(t, table.String(), "c (0 matches, waiting on b)")
+
+	close(b.Healthy)
+	collection.started[c] = true
+	state, waitingOn := collection.dependencyState(c)
+	assert.Equal(t, CollectorStarted, state)
+	assert.Nil(t, waitingOn)
+
+	// Control requests say what a collector is still waiting on
+	collection.started[c] = false
+	b.Healthy = make(chan struct{})
+	err := collection.Control("c", ControlReset)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "waiting on b")
+}
+
+func TestCollectorCommandDurations(t *testing.T) {
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   make(chan time.Time),
+		statsRequests:    make(chan chan CollectorStats),
+		finishedCommands: make(chan commandDuration),
+
+		config: CollectorConfig{
+			Command: CommandConfig{Program: "sleep", Args: []string{"0.1"}},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+	collector.lines <- "Match"
+	time.Sleep(300 * time.Millisecond)
+
+	histogram := collector.Stats().Commands[MatchAction]
+	assert.Equal(t, 1, histogram.Count)
+	assert.True(t, histogram.Sum >= 100*time.Millisecond)
+	assert.Equal(t, 1, histogram.Buckets[3])
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestCollectorSuppressionSaved(t *testing.T) {
+	statsChanged := make(chan struct{}, 1)
+	collector := Collector{
+		lines:          make(chan string),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+		statsRequests:  make(chan chan CollectorStats),
+		statsChanged:   statsChanged,
+
+		config: CollectorConfig{
+			Command:     CommandConfig{Program: "true"},
+			SuppressFor: time.Hour,
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	// Running the match command asks for the stats to be saved straight away
+	go collector.process()
+	collector.lines <- "Match"
+	select {
+	case <-statsChanged:
+	case <-time.After(time.Second):
+		t.Error("Expected the collector to ask for its stats to be saved")
+	}
+	lastCommand := collector.Stats().LastCommand
+	assert.False(t, lastCommand.IsZero())
+
+	close(collector.Done)
+	<-collector.Stopped
+
+	// A restarted collector picks the suppression back up from its saved stats
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "stats.json")
+	assert.Nil(t, WriteStatsFile(path, map[string]CollectorStats{"errors": collector.Stats()}))
+
+	restarted := &Collector{config: collector.config}
+	restarted.config.Name = "errors"
+	collection := Collection{collectors: []*Collector{restarted}}
+	assert.Nil(t, collection.LoadStats(path))
+	assert.True(t, restarted.suppressed(time.Now()))
+}
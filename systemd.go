@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-systemd/dbus"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// The most common fix for a dead heartbeat is restarting the unit that produces it. Instead
+// of a program any command can have a "systemd" unit to restart (the default) or reload,
+// which Log Pulse asks systemd to do over D-Bus itself rather than running systemctl, so
+// there's no sudo to set up; the D-Bus policy (or polkit) decides whether we're allowed.
+// Like any other command it counts as failed if the job systemd runs for it doesn't finish
+// successfully.
+
+const (
+	// SystemdRestart restarts the unit, the default
+	SystemdRestart = "restart"
+	// SystemdReload reloads the unit's configuration
+	SystemdReload = "reload"
+)
+
+// validateSystemd checks a command's systemd unit
+func validateSystemd(command CommandConfig) error {
+	if command.Systemd.Unit == "" {
+		if command.Systemd.Action != "" {
+			return errors.New("A systemd action needs a unit")
+		}
+		return nil
+	}
+	if command.Program != "" {
+		return fmt.Errorf("A command can have a program or a systemd unit but not both, %s has both", command)
+	}
+	switch command.Systemd.Action {
+	case "", SystemdRestart, SystemdReload:
+		return nil
+	}
+	return fmt.Errorf("Unknown systemd action %q, expected restart or reload", command.Systemd.Action)
+}
+
+// action is what to do with the unit
+func (config SystemdConfig) action() string {
+	if config.Action == "" {
+		return SystemdRestart
+	}
+	return config.Action
+}
+
+// Start asks systemd to restart or reload the unit, returning a function that waits for the
+// job to finish
+func (config SystemdConfig) Start() (func() error, error) {
+	if ExecDisabled {
+		logp.Info("Command execution is disabled, not executing: systemd %s %s", config.action(), config.Unit)
+		return nil, ErrExecDisabled
+	}
+
+	logp.Info("Asking systemd to %s %s", config.action(), config.Unit)
+	conn, err := dbus.New()
+	if err != nil {
+		return nil, err
+	}
+
+	// systemd reports how the job ended: "done", "failed", "timeout", "canceled" and so on
+	result := make(chan string, 1)
+	if config.action() == SystemdReload {
+		_, err = conn.ReloadUnit(config.Unit, "replace", result)
+	} else {
+		_, err = conn.RestartUnit(config.Unit, "replace", result)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() error {
+		defer conn.Close()
+		if status := <-result; status != "done" {
+			return fmt.Errorf("systemd job ended with %s", status)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSystemd(t *testing.T) {
+	assert.Nil(t, validateSystemd(CommandConfig{Program: "touch"}))
+	assert.Nil(t, validateSystemd(CommandConfig{Systemd: SystemdConfig{Unit: "nginx.service"}}))
+	assert.Nil(t, validateSystemd(CommandConfig{Systemd: SystemdConfig{Unit: "nginx.service", Action: SystemdReload}}))
+
+	assert.NotNil(t, validateSystemd(CommandConfig{Systemd: SystemdConfig{Action: SystemdRestart}}))
+	assert.NotNil(t, validateSystemd(CommandConfig{Systemd: SystemdConfig{Unit: "nginx.service", Action: "stop"}}))
+	assert.NotNil(t, validateSystemd(CommandConfig{Program: "touch", Systemd: SystemdConfig{Unit: "nginx.service"}}))
+}
+
+func TestSystemdCommand(t *testing.T) {
+	command := CommandConfig{Systemd: SystemdConfig{Unit: "nginx.service"}}
+	assert.True(t, command.configured())
+	assert.Equal(t, "systemd restart nginx.service", command.String())
+
+	// Units aren't templates
+	expanded, err := command.expand(commandData{Line: "ERROR"})
+	assert.Nil(t, err)
+	assert.Equal(t, command, expanded)
+
+	ExecDisabled = true
+	defer func() { ExecDisabled = false }()
+	wait, err := command.Systemd.Start()
+	assert.Nil(t, wait)
+	assert.Equal(t, ErrExecDisabled, err)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// A command's program and args can be Go templates, so the command can be told what set it
+// off without having to dig through its environment:
+//
+//   {{.Line}}      - the matching line
+//   {{.File}}      - the file it was read from, for files tailed through FileBeat
+//   {{.Collector}} - the collector's name
+//   {{.Groups.x}}  - what the named group x captured
+//   {{.Severity}}  - the level of the matching line, with a severity configured
+//   {{.Count}}     - how many lines matched, more than one for a burst with debounce
+//   {{.Before}}, {{.After}} - the lines around the matching line, with a context
+//   {{.Description}}, {{.RunbookURL}} - the collector's description and runbook_url
+//
+// There are functions to go with them too, see templatefuncs.go.
+//
+// Only match commands have a Line, File, Severity, Count, Before and After, and only match and sequence commands
+// have Groups; everything missing expands to an empty string. The line and groups go
+// through the command's sanitize first.
+//
+// Commands are run directly rather than through a shell unless they have "shell", so an
+// expanded argument is always exactly one argument whatever the log line holds. With
+// "shell" the program is a script and can't be a template at all, the args only being the
+// script's positional parameters, so a log line still can't inject shell code; the script
+// has to quote them as "$1" and so on. Expansions containing NUL bytes or line breaks are
+// refused outright rather than handed to the command (collapse_whitespace in the command's
+// sanitize takes care of the line breaks in multiline events).
+
+// commandData is what a command's templates can refer to
+type commandData struct {
+	Line      string
+	File      string
+	Collector string
+	Groups    map[string]string
+	Severity  string
+	Count     int
+	Before    []string
+	After     []string
+
+	Description string
+	RunbookURL  string
+}
+
+// validateTemplates makes sure a command's program and args are valid templates. A shell
+// command's program is a script, and anything from a log line expanded into it could run
+// as shell code, so only its args can be templates.
+func validateTemplates(command CommandConfig) error {
+	if command.Shell && strings.Contains(command.Program, "{{") {
+		return errors.New("The program of a shell command can't be a template, pass what it needs in args and use $1, $2 and so on")
+	}
+	texts := append([]string{command.Program, command.WriteFile.Content, command.AppendFile.Content}, command.Args...)
+	for _, text := range texts {
+		if _, err := parseTemplate(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expand fills in the templates in a command's program and args
+func (commandConfig CommandConfig) expand(data commandData) (CommandConfig, error) {
+	// There's nothing to expand for a systemd unit, a signal or a call to gRPC or AWS, and
+	// only the value of a metric
+	if commandConfig.Systemd.Unit != "" || commandConfig.Signal.configured() || commandConfig.GRPC.Address != "" ||
+		commandConfig.SNS.TopicARN != "" || commandConfig.Lambda.Function != "" {
+		return commandConfig, nil
+	}
+	if commandConfig.Metric.Name != "" {
+		value, err := expandTemplate(commandConfig.Metric.Value, data)
+		if err != nil {
+			return CommandConfig{}, err
+		}
+		expanded := commandConfig
+		expanded.Metric.Value = value
+		return expanded, nil
+	}
+
+	data.Line = sanitize(commandConfig.Sanitize, data.Line)
+	data.Groups = sanitizeGroups(commandConfig.Sanitize, data.Groups)
+	data.Before = sanitizeLines(commandConfig.Sanitize, data.Before)
+	data.After = sanitizeLines(commandConfig.Sanitize, data.After)
+
+	// A file's path isn't a template, only what's written to it is
+	if action, _, _ := commandConfig.fileAction(); action != "" {
+		expanded := commandConfig
+		var err error
+		if expanded.WriteFile.Content, err = expandTemplate(commandConfig.WriteFile.Content, data); err != nil {
+			return CommandConfig{}, err
+		}
+		if expanded.AppendFile.Content, err = expandTemplate(commandConfig.AppendFile.Content, data); err != nil {
+			return CommandConfig{}, err
+		}
+		return expanded, nil
+	}
+
+	// validateTemplates has already turned these away, this makes sure a script is never
+	// run with a log line spliced into it whatever the config went through
+	if commandConfig.Shell && strings.Contains(commandConfig.Program, "{{") {
+		return CommandConfig{}, errors.New("The program of a shell command can't be a template")
+	}
+	program, err := expandArgument(commandConfig.Program, data)
+	if err != nil {
+		return CommandConfig{}, err
+	}
+	if program == "" {
+		return CommandConfig{}, fmt.Errorf("The program %q expanded to nothing", commandConfig.Program)
+	}
+
+	args := make([]string, len(commandConfig.Args))
+	for i, arg := range commandConfig.Args {
+		if args[i], err = expandArgument(arg, data); err != nil {
+			return CommandConfig{}, err
+		}
+	}
+
+	expanded := commandConfig
+	expanded.Program = program
+	expanded.Args = args
+	return expanded, nil
+}
+
+// expandArgument expands a program or one of its args, refusing anything that could be
+// mistaken for more than one argument. What's written into the config itself is the user's
+// business.
+func expandArgument(text string, data commandData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	expanded, err := expandTemplate(text, data)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(expanded, "\x00\r\n") {
+		return "", fmt.Errorf("%q expanded to something containing a NUL byte or line break", text)
+	}
+	return expanded, nil
+}
+
+// expandTemplate expands a single template. What a file gets written and a metric's value
+// go through it as they are, line breaks and all.
+func expandTemplate(text string, data commandData) (string, error) {
+	// Plain strings don't need the template engine
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var expanded bytes.Buffer
+	if err := tmpl.Execute(&expanded, data); err != nil {
+		return "", err
+	}
+	return expanded.String(), nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	// Groups that didn't take part in the match are left out of the map, they should
+	// still expand to nothing rather than "<no value>"
+	return template.New("command").Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandExpand(t *testing.T) {
+	command := CommandConfig{
+		Program: "/usr/local/bin/{{.Collector}}-alert",
+		Args: []string{
+			"--line={{.Line}}",
+			"{{.File}}",
+			"{{.Groups.request_id}}",
+			"{{.Groups.missing}}",
+			"{{.Severity}}",
+			"literal; rm -rf /",
+			"{{.Description}} {{.RunbookURL}}",
+		},
+	}
+	data := commandData{
+		Line:      "ERROR request=abc; rm -rf /",
+		File:      "/var/log/app.log",
+		Collector: "app",
+		Groups:    map[string]string{"request_id": "abc"},
+		Severity:  "ERROR",
+
+		Description: "The app is failing requests",
+		RunbookURL:  "https://wiki.example.com/app",
+	}
+
+	expanded, err := command.expand(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/local/bin/app-alert", expanded.Program)
+	// Whatever's in the line stays a single argument
+	assert.Equal(t, []string{
+		"--line=ERROR request=abc; rm -rf /",
+		"/var/log/app.log",
+		"abc",
+		"",
+		"ERROR",
+		"literal; rm -rf /",
+		"The app is failing requests https://wiki.example.com/app",
+	}, expanded.Args)
+
+	// The original is left alone
+	assert.Equal(t, "--line={{.Line}}", command.Args[0])
+}
+
+func TestCommandExpandSanitizes(t *testing.T) {
+	command := CommandConfig{
+		Program:  "alert",
+		Args:     []string{"{{.Line}}", "{{.Groups.user}}"},
+		Sanitize: SanitizeConfig{CollapseWhitespace: true, Truncate: 9},
+	}
+	expanded, err := command.expand(commandData{
+		Line:   "Exception\n  at Main",
+		Groups: map[string]string{"user": "bob   smith"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Exception", "bob smith"}, expanded.Args)
+}
+
+func TestCommandExpandRefusesLineBreaks(t *testing.T) {
+	command := CommandConfig{Program: "alert", Args: []string{"{{.Line}}"}}
+
+	for _, line := range []string{"Exception\n  at Main", "carriage\rreturn", "nul\x00byte"} {
+		_, err := command.expand(commandData{Line: line})
+		assert.NotNil(t, err)
+	}
+
+	// Line breaks written into the args themselves are the user's business
+	expanded, err := CommandConfig{Program: "printf", Args: []string{"a\nb"}}.expand(commandData{})
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb", expanded.Args[0])
+
+	// A program has to be left over
+	_, err = CommandConfig{Program: "{{.File}}"}.expand(commandData{})
+	assert.NotNil(t, err)
+}
+
+func TestValidateTemplates(t *testing.T) {
+	assert.Nil(t, validateTemplates(CommandConfig{Program: "echo", Args: []string{"{{.Line}}", "plain"}}))
+	assert.NotNil(t, validateTemplates(CommandConfig{Program: "{{.Line", Args: nil}))
+	assert.NotNil(t, validateTemplates(CommandConfig{Program: "echo", Args: []string{"{{if}}"}}))
+
+	// Shell scripts can only take what's in the line through their args
+	assert.Nil(t, validateTemplates(CommandConfig{Program: `echo "$1"`, Args: []string{"{{.Line}}"}, Shell: true}))
+	assert.NotNil(t, validateTemplates(CommandConfig{Program: "echo {{.Line}}", Shell: true}))
+
+	// And nothing is ever expanded into a script, even one that got past validation
+	_, err := CommandConfig{Program: "echo {{.Line}}", Shell: true}.expand(commandData{Line: "$(reboot)"})
+	assert.NotNil(t, err)
+	expanded, err := CommandConfig{Program: `echo "$1"`, Args: []string{"{{.Line}}"}, Shell: true}.expand(commandData{Line: "$(reboot)"})
+	assert.Nil(t, err)
+	assert.Equal(t, `echo "$1"`, expanded.Program)
+	assert.Equal(t, []string{"$(reboot)"}, expanded.Args)
+}
+
+func TestCollectorProcessTemplate(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	collector := Collector{
+		lines:          make(chan string),
+		fileLines:      make(chan fileLine),
+		Done:           make(chan struct{}),
+		Stopped:        make(chan struct{}),
+		timeoutChannel: make(chan time.Time),
+
+		config: CollectorConfig{
+			Name: "app",
+			Command: CommandConfig{
+				Program: "touch",
+				Args:    []string{filepath.Join(tmpDir, "{{.Collector}}-{{.Groups.id}}-{{.File}}")},
+			},
+		},
+	}
+	collector.Pattern = regexp.MustCompile(`^Match (?P<id>\d+)`)
+
+	go collector.process()
+	collector.lines <- "Match 1"
+	collector.fileLines <- fileLine{text: "Match 2", source: "app.log"}
+	time.Sleep(50 * time.Millisecond)
+
+	assertFileExists(t, filepath.Join(tmpDir, "app-1-"))
+	assertFileExists(t, filepath.Join(tmpDir, "app-2-app.log"))
+
+	close(collector.Done)
+	<-collector.Stopped
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Composing a webhook body or a ticket title out of a log line usually needs a little more
+// than dropping the line in, so templates have a few functions of their own on top of Go's:
+//
+//   {{regexReplace "pattern" "replacement" .Line}} - replace every match, $1 and so on
+//                                                    being the pattern's groups
+//   {{truncate 80 .Line}}     - cut to at most 80 characters
+//   {{toJSON .Groups}}        - encode as JSON, strings being quoted and escaped
+//   {{b64 .Line}}             - encode as standard base64
+//   {{now}}                   - the current time as RFC 3339, or {{now "unix"}} for seconds
+//                               since the epoch, {{now "unixms"}} for milliseconds and any
+//                               other format a Go time layout like {{now "2006-01-02"}}
+//   {{humanizeDuration 3725}} - a duration, or a number of seconds, as "1h2m5s"
+//   {{urlencode .Line}}       - escape for a URL's query string
+//
+// They take what they work on last so they can be piped into, like
+// {{.Line | truncate 80 | urlencode}}. These are part of the template API and won't
+// change meaning.
+
+// templateFuncs are the functions our templates can call on top of text/template's own
+var templateFuncs = map[string]interface{}{
+	"regexReplace":     templateRegexReplace,
+	"truncate":         templateTruncate,
+	"toJSON":           templateToJSON,
+	"b64":              templateB64,
+	"now":              templateNow,
+	"humanizeDuration": templateHumanizeDuration,
+	"urlencode":        url.QueryEscape,
+}
+
+func templateRegexReplace(pattern string, replacement string, value string) (string, error) {
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return expression.ReplaceAllString(value, replacement), nil
+}
+
+// templateTruncate cuts value down to at most length characters, not bytes, so a
+// multibyte character is never cut in half
+func templateTruncate(length int, value string) string {
+	if length < 0 {
+		length = 0
+	}
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
+
+func templateToJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func templateB64(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// templateNow formats the current time, as RFC 3339 without a format
+func templateNow(format ...string) (string, error) {
+	t := time.Now()
+	if len(format) == 0 {
+		return t.Format(time.RFC3339), nil
+	}
+	if len(format) > 1 {
+		return "", fmt.Errorf("now takes at most one format, got %d", len(format))
+	}
+	switch format[0] {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "unixms":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), nil
+	}
+	return t.Format(format[0]), nil
+}
+
+// templateHumanizeDuration formats a duration to the second. Numbers and numeric strings
+// are taken as seconds, and other strings as Go durations like "90m".
+func templateHumanizeDuration(value interface{}) (string, error) {
+	var duration time.Duration
+	switch v := value.(type) {
+	case time.Duration:
+		duration = v
+	case int:
+		duration = time.Duration(v) * time.Second
+	case int64:
+		duration = time.Duration(v) * time.Second
+	case float64:
+		duration = time.Duration(v * float64(time.Second))
+	case string:
+		if seconds, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			duration = time.Duration(seconds * float64(time.Second))
+			break
+		}
+		parsed, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return "", fmt.Errorf("humanizeDuration can't make sense of %q", v)
+		}
+		duration = parsed
+	default:
+		return "", fmt.Errorf("humanizeDuration takes a duration or a number of seconds, got %T", value)
+	}
+	return duration.Round(time.Second).String(), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	data := commandData{
+		Line:   "ERROR user=alice@example.com failed: timeout",
+		Groups: map[string]string{"user": "alice@example.com"},
+		Count:  3725,
+	}
+	expand := func(text string) string {
+		expanded, err := expandTemplate(text, data)
+		assert.Nil(t, err)
+		return expanded
+	}
+
+	assert.Equal(t, "ERROR user=*** failed: timeout", expand(`{{regexReplace "user=\\S+" "user=***" .Line}}`))
+	assert.Equal(t, "alice", expand(`{{.Groups.user | regexReplace "^(\\w+)@.*$" "$1"}}`))
+	assert.Equal(t, "ERROR", expand(`{{truncate 5 .Line}}`))
+	assert.Equal(t, "héllo", expand(`{{truncate 5 "héllo wörld"}}`))
+	assert.Equal(t, `{"user":"alice@example.com"}`, expand(`{{toJSON .Groups}}`))
+	assert.Equal(t, `"say \"hi\""`, expand(`{{toJSON "say \"hi\""}}`))
+	assert.Equal(t, "aGk=", expand(`{{b64 "hi"}}`))
+	assert.Equal(t, "1h2m5s", expand(`{{humanizeDuration .Count}}`))
+	assert.Equal(t, "1m30s", expand(`{{humanizeDuration "90s"}}`))
+	assert.Equal(t, "a+b%3Dc%26d", expand(`{{urlencode "a b=c&d"}}`))
+	assert.Equal(t, "ERROR+user", expand(`{{.Line | truncate 10 | urlencode}}`))
+
+	_, err := time.Parse(time.RFC3339, expand(`{{now}}`))
+	assert.Nil(t, err)
+	assert.True(t, regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`).MatchString(expand(`{{now "2006-01-02"}}`)))
+	seconds, err := strconv.ParseInt(expand(`{{now "unix"}}`), 10, 64)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(time.Unix(seconds, 0)) < time.Minute)
+
+	// Mistakes are caught when the command runs, or before if they can be
+	_, err = expandTemplate(`{{regexReplace "(" "" .Line}}`, data)
+	assert.NotNil(t, err)
+	_, err = expandTemplate(`{{humanizeDuration "soon"}}`, data)
+	assert.NotNil(t, err)
+	assert.NotNil(t, validateTemplates(CommandConfig{Program: "alert", Args: []string{"{{nosuchfunc .Line}}"}}))
+}
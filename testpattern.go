@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// RunPatternTest runs every line read from input through each collector's patterns, exactly as
+// they'd be matched while running, and writes out which collectors matched which lines along
+// with the groups they captured and the command that would have run. Only the matching is
+// done: no inputs are started and no commands are run, and since thresholds, rates, sampling
+// and suppression depend on what happened before and when, they're left out.
+func RunPatternTest(configs LogPulseConfig, input io.Reader, output io.Writer) error {
+	collectors := make([]*Collector, len(configs))
+	for i, config := range configs {
+		collector, err := newCollector(config)
+		if err != nil {
+			return fmt.Errorf("Collector %s: %s", config.Name, err)
+		}
+		collectors[i] = collector
+	}
+
+	matches := make([]int, len(collectors))
+	lineNumber := 0
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+
+		for i, collector := range collectors {
+			groups, ok := collector.match(line)
+			if !ok {
+				continue
+			}
+			matches[i]++
+
+			fmt.Fprintf(output, "%d: %s matched: %s\n", lineNumber, collector.config.Name, line)
+			for _, name := range sortedKeys(groups) {
+				fmt.Fprintf(output, "    group %s = %s\n", name, groups[name])
+			}
+
+			commands, severity := collector.matchCommands(line, groups)
+			if severity != "" {
+				fmt.Fprintf(output, "    severity %s\n", severity)
+			}
+			for _, command := range commands {
+				data := commandData{Line: line, Collector: collector.config.Name, Groups: groups, Severity: severity}
+				if expanded, err := command.expand(data); err == nil {
+					fmt.Fprintf(output, "    would run %s\n", expanded)
+				} else {
+					fmt.Fprintf(output, "    would fail to run %s: %s\n", command, err)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(output)
+	for i, collector := range collectors {
+		fmt.Fprintf(output, "%s matched %d of %d lines\n", collector.config.Name, matches[i], lineNumber)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPatternTest(t *testing.T) {
+	configs := LogPulseConfig{
+		CollectorConfig{
+			Name:    "errors",
+			Pattern: `ERROR (?P<disk>sd[a-z])`,
+			Command: CommandConfig{Program: "page", Args: []string{"oncall"}},
+		},
+		CollectorConfig{
+			Name:           "warnings",
+			Pattern:        "WARN",
+			ExcludePattern: "harmless",
+		},
+	}
+
+	input := strings.NewReader("ERROR sda full\nWARN harmless\nWARN disk slow\nINFO ok\n")
+	var output bytes.Buffer
+	err := RunPatternTest(configs, input, &output)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `1: errors matched: ERROR sda full
+    group disk = sda
+    would run page oncall
+3: warnings matched: WARN disk slow
+
+errors matched 1 of 4 lines
+warnings matched 1 of 4 lines
+`, output.String())
+}
+
+func TestRunPatternTestInvalidPattern(t *testing.T) {
+	configs := LogPulseConfig{
+		CollectorConfig{Name: "broken", Pattern: "("},
+	}
+
+	var output bytes.Buffer
+	err := RunPatternTest(configs, strings.NewReader("line\n"), &output)
+	assert.NotNil(t, err)
+	assert.Empty(t, output.String())
+}
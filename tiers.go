@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// A single timeout interval means one response to silence, however long it lasts. A
+// timeout's "tiers" escalate instead: a soft command after a minute without a match, a
+// restart after five, a page after fifteen. Each tier is like a timeout of its own, with
+// its own commands, firing "after" that long without a match and again every "after" from
+// then on, or only once until the next match with "once". The usual timeout.interval still
+// works alongside them, or can be left out.
+//
+// Tiers respect the grace period after a resume and active_hours, but not timeout.misses,
+// they're thresholds of their own. They go by the wall clock even with a timestamp.
+//
+// Every tier is kept by the one timer, aimed at whichever tier is due first.
+
+// timeoutTier is the state of one of our tiers
+type timeoutTier struct {
+	config TimeoutTierConfig
+	// When it's due next
+	deadline time.Time
+	// Set once a tier with once has fired, until the next match
+	done bool
+}
+
+// validateTimeoutTiers checks a timeout's tiers
+func validateTimeoutTiers(tiers []TimeoutTierConfig) error {
+	for i, tier := range tiers {
+		if tier.After <= 0 {
+			return fmt.Errorf("Timeout tier %d needs a positive after, got %s", i+1, tier.After)
+		}
+		if len(commandList(tier.Command, tier.Commands)) == 0 {
+			return fmt.Errorf("Timeout tier %d after %s has no command", i+1, tier.After)
+		}
+	}
+	return nil
+}
+
+// newTimeoutTiers sets up the state of our tiers, counting from now
+func newTimeoutTiers(configs []TimeoutTierConfig) []timeoutTier {
+	now := time.Now()
+	tiers := make([]timeoutTier, len(configs))
+	for i, config := range configs {
+		tiers[i] = timeoutTier{config: config, deadline: now.Add(config.After)}
+	}
+	return tiers
+}
+
+// resetTiers starts every tier counting again from now
+func (collector *Collector) resetTiers() {
+	if collector.tierTimer == nil || collector.awaitingFirstMatch {
+		return
+	}
+	now := time.Now()
+	for i := range collector.tiers {
+		collector.tiers[i].deadline = now.Add(collector.tiers[i].config.After)
+		collector.tiers[i].done = false
+	}
+	collector.armTiers(now)
+}
+
+// handleTiers runs the commands of every tier that's due and aims the timer at the next one
+func (collector *Collector) handleTiers() {
+	now := time.Now()
+	suppressed := collector.timeoutsSuppressed(now)
+
+	for i := range collector.tiers {
+		tier := &collector.tiers[i]
+		if tier.done || tier.deadline.After(now) {
+			continue
+		}
+
+		if !suppressed {
+			logp.Info("Collector %s hasn't matched for %s, running its timeout tier", collector.config.Name, tier.config.After)
+			commands := commandList(tier.config.Command, tier.config.Commands)
+			collector.runCommands(TimeoutAction, commands, commandData{Collector: collector.config.Name})
+			collector.recoveryPending = true
+		}
+
+		// A once tier that was suppressed hasn't fired yet, so it's tried again like any other
+		if tier.config.Once && !suppressed {
+			tier.done = true
+			continue
+		}
+		// Like the timeout itself a tier doesn't drift, or make up for lost time
+		tier.deadline = tier.deadline.Add(tier.config.After)
+		if !tier.deadline.After(now) {
+			tier.deadline = now.Add(tier.config.After)
+		}
+	}
+	collector.armTiers(now)
+}
+
+// armTiers aims the timer at the tier due first, stopping it if none are left
+func (collector *Collector) armTiers(now time.Time) {
+	var next time.Time
+	for _, tier := range collector.tiers {
+		if !tier.done && (next.IsZero() || tier.deadline.Before(next)) {
+			next = tier.deadline
+		}
+	}
+	if next.IsZero() {
+		if !collector.tierTimer.Stop() {
+			select {
+			case <-collector.tierTimer.C:
+			default:
+			}
+		}
+		return
+	}
+	armTimer(collector.tierTimer, next.Sub(now))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTimeoutTiers(t *testing.T) {
+	command := CommandConfig{Program: "true"}
+	assert.Nil(t, validateTimeoutTiers(nil))
+	assert.Nil(t, validateTimeoutTiers([]TimeoutTierConfig{{After: time.Minute, Command: command}}))
+
+	assert.NotNil(t, validateTimeoutTiers([]TimeoutTierConfig{{Command: command}}))
+	assert.NotNil(t, validateTimeoutTiers([]TimeoutTierConfig{{After: time.Minute}}))
+}
+
+func TestCollectorTimeoutTiers(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	soft := filepath.Join(tmpDir, "soft")
+	hard := filepath.Join(tmpDir, "hard")
+	tiers := []TimeoutTierConfig{
+		{After: 30 * time.Millisecond, Command: CommandConfig{Program: "sh", Args: []string{"-c", "echo >> " + soft}}},
+		{After: 100 * time.Millisecond, Once: true, Command: CommandConfig{Program: "sh", Args: []string{"-c", "echo >> " + hard}}},
+	}
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   make(chan time.Time),
+		statsRequests:    make(chan chan CollectorStats),
+		finishedCommands: make(chan commandDuration),
+		tiers:            newTimeoutTiers(tiers),
+		tierTimer:        time.NewTimer(tiers[0].After),
+
+		config: CollectorConfig{Timeout: TimeoutConfig{Tiers: tiers}},
+	}
+	collector.tierChannel = collector.tierTimer.C
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	go collector.process()
+
+	// Matches keep every tier at bay
+	for i := 0; i < 5; i++ {
+		collector.lines <- "Match"
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertFileDoesNotExist(t, soft)
+
+	// The soft tier repeats, the hard one only fires once
+	time.Sleep(250 * time.Millisecond)
+	close(collector.Done)
+	<-collector.Stopped
+	time.Sleep(20 * time.Millisecond)
+
+	contents, err := ioutil.ReadFile(soft)
+	assert.Nil(t, err)
+	assert.True(t, len(contents) >= 3, "the soft tier should have fired repeatedly")
+	contents, err = ioutil.ReadFile(hard)
+	assert.Nil(t, err)
+	assert.Equal(t, "\n", string(contents))
+}
+
+func TestTimeoutTiersSuppressed(t *testing.T) {
+	tiers := []TimeoutTierConfig{{After: time.Hour, Once: true, Command: CommandConfig{Program: "true"}}}
+	collector := Collector{
+		tiers:                 newTimeoutTiers(tiers),
+		tierTimer:             time.NewTimer(time.Hour),
+		suppressTimeoutsUntil: time.Now().Add(time.Hour),
+	}
+	defer collector.tierTimer.Stop()
+
+	// A tier that's due during the grace period is skipped and tried again later
+	collector.tiers[0].deadline = time.Now().Add(-time.Second)
+	collector.handleTiers()
+	assert.False(t, collector.tiers[0].done)
+	assert.True(t, collector.tiers[0].deadline.After(time.Now().Add(59*time.Minute)))
+
+	// Once the grace period is over it fires, and only then counts as fired
+	collector.suppressTimeoutsUntil = time.Time{}
+	collector.tiers[0].deadline = time.Now().Add(-time.Second)
+	collector.handleTiers()
+	assert.True(t, collector.tiers[0].done)
+
+	collector.resetTiers()
+	assert.False(t, collector.tiers[0].done)
+	assert.True(t, collector.tiers[0].deadline.After(time.Now().Add(59*time.Minute)))
+}
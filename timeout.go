@@ -0,0 +1,104 @@
+package main
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// A collector's timeout fires exactly timeout.interval (or the one its schedule has for the
+// time of day, see schedule.go) after the last match, and again every
+// interval (or repeat_interval, if it's set) after that for as long as nothing matches. With
+// max_firings the command stops running after that many of them, until the next match.
+//
+// It's a single time.Timer aimed at a deadline, plus any jitter (see jitter.go): a match
+// moves the deadline to interval from now and resets the timer, and when
+// the timer fires the next deadline is interval after the one that just passed rather than
+// after whenever we got around to handling it, so repeated timeouts don't drift by however
+// long handling them took. If we fall more than an interval behind (the host was suspended,
+// say) the missed timeouts aren't made up for in a burst, counting starts again from now.
+//
+// With arm_on_first_match none of this starts until the pattern has matched once, for
+// services that are deployed after Log Pulse starts and can't be late before they exist.
+//
+// Timers run off the monotonic clock, so the wall clock being changed doesn't move them, see
+// clock.go for what happens when it is.
+
+// resetTimeout starts counting the timeout, and its tiers, again from now, after a match
+func (collector *Collector) resetTimeout() {
+	collector.resetTimeoutTimer()
+	collector.resetTiers()
+}
+
+// resetTimeoutTimer starts counting the timeout again from now, leaving the tiers alone
+func (collector *Collector) resetTimeoutTimer() {
+	if collector.timeoutTimer == nil || collector.awaitingFirstMatch {
+		return
+	}
+	now := time.Now()
+	interval := collector.interval(now)
+	collector.timeoutDeadline = now.Add(interval)
+	armTimer(collector.timeoutTimer, interval+collector.jitter(interval))
+}
+
+// disarmTimeout stops the timeout, and its tiers, until the next reset
+func (collector *Collector) disarmTimeout() {
+	if collector.timeoutTimer != nil {
+		collector.timeoutTimer.Stop()
+	}
+	if collector.tierTimer != nil {
+		collector.tierTimer.Stop()
+	}
+}
+
+// nextTimeout aims the timer at the next timeout once one has fired
+func (collector *Collector) nextTimeout() {
+	if collector.timeoutTimer == nil {
+		return
+	}
+	now := time.Now()
+	interval := collector.interval(now)
+	if collector.config.Timeout.RepeatInterval > 0 {
+		interval = collector.config.Timeout.RepeatInterval
+	}
+	collector.timeoutDeadline = collector.timeoutDeadline.Add(interval)
+	if !collector.timeoutDeadline.After(now) {
+		collector.timeoutDeadline = now.Add(interval)
+	}
+	armTimer(collector.timeoutTimer, collector.timeoutDeadline.Sub(now)+collector.jitter(interval))
+}
+
+// timeoutsSuppressed reports whether timeouts should be ignored right now, because nothing
+// has matched yet with arm_on_first_match, we're in a grace period or maintenance, or outside
+// of active_hours
+func (collector *Collector) timeoutsSuppressed(now time.Time) bool {
+	if collector.awaitingFirstMatch {
+		logp.Debug("log-pulse", "Ignoring timeout before the first match")
+		return true
+	}
+	if now.Before(collector.suppressTimeoutsUntil) {
+		logp.Debug("log-pulse", "Ignoring timeout during grace period")
+		return true
+	}
+	if collector.maintenance.active(now) {
+		logp.Debug("log-pulse", "Ignoring timeout during maintenance")
+		return true
+	}
+	if !collector.activeHours.active(now) {
+		logp.Debug("log-pulse", "Ignoring timeout outside of active_hours")
+		return true
+	}
+	return false
+}
+
+// armTimer sets a timer to fire after wait. If it fired but that hasn't been handled yet
+// it's thrown away, it's been overtaken.
+func armTimer(timer *time.Timer, wait time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(wait)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutDeadline(t *testing.T) {
+	interval := time.Hour
+	collector := Collector{
+		config:       CollectorConfig{Timeout: TimeoutConfig{Interval: interval}},
+		timeoutTimer: time.NewTimer(interval),
+	}
+	defer collector.timeoutTimer.Stop()
+
+	// A match puts the deadline an interval from now
+	before := time.Now()
+	collector.resetTimeout()
+	assert.False(t, collector.timeoutDeadline.Before(before.Add(interval)))
+	assert.False(t, collector.timeoutDeadline.After(time.Now().Add(interval)))
+
+	// Each timeout is an interval after the one before, however late it's handled
+	deadline := time.Now().Add(-time.Minute)
+	collector.timeoutDeadline = deadline
+	collector.nextTimeout()
+	assert.Equal(t, deadline.Add(interval), collector.timeoutDeadline)
+
+	// Unless we've fallen a whole interval behind
+	collector.timeoutDeadline = time.Now().Add(-2 * interval)
+	before = time.Now()
+	collector.nextTimeout()
+	assert.False(t, collector.timeoutDeadline.Before(before.Add(interval)))
+
+	// Without a timeout there's nothing to do
+	var none Collector
+	none.resetTimeout()
+	none.nextTimeout()
+	assert.True(t, none.timeoutDeadline.IsZero())
+}
+
+func TestTimeoutFiresAfterLastMatch(t *testing.T) {
+	interval := 50 * time.Millisecond
+	collector := Collector{
+		config:       CollectorConfig{Timeout: TimeoutConfig{Interval: interval}},
+		timeoutTimer: time.NewTimer(time.Hour),
+	}
+	defer collector.timeoutTimer.Stop()
+
+	// An old timeout waiting to be handled is thrown away by a match
+	armTimer(collector.timeoutTimer, 0)
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	collector.resetTimeout()
+
+	<-collector.timeoutTimer.C
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= interval, "fired early")
+	assert.True(t, elapsed < 4*interval, "fired late")
+}
+
+func TestHoldOffTimeouts(t *testing.T) {
+	var collector Collector
+	collector.holdOffTimeouts(time.Hour)
+	until := collector.suppressTimeoutsUntil
+	assert.True(t, until.After(time.Now().Add(59*time.Minute)))
+
+	// A shorter grace period doesn't cut a longer one short
+	collector.holdOffTimeouts(time.Minute)
+	assert.Equal(t, until, collector.suppressTimeoutsUntil)
+
+	// Timeouts in the meantime are ignored
+	collector.handleTimeout()
+	assert.False(t, collector.timedOutOnce)
+}
+
+func TestTimeoutStartDelayValidation(t *testing.T) {
+	_, err := newCollector(CollectorConfig{Pattern: "a", Timeout: TimeoutConfig{StartDelay: -time.Minute}})
+	assert.NotNil(t, err)
+	_, err = newCollector(CollectorConfig{Pattern: "a", Timeout: TimeoutConfig{StartDelay: time.Minute}})
+	assert.Nil(t, err)
+}
+
+func TestTimeoutRepeatInterval(t *testing.T) {
+	collector := Collector{
+		config:       CollectorConfig{Timeout: TimeoutConfig{Interval: time.Minute, RepeatInterval: time.Hour}},
+		timeoutTimer: time.NewTimer(time.Hour),
+	}
+	defer collector.timeoutTimer.Stop()
+
+	// The first timeout comes after the interval, the ones after it every repeat_interval
+	collector.resetTimeout()
+	first := collector.timeoutDeadline
+	assert.True(t, first.Before(time.Now().Add(2*time.Minute)))
+	collector.nextTimeout()
+	assert.Equal(t, first.Add(time.Hour), collector.timeoutDeadline)
+}
+
+func TestTimeoutMaxFirings(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	firings := filepath.Join(tmpDir, "firings")
+	timeoutChannel := make(chan time.Time)
+	collector := Collector{
+		lines:            make(chan string),
+		Done:             make(chan struct{}),
+		Stopped:          make(chan struct{}),
+		timeoutChannel:   timeoutChannel,
+		statsRequests:    make(chan chan CollectorStats),
+		finishedCommands: make(chan commandDuration),
+
+		config: CollectorConfig{
+			Timeout: TimeoutConfig{
+				Interval:   time.Hour,
+				MaxFirings: 2,
+				Command:    CommandConfig{Program: "sh", Args: []string{"-c", "echo >> " + firings}},
+			},
+		},
+	}
+	collector.Pattern, _ = regexp.Compile("^Match")
+
+	count := func() int {
+		time.Sleep(50 * time.Millisecond)
+		contents, _ := ioutil.ReadFile(firings)
+		return len(contents)
+	}
+
+	go collector.process()
+	for i := 0; i < 4; i++ {
+		timeoutChannel <- time.Now()
+	}
+	assert.Equal(t, 2, count())
+
+	// A match starts the count again
+	collector.lines <- "Match"
+	timeoutChannel <- time.Now()
+	assert.Equal(t, 3, count())
+
+	close(collector.Done)
+	<-collector.Stopped
+}
+
+func TestTimeoutArmOnFirstMatch(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	touchedFile := filepath.Join(tmpDir, "touched-file")
+	collector, err := newCollector(CollectorConfig{
+		Pattern: "^Match",
+		Timeout: TimeoutConfig{
+			Interval:        50 * time.Millisecond,
+			ArmOnFirstMatch: true,
+			Command:         CommandConfig{Program: "touch", Args: []string{touchedFile}},
+		},
+	})
+	assert.Nil(t, err)
+	collector.timeoutTimer = time.NewTimer(collector.config.Timeout.Interval)
+	collector.timeoutChannel = collector.timeoutTimer.C
+	collector.disarmTimeout()
+
+	// Starting doesn't start the timeout either
+	collector.resetTimeout()
+	go collector.process()
+
+	time.Sleep(150 * time.Millisecond)
+	assertFileDoesNotExist(t, touchedFile)
+
+	collector.lines <- "Match"
+	time.Sleep(150 * time.Millisecond)
+	assertFileExists(t, touchedFile)
+
+	close(collector.Done)
+	<-collector.Stopped
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Everything Log Pulse connects to over TLS takes the same settings: gRPC commands, metrics
+// pushed to a Pushgateway, http probes, maintenance calendars and the InfluxDB writer.
+//
+//   ca                    the certificates to trust instead of the system's
+//   cert, key             a client certificate, for mTLS
+//   insecure_skip_verify  don't check the server's certificate at all
+//   min_version           the oldest TLS version to accept, 1.0, 1.1 or 1.2
+//   server_name           the name on the server's certificate, if it isn't the host
+//
+// The files are read again for every connection, so rotated certificates are picked up
+// without a restart. Changed settings are picked up by a SIGHUP reload like any other.
+
+// tlsVersions are the versions min_version can name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// networkDialer opens our outbound connections. It tries a host's IPv6 and IPv4 addresses
+// side by side (happy eyeballs), so neither an IPv6 only network nor a broken IPv6 route
+// holds a connection up.
+var networkDialer = &net.Dialer{Timeout: 30 * time.Second, DualStack: true}
+
+// validate checks the settings without reading any of the files
+func (config TLSConfig) validate() error {
+	if (config.Cert == "") != (config.Key == "") {
+		return errors.New("A TLS client certificate needs both a cert and a key")
+	}
+	if _, ok := tlsVersions[config.MinVersion]; config.MinVersion != "" && !ok {
+		return fmt.Errorf("Unknown TLS min_version %q, expected 1.0, 1.1 or 1.2", config.MinVersion)
+	}
+	return nil
+}
+
+// isSet reports whether any TLS setting has been made
+func (config TLSConfig) isSet() bool {
+	return config != TLSConfig{}
+}
+
+// load reads the certificates and sets up TLS with them
+func (config TLSConfig) load() (*tls.Config, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tlsVersions[config.MinVersion],
+	}
+	if config.CA != "" {
+		pem, err := ioutil.ReadFile(config.CA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("There are no certificates in %s", config.CA)
+		}
+	}
+	if config.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// httpClient returns a client for a single request using the TLS settings. Connections
+// aren't kept open, as the certificates are read again for the next one anyway.
+func (config TLSConfig) httpClient(timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := config.load()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DialContext:       networkDialer.DialContext,
+		TLSClientConfig:   tlsConfig,
+		DisableKeepAlives: true,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
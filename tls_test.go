@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSValidate(t *testing.T) {
+	assert.Nil(t, TLSConfig{}.validate())
+	assert.Nil(t, TLSConfig{CA: "ca.pem", Cert: "client.pem", Key: "client.key", MinVersion: "1.2"}.validate())
+
+	assert.NotNil(t, TLSConfig{Cert: "client.pem"}.validate())
+	assert.NotNil(t, TLSConfig{Key: "client.key"}.validate())
+	assert.NotNil(t, TLSConfig{MinVersion: "1.4"}.validate())
+
+	assert.False(t, TLSConfig{}.isSet())
+	assert.True(t, TLSConfig{InsecureSkipVerify: true}.isSet())
+}
+
+func TestTLSLoad(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	config, err := TLSConfig{MinVersion: "1.1", ServerName: "automation"}.load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS11), config.MinVersion)
+	assert.Equal(t, "automation", config.ServerName)
+	assert.Nil(t, config.RootCAs)
+
+	_, err = TLSConfig{CA: filepath.Join(tmpDir, "missing.pem")}.load()
+	assert.NotNil(t, err)
+
+	empty := filepath.Join(tmpDir, "empty.pem")
+	assert.Nil(t, ioutil.WriteFile(empty, []byte("not a certificate"), 0644))
+	_, err = TLSConfig{CA: empty}.load()
+	assert.NotNil(t, err)
+
+	_, err = TLSConfig{Cert: filepath.Join(tmpDir, "missing.pem"), Key: filepath.Join(tmpDir, "missing.key")}.load()
+	assert.NotNil(t, err)
+}
+
+func TestTLSHTTPClient(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "log-pulse-test")
+	defer os.RemoveAll(tmpDir)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ca := filepath.Join(tmpDir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+
+	get := func(config TLSConfig) error {
+		client, err := config.httpClient(time.Second)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// The server's certificate isn't one of the system's
+	assert.NotNil(t, get(TLSConfig{}))
+	assert.Nil(t, get(TLSConfig{CA: ca}))
+	assert.Nil(t, get(TLSConfig{InsecureSkipVerify: true}))
+	assert.NotNil(t, get(TLSConfig{CA: ca, ServerName: "elsewhere"}))
+}
+
+func TestTLSOnlyWhereUsed(t *testing.T) {
+	tlsConfig := TLSConfig{CA: "ca.pem"}
+
+	_, err := NewProbeInput(ProbeConfig{Protocol: ProbeTCP, Address: "db:5432", TLS: tlsConfig}, nil)
+	assert.NotNil(t, err)
+	_, err = NewProbeInput(ProbeConfig{Protocol: ProbeHTTP, Address: "https://db/health", TLS: tlsConfig}, nil)
+	assert.Nil(t, err)
+
+	metric := MetricConfig{Name: "failures", Statsd: "localhost:8125", TLS: tlsConfig}
+	assert.NotNil(t, validateMetric(CommandConfig{Metric: metric}))
+	metric = MetricConfig{Name: "failures", Pushgateway: "https://pushgateway:9091", TLS: tlsConfig}
+	assert.Nil(t, validateMetric(CommandConfig{Metric: metric}))
+
+	_, err = newMaintenanceCalendar(MaintenanceConfig{ICal: "https://calendar/ical", TLS: TLSConfig{MinVersion: "2"}}, "")
+	assert.NotNil(t, err)
+}